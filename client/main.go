@@ -6,7 +6,6 @@ import (
 	"log"
 	"net"
 	"strings"
-	"strconv"
 	"time"
 	"io"
 	"sort"
@@ -57,10 +56,14 @@ func NewClient() (*Client, error) {
 		return nil, fmt.Errorf("初始化命令行失败: %v", err)
 	}
 
+	// 数值按原样保留，避免大整数被显示为科学计数法
+	decoder := json.NewDecoder(conn)
+	decoder.UseNumber()
+
 	return &Client{
 		conn:     conn,
 		encoder:  json.NewEncoder(conn),
-		decoder:  json.NewDecoder(conn),
+		decoder:  decoder,
 		rl:       rl,
 	}, nil
 }
@@ -124,7 +127,25 @@ func (c completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 		"SELECT * FROM ",
 		"UPDATE ",
 		"DELETE FROM ",
+		"DROP TABLE ",
+		"ALTER TABLE ",
+		"TRUNCATE TABLE ",
+		"CREATE SEQUENCE ",
+		"DROP SEQUENCE ",
+		"CREATE INDEX ",
+		"CREATE UNIQUE INDEX ",
+		"DROP INDEX ",
+		"BEGIN",
+		"COMMIT",
+		"ROLLBACK",
+		"SAVEPOINT ",
+		"ROLLBACK TO ",
+		"RELEASE SAVEPOINT ",
 		"SAVE",
+		"SET AUTOSAVE ",
+		"SHOW AUTOSAVE",
+		"BACKUP TO ",
+		"RESTORE FROM ",
 		"EXIT",
 		"HELP",
 	}
@@ -152,9 +173,6 @@ func (c completer) Do(line []rune, pos int) (newLine [][]rune, length int) {
 
 func (c *Client) handleCommand(input string) error {
 	cmd := parseCommand(input)
-	if cmd.Type == -1 {
-		return fmt.Errorf("无效的命令。输入 HELP 查看支持的命令格式")
-	}
 
 	// 发送命令到服务器
 	if err := c.encoder.Encode(cmd); err != nil {
@@ -172,25 +190,64 @@ func (c *Client) handleCommand(input string) error {
 		return fmt.Errorf("服务器错误: %s", response.Error)
 	}
 
-	// 根据命令类型格式化输出
-	switch cmd.Type {
-	case protocol.Select:
-		c.displaySelectResult(response.Data)
-	case protocol.Delete:
-		fmt.Println(response.Data)
-	case protocol.SaveToDisk:
+	// 根据命令类型和返回数据格式化输出
+	if cmd.Type == protocol.SaveToDisk {
 		fmt.Println("数据库已保存")
-	default:
-		if response.Data != nil {
-			fmt.Printf("成功: %v\n", response.Data)
+		return nil
+	}
+	switch data := response.Data.(type) {
+	case []interface{}:
+		c.displaySelectResult(data)
+	case map[string]interface{}:
+		if _, ok := data["columns"]; ok {
+			c.displayResultSet(data)
+		} else if inserted, ok := data["inserted"]; ok {
+			fmt.Printf("Inserted %v records\n", inserted)
+			if id, ok := data["last_insert_id"]; ok {
+				fmt.Printf("最后插入的 ID: %v\n", id)
+			}
+		} else if action, ok := data["action"]; ok {
+			c.displayArchive(action, data)
+		} else if policy, ok := data["policy"]; ok {
+			fmt.Printf("自动保存策略: %v，未保存的修改: %v\n", policy, data["unsaved"])
 		} else {
-			fmt.Println("操作成功")
+			fmt.Printf("成功: %v\n", data)
 		}
+	case string:
+		fmt.Println(data)
+	case nil:
+		fmt.Println("操作成功")
+	default:
+		fmt.Printf("成功: %v\n", data)
 	}
 
 	return nil
 }
 
+// 显示备份或恢复的每张表和行数
+func (c *Client) displayArchive(action interface{}, data map[string]interface{}) {
+	tables, _ := data["tables"].([]interface{})
+	var total int64
+	for _, t := range tables {
+		table, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		n, _ := table["rows"].(json.Number)
+		rows, _ := n.Int64()
+		total += rows
+		fmt.Printf("  %v: %d 行\n", table["name"], rows)
+	}
+	if sequences, ok := data["sequences"].([]interface{}); ok && len(sequences) > 0 {
+		fmt.Printf("  序列: %v\n", sequences)
+	}
+	if action == "backup" {
+		fmt.Printf("已备份 %d 张表、%d 行到 %v（日志序号 %v）\n", len(tables), total, data["file"], data["lsn"])
+	} else {
+		fmt.Printf("已从 %v 恢复 %d 张表、%d 行（备份于 %v）\n", data["file"], len(tables), total, data["created"])
+	}
+}
+
 // 格式化显示查询结果
 func (c *Client) displaySelectResult(data interface{}) {
 	rows, ok := data.([]interface{})
@@ -224,7 +281,7 @@ func (c *Client) displaySelectResult(data interface{}) {
 			continue
 		}
 		for col, val := range rowMap {
-			width := len(fmt.Sprintf("%v", val))
+			width := len(formatValue(val))
 			if width > widths[col] {
 				widths[col] = width
 			}
@@ -246,7 +303,7 @@ func (c *Client) displaySelectResult(data interface{}) {
 			continue
 		}
 		for _, col := range columns {
-			fmt.Printf("| %-*v ", widths[col], rowMap[col])
+			fmt.Printf("| %-*s ", widths[col], formatValue(rowMap[col]))
 		}
 		fmt.Println("|")
 	}
@@ -254,412 +311,160 @@ func (c *Client) displaySelectResult(data interface{}) {
 	fmt.Printf("共 %d 条记录\n", len(rows))
 }
 
-func calculateTableWidth(columns []string, widths map[string]int) int {
-	width := 1 // 开始的 |
-	for _, col := range columns {
-		width += widths[col] + 3 // 列宽 + " | "
-	}
-	return width
-}
-
-// 解析命令字符串为 Command 对象
-func parseCommand(input string) protocol.Command {
-	parts := strings.Fields(input)
-	if len(parts) == 0 {
-		return protocol.Command{Type: -1}
-	}
-
-	switch strings.ToUpper(parts[0]) {
-	case "CREATE":
-		return parseCreateTable(parts[1:])
-	case "INSERT":
-		return parseInsert(parts[1:])
-	case "SELECT":
-		return parseSelect(parts[1:])
-	case "UPDATE":
-		return parseUpdate(parts[1:])
-	case "DELETE":
-		return parseDelete(parts[1:])
-	case "SAVE":
-		return protocol.Command{Type: protocol.SaveToDisk}
-	default:
-		return protocol.Command{Type: -1}
+// 按服务器返回的列顺序显示 SQL 查询结果
+func (c *Client) displayResultSet(data map[string]interface{}) {
+	rawColumns, _ := data["columns"].([]interface{})
+	rawRows, _ := data["rows"].([]interface{})
+	if len(rawRows) == 0 {
+		fmt.Println("没有找到记录")
+		return
 	}
-}
 
-// 解析 CREATE TABLE 命令
-func parseCreateTable(args []string) protocol.Command {
-	// CREATE TABLE tablename (column1 type1, column2 type2)
-	if len(args) < 4 || strings.ToUpper(args[0]) != "TABLE" {
-		return protocol.Command{Type: -1}
+	columns := make([]string, len(rawColumns))
+	widths := make(map[string]int)
+	for i, col := range rawColumns {
+		columns[i] = fmt.Sprintf("%v", col)
+		widths[columns[i]] = len(columns[i])
 	}
 
-	tableName := args[1]
-	columnsStr := strings.Join(args[2:], " ")
-	
-	// 提取括号中的内容
-	start := strings.Index(columnsStr, "(")
-	end := strings.LastIndex(columnsStr, ")")
-	if start == -1 || end == -1 || start >= end {
-		return protocol.Command{Type: -1}
-	}
-
-	// 解析列定义
-	columnDefs := strings.Split(columnsStr[start+1:end], ",")
-	columns := make([]struct{
-		Name string `json:"name"`
-		Type string `json:"type"`
-	}, 0)
-	
-	for _, def := range columnDefs {
-		parts := strings.Fields(strings.TrimSpace(def))
-		if len(parts) != 2 {
-			return protocol.Command{Type: -1}
+	rows := make([][]string, 0, len(rawRows))
+	for _, rawRow := range rawRows {
+		values, ok := rawRow.([]interface{})
+		if !ok || len(values) != len(columns) {
+			fmt.Println("数据格式错误")
+			return
 		}
-		
-		colType := strings.ToLower(parts[1])
-		if colType != "int" && colType != "string" {
-			return protocol.Command{Type: -1}
+		row := make([]string, len(values))
+		for i, val := range values {
+			row[i] = formatValue(val)
+			if len(row[i]) > widths[columns[i]] {
+				widths[columns[i]] = len(row[i])
+			}
 		}
-		
-		columns = append(columns, struct{
-			Name string `json:"name"`
-			Type string `json:"type"`
-		}{
-			Name: parts[0],
-			Type: colType,
-		})
+		rows = append(rows, row)
 	}
 
-	return protocol.Command{
-		Type: protocol.CreateTable,
-			Payload: protocol.CreateTablePayload{
-				TableName: tableName,
-				Columns:   columns,
-			},
-	}
-}
-
-// 解析 INSERT 命令
-func parseInsert(args []string) protocol.Command {
-	// INSERT INTO tablename (col1, col2, ...) VALUES (value1, value2, ...)
-	if len(args) < 4 || strings.ToUpper(args[0]) != "INTO" {
-		return protocol.Command{Type: -1}
-	}
-
-	tableName := args[1]
-	restStr := strings.Join(args[2:], " ")
-
-	// 查找列名列表和值列表
-	colStart := strings.Index(restStr, "(")
-	colEnd := strings.Index(restStr, ")")
-	if colStart == -1 || colEnd == -1 || colStart >= colEnd {
-		return protocol.Command{Type: -1}
-	}
-
-	// 提取并解析列名
-	colStr := restStr[colStart+1:colEnd]
-	columns := parseColumnList(colStr)
-	if len(columns) == 0 {
-		return protocol.Command{Type: -1}
-	}
-
-	// 查找 VALUES 关键字
-	valuesIdx := strings.Index(strings.ToUpper(restStr[colEnd+1:]), "VALUES")
-	if valuesIdx == -1 {
-		return protocol.Command{Type: -1}
-	}
-	valuesIdx += colEnd + 1
-
-	// 提取值列表
-	valuesPart := restStr[valuesIdx+6:]
-	valStart := strings.Index(valuesPart, "(")
-	valEnd := strings.LastIndex(valuesPart, ")")
-	if valStart == -1 || valEnd == -1 || valStart >= valEnd {
-		return protocol.Command{Type: -1}
-	}
-
-	// 解析值
-	valStr := valuesPart[valStart+1:valEnd]
-	values := parseValueList(valStr)
-	if len(values) != len(columns) {
-		return protocol.Command{Type: -1}
-	}
-
-	// 将列名和值组合成map
-	valueMap := make(map[string]interface{})
-	for i, col := range columns {
-		valueMap[col] = values[i]
-	}
-
-	return protocol.Command{
-		Type: protocol.Insert,
-		Payload: protocol.InsertPayload{
-			TableName: tableName,
-			Values:    valueMap,
-		},
-	}
-}
-
-// 解析列名列表
-func parseColumnList(colStr string) []string {
-	var columns []string
-	for _, col := range strings.Split(colStr, ",") {
-		col = strings.TrimSpace(col)
-		if col != "" {
-			columns = append(columns, col)
-		}
+	// 打印表头
+	fmt.Println(strings.Repeat("-", calculateTableWidth(columns, widths)))
+	for _, col := range columns {
+		fmt.Printf("| %-*s ", widths[col], col)
 	}
-	return columns
-}
-
-// 解析值列表
-func parseValueList(valStr string) []interface{} {
-	var values []interface{}
-	for _, val := range strings.Split(valStr, ",") {
-		val = strings.TrimSpace(val)
-		if val == "" {
-			continue
-		}
+	fmt.Println("|")
+	fmt.Println(strings.Repeat("-", calculateTableWidth(columns, widths)))
 
-		// 尝试解析为整数
-		if intVal, err := strconv.Atoi(val); err == nil {
-			values = append(values, intVal)
-			continue
+	// 打印数据行
+	for _, row := range rows {
+		for i, col := range columns {
+			fmt.Printf("| %-*s ", widths[col], row[i])
 		}
-
-		// 如果不是整数，去掉引号作为字符串处理
-		strVal := strings.Trim(val, "\"'")
-		values = append(values, strVal)
+		fmt.Println("|")
 	}
-	return values
+	fmt.Println(strings.Repeat("-", calculateTableWidth(columns, widths)))
+	fmt.Printf("共 %d 条记录\n", len(rows))
 }
 
-// 解析 SELECT 命令
-func parseSelect(args []string) protocol.Command {
-	// SELECT * FROM tablename [WHERE condition1=value1 AND condition2=value2]
-	if len(args) < 3 || args[0] != "*" || strings.ToUpper(args[1]) != "FROM" {
-		return protocol.Command{Type: -1}
-	}
-
-	tableName := args[2]
-	conditions := make(map[string]interface{})
-
-	if len(args) > 3 {
-		if strings.ToUpper(args[3]) == "WHERE" {
-			whereConditions := args[4:]
-			for i := 0; i < len(whereConditions); i++ {
-				if strings.ToUpper(whereConditions[i]) == "AND" {
-					continue
-				}
-				parts := strings.Split(whereConditions[i], "=")
-				if len(parts) != 2 {
-					return protocol.Command{Type: -1}
-				}
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				
-				// 尝试解析为整数
-				if intVal, err := strconv.Atoi(value); err == nil {
-					conditions[key] = intVal
-				} else {
-					// 如果不是整数，去掉引号作为字符串处理
-					conditions[key] = strings.Trim(value, "\"'")
-				}
-			}
+// formatValue 将单元格的值格式化为显示文本。数值按原样显示（响应以 UseNumber 解码），
+// json 列的对象和数组显示为紧凑的 JSON 文本，timestamp 和 bytes 列的值本身就是字符串
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
 		}
-	}
-
-	return protocol.Command{
-		Type: protocol.Select,
-		Payload: protocol.SelectPayload{
-			TableName:  tableName,
-			Conditions: conditions,
-		},
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
 	}
 }
 
-// 解析 UPDATE 命令
-func parseUpdate(args []string) protocol.Command {
-	// UPDATE tablename SET column1=value1 [, column2=value2] [WHERE condition1=value1 AND condition2=value2]
-	if len(args) < 4 || strings.ToUpper(args[2]) != "SET" {
-		return protocol.Command{Type: -1}
-	}
-
-	tableName := args[1]
-	values := make(map[string]interface{})
-	conditions := make(map[string]interface{})
-
-	// 找到 WHERE 子句的位置
-	whereIndex := -1
-	for i, arg := range args {
-		if strings.ToUpper(arg) == "WHERE" {
-			whereIndex = i
-			break
-		}
-	}
-
-	// 解析 SET 子
-	setArgs := args[3:]
-	if whereIndex != -1 {
-		setArgs = args[3:whereIndex]
-	}
-
-	// 处理 SET 子句中的赋值
-	for _, arg := range setArgs {
-		if strings.ToUpper(arg) == "," {
-			continue
-		}
-		parts := strings.Split(arg, "=")
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-
-		// 尝试解析为整数
-		if intVal, err := strconv.Atoi(value); err == nil {
-			values[key] = intVal
-		} else {
-			// 如果不是整数，去掉引号作为字符串处理
-			values[key] = strings.Trim(value, "\"'")
-		}
-	}
-
-	// 解析 WHERE 子句
-	if whereIndex != -1 {
-		whereConditions := args[whereIndex+1:]
-		for i := 0; i < len(whereConditions); i++ {
-			if strings.ToUpper(whereConditions[i]) == "AND" {
-				continue
-			}
-			parts := strings.Split(whereConditions[i], "=")
-			if len(parts) != 2 {
-				continue
-			}
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-
-			// 尝试解析为整数
-			if intVal, err := strconv.Atoi(value); err == nil {
-				conditions[key] = intVal
-			} else {
-				// 如果不是整数，去掉引号作为字符串处理
-				conditions[key] = strings.Trim(value, "\"'")
-			}
-		}
-	}
-
-	return protocol.Command{
-		Type: protocol.Update,
-		Payload: protocol.UpdatePayload{
-			TableName:  tableName,
-			Values:    values,
-			Conditions: conditions,
-		},
+func calculateTableWidth(columns []string, widths map[string]int) int {
+	width := 1 // 开始的 |
+	for _, col := range columns {
+		width += widths[col] + 3 // 列宽 + " | "
 	}
+	return width
 }
 
-// 解析 DELETE 命令
-func parseDelete(args []string) protocol.Command {
-	// DELETE FROM tablename [WHERE condition1=value1 AND condition2=value2]
-	if len(args) < 2 || strings.ToUpper(args[0]) != "FROM" {
-		return protocol.Command{Type: -1}
-	}
-
-	tableName := args[1]
-	conditions := make(map[string]interface{})
-
-	// 解析 WHERE 子句
-	whereIndex := -1
-	for i, arg := range args {
-		if strings.ToUpper(arg) == "WHERE" {
-			whereIndex = i
-			break
-		}
-	}
-
-	if whereIndex != -1 {
-		whereConditions := args[whereIndex+1:]
-		for i := 0; i < len(whereConditions); i++ {
-			if strings.ToUpper(whereConditions[i]) == "AND" {
-				continue
-			}
-			parts := strings.Split(whereConditions[i], "=")
-			if len(parts) != 2 {
-				continue
-			}
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-
-			// 尝试解析为整数
-			if intVal, err := strconv.Atoi(value); err == nil {
-				conditions[key] = intVal
-			} else {
-				// 如果不是整数，去掉引号作为字符串处理
-				conditions[key] = strings.Trim(value, "\"'")
-			}
-		}
+// 解析命令字符串为 Command 对象，SQL 语句原样交给服务器解析
+func parseCommand(input string) protocol.Command {
+	if strings.ToUpper(strings.TrimRight(input, "; ")) == "SAVE" {
+		return protocol.Command{Type: protocol.SaveToDisk}
 	}
-
 	return protocol.Command{
-		Type: protocol.Delete,
-		Payload: protocol.DeletePayload{
-			TableName:  tableName,
-			Conditions: conditions,
-		},
-	}
-}
-
-// 添加一个辅助函数来解析值
-func parseValue(value string) interface{} {
-	// 去掉首尾的空白字符
-	value = strings.TrimSpace(value)
-	
-	// 尝试解析为整数
-	if intVal, err := strconv.Atoi(value); err == nil {
-		return intVal
-	}
-	
-	// 如果不是整数，去掉引号作为字符串处理
-	return strings.Trim(value, "\"'")
-}
-
-// 添加一个辅助函数来解析条件
-func parseConditions(args []string) map[string]interface{} {
-	conditions := make(map[string]interface{})
-	for i := 0; i < len(args); i++ {
-		if strings.ToUpper(args[i]) == "AND" {
-			continue
-		}
-		parts := strings.Split(args[i], "=")
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		conditions[key] = parseValue(parts[1])
+		Type:    protocol.ExecSQL,
+		Payload: protocol.ExecSQLPayload{SQL: input},
 	}
-	return conditions
 }
 
 // 打印帮助信息
 func printHelp() {
 	fmt.Println("\n支持的命令格式：")
-	fmt.Println("1. CREATE TABLE tablename (column1 type1, column2 type2, ...)")
-	fmt.Println("   支持的类型：int, string")
-	fmt.Println("2. INSERT INTO tablename (column1, column2, ...) VALUES (value1, value2, ...)")
-	fmt.Println("3. SELECT * FROM tablename [WHERE condition1=value1 AND condition2=value2]")
-	fmt.Println("4. UPDATE tablename SET column1=value1 [, column2=value2] [WHERE condition1=value1]")
-	fmt.Println("5. DELETE FROM tablename [WHERE condition1=value1]")
-	fmt.Println("6. SAVE")
-	fmt.Println("7. EXIT")
+	fmt.Println("1. CREATE TABLE tablename (column1 type1 [NOT NULL] [DEFAULT value] [PRIMARY KEY | UNIQUE] [AUTO_INCREMENT], ...")
+	fmt.Println("   [, PRIMARY KEY (column1, ...)] [, UNIQUE (column1, ...)])")
+	fmt.Println("   支持的类型：int, string, float (double), bool, timestamp, bytes, json；未声明 NOT NULL 的列可以为 NULL")
+	fmt.Println("   timestamp 的值写作 '2024-01-02 15:04:05'、RFC 3339 字符串或 TIMESTAMP '...'，没有时区时按 UTC 处理")
+	fmt.Println("   bytes 的值写作 base64 字符串，json 的值写作 JSON 文本字符串，bool 的值为 TRUE / FALSE")
+	fmt.Println("   AUTO_INCREMENT 的 int 列在插入时省略或为 NULL 则自动生成值")
+	fmt.Println("2. INSERT INTO tablename [(column1, column2, ...)] VALUES (value1, value2, ...)[, (...)]")
+	fmt.Println("   值可以使用 NEXTVAL('sequence') 从序列中取值")
+	fmt.Println("3. SELECT * | column1 [AS alias], ... FROM tablename [[AS] alias]")
+	fmt.Println("   [[INNER | LEFT [OUTER]] JOIN tablename [[AS] alias] ON condition] [WHERE condition]")
+	fmt.Println("   [GROUP BY column1, ...] [HAVING condition]")
+	fmt.Println("   [ORDER BY column1 [ASC|DESC], ...] [LIMIT n] [OFFSET m]")
+	fmt.Println("4. UPDATE tablename SET column1=value1 [, column2=value2] [WHERE condition]")
+	fmt.Println("5. DELETE FROM tablename [WHERE condition]")
+	fmt.Println("   条件支持：= != <> < <= > >=、AND、OR、NOT、括号、IN (...)、BETWEEN ... AND ...、LIKE、IS [NOT] NULL")
+	fmt.Println("   聚合函数：COUNT(*)、COUNT(column)、SUM、AVG、MIN、MAX")
+	fmt.Println("6. DROP TABLE [IF EXISTS] tablename")
+	fmt.Println("7. ALTER TABLE tablename RENAME TO newname")
+	fmt.Println("   ALTER TABLE tablename ADD [COLUMN] column type [NOT NULL] [DEFAULT value]")
+	fmt.Println("   ALTER TABLE tablename DROP [COLUMN] column")
+	fmt.Println("   ALTER TABLE tablename RENAME COLUMN column TO newcolumn")
+	fmt.Println("   ALTER TABLE tablename MODIFY [COLUMN] column type [NOT NULL] [DEFAULT value]")
+	fmt.Println("8. TRUNCATE [TABLE] tablename")
+	fmt.Println("9. CREATE SEQUENCE name [START [WITH] n] [INCREMENT [BY] m]")
+	fmt.Println("   DROP SEQUENCE [IF EXISTS] name")
+	fmt.Println("10. CREATE [UNIQUE] INDEX name ON tablename (column1, ...) [USING HASH | ORDERED]")
+	fmt.Println("    DROP INDEX name ON tablename")
+	fmt.Println("    WHERE 中 column = value 形式的条件会自动使用索引；ORDERED 索引还用于")
+	fmt.Println("    <、<=、>、>=、BETWEEN 范围条件以及 ORDER BY ... LIMIT")
+	fmt.Println("11. BEGIN [TRANSACTION] | START TRANSACTION")
+	fmt.Println("    COMMIT | ROLLBACK")
+	fmt.Println("    SAVEPOINT name | ROLLBACK TO [SAVEPOINT] name | RELEASE [SAVEPOINT] name")
+	fmt.Println("    事务中的查询读取 BEGIN 时的快照，修改在 COMMIT 前对其他连接不可见；")
+	fmt.Println("    修改其他事务正在修改或已经修改过的行时语句立即失败。")
+	fmt.Println("    事务中不能创建、删除或重命名表和序列，也不能修改表结构和索引")
+	fmt.Println("12. SAVE")
+	fmt.Println("    SET AUTOSAVE [= | TO] 'policy' | SHOW AUTOSAVE")
+	fmt.Println("    修改先写入日志，数据文件按自动保存策略写入：'sync' 每次修改后保存，")
+	fmt.Println("    'writes:N' 累计 N 次修改后保存，'interval:T' 每隔 T（如 30s、5m）保存，")
+	fmt.Println("    'shutdown' 只在关闭时保存；没有修改时不写入。启动时的策略由 -autosave 指定")
+	fmt.Println("    BACKUP TO 'file'")
+	fmt.Println("    RESTORE FROM 'file' [TABLES tablename1, ...]")
+	fmt.Println("    备份不阻塞读写，文件不能已经存在；恢复替换同名的表，没有 TABLES 时恢复所有的表和序列")
+	fmt.Println("    'file' 为服务器备份目录（-backup-dir）中的相对路径")
+	fmt.Println("13. EXIT")
 	fmt.Println("\n示例：")
-	fmt.Println("CREATE TABLE users (id int, name string, age int)")
-	fmt.Println("INSERT INTO users (id, name, age) VALUES (1, \"Alice\", 20)")
-	fmt.Println("SELECT * FROM users WHERE age=20")
-	fmt.Println("UPDATE users SET age=21 WHERE name=\"Alice\"")
+	fmt.Println("CREATE TABLE users (id int PRIMARY KEY AUTO_INCREMENT, name string UNIQUE, age int DEFAULT 0)")
+	fmt.Println("INSERT INTO users (name, age) VALUES (\"Alice Smith\", 20), ('Bob', 30)")
+	fmt.Println("CREATE INDEX idx_age ON users (age) USING ORDERED")
+	fmt.Println("CREATE TABLE events (id int AUTO_INCREMENT, at timestamp, score float, ok bool, payload json)")
+	fmt.Println("INSERT INTO events (at, score, ok, payload) VALUES ('2024-01-02 08:00:00+08:00', 1.5, TRUE, '{\"k\": 1}')")
+	fmt.Println("SELECT * FROM events WHERE at >= '2024-01-02' ORDER BY at")
+	fmt.Println("SELECT * FROM users WHERE age >= 20 AND (name LIKE 'A%' OR id IN (2, 3))")
+	fmt.Println("SELECT name, age FROM users ORDER BY age DESC, name LIMIT 10 OFFSET 20")
+	fmt.Println("SELECT age, COUNT(*) AS n FROM users GROUP BY age HAVING COUNT(*) > 1")
+	fmt.Println("SELECT u.name, o.amount FROM users u LEFT JOIN orders o ON u.id = o.user_id")
+	fmt.Println("UPDATE users SET age=21 WHERE name=\"Alice Smith\"")
 	fmt.Println("DELETE FROM users WHERE id=1")
+	fmt.Println("BEGIN; UPDATE accounts SET balance=70 WHERE id=1; UPDATE accounts SET balance=80 WHERE id=2; COMMIT")
 	fmt.Println("SAVE")
+	fmt.Println("SET AUTOSAVE = 'writes:100'")
+	fmt.Println("BACKUP TO 'backup-20240102.json'")
+	fmt.Println("RESTORE FROM 'backup-20240102.json' TABLES users")
 	fmt.Println("")
 }
 
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liubaotong/mem-db/server/db"
+	"github.com/liubaotong/mem-db/server/protocol"
+)
+
+// 自动保存
+//
+// 修改先写入预写日志，数据文件（检查点）按保存策略写入：
+//
+//	sync        每次修改后在回复之前保存
+//	writes:N    累计 N 次修改后在后台保存
+//	interval:T  距上次保存超过 T 且有修改时在后台保存，精确到秒
+//	shutdown    只在关闭服务器时保存
+//
+// 除 shutdown 外，日志超过 -checkpoint-size 时也会保存。没有未保存的修改时不写入文件，
+// 空闲的服务器不会反复重写数据文件
+
+type saveMode int
+
+const (
+	saveSync saveMode = iota
+	saveWrites
+	saveInterval
+	saveShutdown
+)
+
+// savePolicy 是自动保存的策略，writes 和 interval 只在对应的模式中使用
+type savePolicy struct {
+	mode     saveMode
+	writes   uint64
+	interval time.Duration
+}
+
+func (p savePolicy) String() string {
+	switch p.mode {
+	case saveSync:
+		return "sync"
+	case saveWrites:
+		return fmt.Sprintf("writes:%d", p.writes)
+	case saveInterval:
+		return fmt.Sprintf("interval:%s", p.interval)
+	case saveShutdown:
+		return "shutdown"
+	default:
+		return "unknown"
+	}
+}
+
+// parseSavePolicy 解析 sync、writes:N、interval:T 或 shutdown，T 为 Go 的时长格式，如 30s、5m
+func parseSavePolicy(s string) (savePolicy, error) {
+	name, arg, hasArg := strings.Cut(strings.TrimSpace(s), ":")
+	switch strings.ToLower(name) {
+	case "sync":
+		if !hasArg {
+			return savePolicy{mode: saveSync}, nil
+		}
+	case "shutdown":
+		if !hasArg {
+			return savePolicy{mode: saveShutdown}, nil
+		}
+	case "writes":
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil || n == 0 {
+			return savePolicy{}, fmt.Errorf("invalid autosave write count: %q", arg)
+		}
+		return savePolicy{mode: saveWrites, writes: n}, nil
+	case "interval":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return savePolicy{}, fmt.Errorf("invalid autosave interval: %q", arg)
+		}
+		return savePolicy{mode: saveInterval, interval: d}, nil
+	}
+	return savePolicy{}, fmt.Errorf("invalid autosave policy: %s (expected sync, writes:N, interval:T or shutdown)", s)
+}
+
+// autoSaver 按策略把数据库保存到 filename，策略可以在运行中修改
+type autoSaver struct {
+	database *db.Database
+	filename string
+	wake     chan struct{}
+
+	mu     sync.Mutex
+	policy savePolicy
+}
+
+// saver 在 main 中创建，处理修改的函数通过 autoSave 使用它
+var saver *autoSaver
+
+func newAutoSaver(database *db.Database, filename string, policy savePolicy) *autoSaver {
+	return &autoSaver{
+		database: database,
+		filename: filename,
+		wake:     make(chan struct{}, 1),
+		policy:   policy,
+	}
+}
+
+func (s *autoSaver) current() savePolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy
+}
+
+// setPolicy 修改策略，新的策略立即生效
+func (s *autoSaver) setPolicy(policy savePolicy) {
+	s.mu.Lock()
+	s.policy = policy
+	s.mu.Unlock()
+	s.notify()
+}
+
+// notify 唤醒后台的保存，已经有未处理的唤醒时直接返回
+func (s *autoSaver) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// afterWrite 在修改提交之后调用。sync 模式立即保存，writes 模式达到次数时唤醒后台的保存
+func (s *autoSaver) afterWrite() {
+	policy := s.current()
+	switch policy.mode {
+	case saveSync:
+		if err := s.save(); err != nil {
+			log.Printf("Warning: auto-save failed: %v", err)
+		}
+	case saveWrites:
+		if s.database.Unsaved() >= policy.writes {
+			s.notify()
+		}
+	}
+}
+
+// save 在有未保存的修改时执行检查点
+func (s *autoSaver) save() error {
+	if s.database.Unsaved() == 0 {
+		return nil
+	}
+	return s.database.Checkpoint(s.filename)
+}
+
+// run 每秒以及被唤醒时检查是否需要保存
+func (s *autoSaver) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		if !s.due(last) {
+			continue
+		}
+		if err := s.save(); err != nil {
+			log.Printf("Warning: checkpoint failed: %v", err)
+			continue
+		}
+		last = time.Now()
+	}
+}
+
+// due 判断距 last 的上次保存之后是否需要再次保存
+func (s *autoSaver) due(last time.Time) bool {
+	unsaved := s.database.Unsaved()
+	if unsaved == 0 {
+		return false
+	}
+	policy := s.current()
+	switch policy.mode {
+	case saveShutdown:
+		return false
+	case saveWrites:
+		if unsaved >= policy.writes {
+			return true
+		}
+	case saveInterval:
+		if time.Since(last) >= policy.interval {
+			return true
+		}
+	}
+	return s.database.LogSize() >= *checkpointSize
+}
+
+// handleAutoSave 修改自动保存的策略，没有指定策略时只返回当前的策略
+func handleAutoSave(payload interface{}) protocol.Response {
+	autoSavePayload, ok := payload.(protocol.AutoSavePayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+	if autoSavePayload.Policy != "" {
+		policy, err := parseSavePolicy(autoSavePayload.Policy)
+		if err != nil {
+			return protocol.Response{Success: false, Error: err.Error()}
+		}
+		saver.setPolicy(policy)
+		log.Printf("Autosave policy set to %s", policy)
+	}
+	return protocol.Response{
+		Success: true,
+		Data: protocol.AutoSaveStatus{
+			Policy:  saver.current().String(),
+			Unsaved: saver.database.Unsaved(),
+		},
+	}
+}
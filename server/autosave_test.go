@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/liubaotong/mem-db/server/db"
+)
+
+func TestParseSavePolicy(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // 解析后的策略，为空时期望失败
+	}{
+		{"sync", "sync"},
+		{" SHUTDOWN ", "shutdown"},
+		{"writes:100", "writes:100"},
+		{"interval:30s", "interval:30s"},
+		{"Interval:5m", "interval:5m0s"},
+		{"writes:0", ""},
+		{"writes:-1", ""},
+		{"interval:0s", ""},
+		{"interval:soon", ""},
+		{"sync:1", ""},
+		{"never", ""},
+	}
+	for _, tt := range tests {
+		policy, err := parseSavePolicy(tt.input)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("parseSavePolicy(%q) = %s, want error", tt.input, policy)
+			}
+			continue
+		}
+		if err != nil || policy.String() != tt.want {
+			t.Errorf("parseSavePolicy(%q) = %s, %v, want %s", tt.input, policy, err, tt.want)
+		}
+	}
+}
+
+// 没有未保存的修改时任何策略都不保存；writes 按修改次数、interval 按距上次保存的时间保存
+func TestAutoSaverDue(t *testing.T) {
+	database := db.NewDatabase()
+	s := newAutoSaver(database, filepath.Join(t.TempDir(), "database.json"), savePolicy{mode: saveWrites, writes: 2})
+	long := time.Now().Add(-time.Hour)
+	if s.due(long) {
+		t.Error("due without unsaved changes")
+	}
+
+	if err := database.CreateTable("t", []db.Column{{Name: "id", Type: db.TypeInt}}); err != nil {
+		t.Fatal(err)
+	}
+	if s.due(long) {
+		t.Error("writes:2 due after 1 change")
+	}
+	tbl, _ := database.GetTable("t")
+	if _, err := tbl.Insert(map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.due(long) {
+		t.Error("writes:2 not due after 2 changes")
+	}
+
+	s.setPolicy(savePolicy{mode: saveInterval, interval: time.Minute})
+	if s.due(time.Now()) || !s.due(long) {
+		t.Error("interval:1m due at the wrong time")
+	}
+	s.setPolicy(savePolicy{mode: saveShutdown})
+	if s.due(long) {
+		t.Error("shutdown due before shutdown")
+	}
+
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	if n := database.Unsaved(); n != 0 {
+		t.Errorf("%d unsaved changes after save", n)
+	}
+}
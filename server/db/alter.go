@@ -0,0 +1,316 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AddColumn 添加一列，已有的行取该列的默认值
+func (t *Table) AddColumn(col Column) error {
+	if err := t.notInTransaction("ALTER TABLE"); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.noPendingWrites("ALTER TABLE"); err != nil {
+		return err
+	}
+
+	if columnIndex(t.Columns, col.Name) >= 0 {
+		return fmt.Errorf("column %s already exists", col.Name)
+	}
+	columns := append(append(make([]Column, 0, len(t.Columns)+1), t.Columns...), col)
+	if err := validateConstraints(columns, t.Constraints); err != nil {
+		return err
+	}
+	if err := validateAutoIncrement(columns); err != nil {
+		return err
+	}
+	col = columns[len(columns)-1]
+
+	// 已有的行取默认值。自增列的已有的行依次取得自增值，旧版本的行取 NULL
+	counter := t.AutoIncrement
+	vec := newVector(col.Type, t.rows)
+	if col.AutoIncrement {
+		for i := 0; i < t.rows; i++ {
+			if !t.latest(i) {
+				vec.append(nil)
+				continue
+			}
+			counter++
+			vec.append(counter)
+		}
+	} else {
+		if col.Default != nil {
+			value, err := coerceValue(col, col.Default)
+			if err != nil {
+				return fmt.Errorf("column %s: invalid default: %v", col.Name, err)
+			}
+			col.Default = value
+			columns[len(columns)-1].Default = value
+		} else if !col.Nullable && len(t.currentRows(0, nil)) > 0 {
+			return fmt.Errorf("column %s: NOT NULL column needs a default value when the table is not empty", col.Name)
+		}
+		for i := 0; i < t.rows; i++ {
+			vec.append(col.Default)
+		}
+	}
+
+	// 新的列上有唯一约束时，所有行取相同的默认值，多于一行时违反约束
+	row := func(i int) map[string]interface{} {
+		newRow := t.row(i)
+		newRow[col.Name] = vec.get(i)
+		return newRow
+	}
+	keys := keyIndexes(columns, t.Constraints)
+	for _, idx := range keys {
+		if err := idx.build(t.rows, row, t.latest); err != nil {
+			return err
+		}
+	}
+
+	t.Columns = columns
+	t.data = append(t.data, vec)
+	t.keys = keys
+	t.AutoIncrement = counter
+	t.changes++
+	return t.db.logOps(logOp{Op: opAddColumn, Table: t.Name, Column: &col})
+}
+
+// DropColumn 删除一列及其在所有行中的值，表至少要保留一列
+func (t *Table) DropColumn(name string) error {
+	if err := t.notInTransaction("ALTER TABLE"); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.noPendingWrites("ALTER TABLE"); err != nil {
+		return err
+	}
+
+	i := columnIndex(t.Columns, name)
+	if i < 0 {
+		return fmt.Errorf("column %s does not exist", name)
+	}
+	if len(t.Columns) == 1 {
+		return fmt.Errorf("cannot drop the only column of table %s", t.Name)
+	}
+	for _, c := range t.Constraints {
+		for _, colName := range c.Columns {
+			if colName == name {
+				return fmt.Errorf("cannot drop column %s used by %s", name, c)
+			}
+		}
+	}
+	for _, idx := range t.Indexes {
+		for _, colName := range idx.Columns {
+			if colName == name {
+				return fmt.Errorf("cannot drop column %s used by %s", name, idx)
+			}
+		}
+	}
+
+	// 列上声明的主键和唯一约束随列一起删除
+	keys := make([]*Index, 0, len(t.keys))
+	for _, idx := range t.keys {
+		if len(idx.Columns) != 1 || idx.Columns[0] != name {
+			keys = append(keys, idx)
+		}
+	}
+
+	t.Columns = append(t.Columns[:i:i], t.Columns[i+1:]...)
+	t.keys = keys
+	t.data = append(t.data[:i:i], t.data[i+1:]...)
+	t.changes++
+	return t.db.logOps(logOp{Op: opDropColumn, Table: t.Name, Name: name})
+}
+
+// RenameColumn 重命名一列
+func (t *Table) RenameColumn(oldName, newName string) error {
+	if err := t.notInTransaction("ALTER TABLE"); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.noPendingWrites("ALTER TABLE"); err != nil {
+		return err
+	}
+
+	i := columnIndex(t.Columns, oldName)
+	if i < 0 {
+		return fmt.Errorf("column %s does not exist", oldName)
+	}
+	if columnIndex(t.Columns, newName) >= 0 {
+		return fmt.Errorf("column %s already exists", newName)
+	}
+
+	t.Columns[i].Name = newName
+	for _, c := range t.Constraints {
+		for j, colName := range c.Columns {
+			if colName == oldName {
+				c.Columns[j] = newName
+			}
+		}
+	}
+	// 索引中的键只与值有关，只需要修改索引中的列名。
+	// 唯一约束的索引使用约束的列名副本，与 t.Constraints 不共用
+	for _, idx := range t.indexes() {
+		for j, colName := range idx.Columns {
+			if colName == oldName {
+				idx.Columns[j] = newName
+			}
+		}
+	}
+	t.changes++
+	return t.db.logOps(logOp{Op: opRenameColumn, Table: t.Name, Name: oldName, NewName: newName})
+}
+
+// ModifyColumn 用 col 替换同名列的定义（类型、是否可空、默认值），并逐行转换已有的值，
+// 列上原有的主键和唯一约束保留。任何一行无法转换或违反约束时返回错误且表保持不变
+func (t *Table) ModifyColumn(col Column) error {
+	if err := t.notInTransaction("ALTER TABLE"); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.noPendingWrites("ALTER TABLE"); err != nil {
+		return err
+	}
+
+	i := columnIndex(t.Columns, col.Name)
+	if i < 0 {
+		return fmt.Errorf("column %s does not exist", col.Name)
+	}
+	col.PrimaryKey = col.PrimaryKey || t.Columns[i].PrimaryKey
+	col.Unique = col.Unique || t.Columns[i].Unique
+	columns := append(make([]Column, 0, len(t.Columns)), t.Columns...)
+	columns[i] = col
+	if err := validateConstraints(columns, t.Constraints); err != nil {
+		return err
+	}
+	if err := validateAutoIncrement(columns); err != nil {
+		return err
+	}
+	col = columns[i]
+
+	if col.Default != nil {
+		value, err := coerceValue(col, col.Default)
+		if err != nil {
+			return fmt.Errorf("column %s: invalid default: %v", col.Name, err)
+		}
+		col.Default = value
+		columns[i].Default = value
+	}
+
+	// 在副本上转换全部的值，确认都能成功后再替换。
+	// 改为自增列时，计数器从已有的最大值开始，为 NULL 的行生成新值。
+	// 旧版本的行只可能被之前的快照看到，无法转换时取 NULL
+	counter := t.AutoIncrement
+	current := t.currentRows(0, nil)
+	if col.AutoIncrement {
+		for _, j := range current {
+			if value, err := convertValue(t.data[i].get(j), col.Type); err == nil {
+				if n, ok := intValue(value); ok && int(n) > counter {
+					counter = int(n)
+				}
+			}
+		}
+	}
+	vec := newVector(col.Type, t.rows)
+	n := 0
+	for j := 0; j < t.rows; j++ {
+		value, err := convertValue(t.data[i].get(j), col.Type)
+		if !t.latest(j) {
+			if err != nil {
+				value = nil
+			}
+			vec.append(value)
+			continue
+		}
+		n++
+		if err == nil && value == nil && col.AutoIncrement {
+			counter++
+			value = counter
+		}
+		if err == nil && value == nil && !col.Nullable {
+			err = fmt.Errorf("cannot be null")
+		}
+		if err != nil {
+			return fmt.Errorf("column %s, row %d: %v", col.Name, n, err)
+		}
+		vec.append(value)
+	}
+	row := func(j int) map[string]interface{} {
+		newRow := t.row(j)
+		newRow[col.Name] = vec.get(j)
+		return newRow
+	}
+	// 转换后的值可能改变索引的键，重新生成所有索引，同时检查唯一约束
+	keys := keyIndexes(columns, t.Constraints)
+	indexes := make([]*Index, len(t.Indexes))
+	for j, idx := range t.Indexes {
+		indexes[j] = &Index{Name: idx.Name, Columns: idx.Columns, Unique: idx.Unique, Type: idx.Type}
+	}
+	for _, idx := range append(append([]*Index(nil), keys...), indexes...) {
+		if err := idx.build(t.rows, row, t.latest); err != nil {
+			return err
+		}
+	}
+
+	t.Columns = columns
+	t.data[i] = vec
+	t.keys = keys
+	t.Indexes = indexes
+	t.AutoIncrement = counter
+	t.changes++
+	return t.db.logOps(logOp{Op: opModifyColumn, Table: t.Name, Column: &col})
+}
+
+// convertValue 把值转换为指定的列类型，NULL 保持不变。
+// 除 coerceValue 能直接转换的值外，字符串可以解析为 int、float 和 bool，
+// 任何值都可以转换为 string（格式与 FormatValue 相同），bool 与 int 之间按 0、1 转换
+func convertValue(val interface{}, to ColumnType) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+	col := Column{Type: to, Nullable: true}
+	if value, err := coerceValue(col, val); err == nil {
+		return value, nil
+	}
+
+	switch v := val.(type) {
+	case string:
+		text := strings.TrimSpace(v)
+		switch to {
+		case TypeInt:
+			if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return n, nil
+			}
+		case TypeFloat:
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				return coerceValue(col, f)
+			}
+		case TypeBool:
+			if b, err := strconv.ParseBool(text); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot convert %q to %s", v, to)
+	case bool:
+		if to == TypeInt {
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case int64:
+		if to == TypeBool {
+			return v != 0, nil
+		}
+	}
+	if to == TypeString {
+		return FormatValue(val), nil
+	}
+	return nil, fmt.Errorf("cannot convert %v to %s", FormatValue(val), to)
+}
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// 在线备份和恢复
+//
+// 备份是包含所有行的完整快照，与数据文件的格式相同（见 format.go 和 codec.go）：
+// 文件中记录了格式版本、备份时的日志序号、每张表的定义和行数，并带有校验和，
+// 可以用 RESTORE 恢复，也可以直接作为数据文件加载。备份取得映像后在锁外编码，不阻塞读写。
+//
+// 恢复时在锁外读取备份并生成新的表，再在一次提交中替换同名的表，其他连接要么看到原来的表，
+// 要么看到恢复后的表。替换作为一条记录写入日志：先删除原来的表并创建新的表和索引，再插入所有的行
+
+// ArchiveTable 是备份或恢复的一张表及其行数
+type ArchiveTable struct {
+	Name string `json:"name"`
+	Rows int    `json:"rows"`
+}
+
+// ArchiveInfo 是备份或恢复的结果，Tables 按表名排序
+type ArchiveInfo struct {
+	Action    string         `json:"action"` // backup 或 restore
+	File      string         `json:"file"`
+	LSN       uint64         `json:"lsn"`     // 备份包含的最后一条日志记录的序号
+	Created   time.Time      `json:"created"` // 备份的时间
+	Tables    []ArchiveTable `json:"tables"`
+	Sequences []string       `json:"sequences,omitempty"`
+}
+
+// Backup 把已提交的数据备份到 filename，文件已经存在时返回错误
+func (db *Database) Backup(filename string) (*ArchiveInfo, error) {
+	if db.tx != nil {
+		return db.tx.db.Backup(filename)
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return nil, fmt.Errorf("backup file %s already exists", filename)
+	}
+	db.checkpointMu.Lock()
+	options := db.snapshotOptions
+	db.checkpointMu.Unlock()
+
+	img, err := db.capture(false)
+	if err != nil {
+		return nil, err
+	}
+	info := &ArchiveInfo{Action: "backup", File: filename, LSN: img.lsn, Created: time.Now().UTC()}
+	for i := range img.tables {
+		table := &img.tables[i]
+		info.Tables = append(info.Tables, ArchiveTable{Name: table.data.Name, Rows: len(table.visible())})
+	}
+	for _, seq := range img.sequences {
+		info.Sequences = append(info.Sequences, seq.Name)
+	}
+	info.sort()
+	if err := img.write(filename, options); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Restore 从备份 filename 恢复表，替换同名的表，其他的表不受影响。
+// tables 为空时恢复备份中所有的表和序列，否则只恢复指定的表
+func (db *Database) Restore(filename string, tables []string) (*ArchiveInfo, error) {
+	if err := db.notInTransaction("RESTORE"); err != nil {
+		return nil, err
+	}
+	data, err := readDiskData(filename)
+	if err != nil {
+		return nil, err
+	}
+	info := &ArchiveInfo{Action: "restore", File: filename, LSN: data.LSN, Created: data.Updated}
+
+	var selected []TableData
+	var sequences []SequenceData
+	if len(tables) == 0 {
+		for _, tableData := range data.Tables {
+			selected = append(selected, tableData)
+		}
+		for _, seqData := range data.Sequences {
+			sequences = append(sequences, seqData)
+		}
+	} else {
+		seen := make(map[string]bool, len(tables))
+		for _, name := range tables {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			tableData, exists := data.Tables[name]
+			if !exists {
+				return nil, fmt.Errorf("table %s is not in backup %s", name, filename)
+			}
+			selected = append(selected, tableData)
+		}
+	}
+
+	restored := make([]*Table, len(selected))
+	for i, tableData := range selected {
+		if restored[i], err = db.loadTable(tableData); err != nil {
+			return nil, err
+		}
+		info.Tables = append(info.Tables, ArchiveTable{Name: tableData.Name, Rows: len(tableData.Rows)})
+	}
+	for _, seqData := range sequences {
+		info.Sequences = append(info.Sequences, seqData.Name)
+	}
+	info.sort()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var replaced []*Table
+	for _, table := range restored {
+		old, exists := db.tables[table.Name]
+		if !exists {
+			continue
+		}
+		old.mu.Lock()
+		defer old.mu.Unlock()
+		if err := old.noPendingWrites("RESTORE"); err != nil {
+			return nil, err
+		}
+		replaced = append(replaced, old)
+	}
+
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+	if db.log != nil {
+		if err := db.appendLog(restoreOps(db, restored, sequences), time.Now().UTC()); err != nil {
+			return nil, err
+		}
+	}
+	db.modified.Add(1)
+	for _, old := range replaced {
+		old.dropped = true
+	}
+	for _, table := range restored {
+		db.tables[table.Name] = table
+	}
+	for _, seqData := range sequences {
+		db.sequences[seqData.Name] = &Sequence{
+			Name:      seqData.Name,
+			Start:     seqData.Start,
+			Increment: seqData.Increment,
+			Current:   seqData.Current,
+			Used:      seqData.Used,
+		}
+	}
+	return info, nil
+}
+
+// restoreOps 返回恢复写入日志的操作。重放时行的插入在记录的最后统一提交，
+// 表结构的操作都排在插入之前。调用者需要持有 db.mu
+func restoreOps(db *Database, tables []*Table, sequences []SequenceData) []logOp {
+	var ops, inserts []logOp
+	for _, table := range tables {
+		if _, exists := db.tables[table.Name]; exists {
+			ops = append(ops, logOp{Op: opDropTable, Table: table.Name})
+		}
+		ops = append(ops, logOp{Op: opCreateTable, Table: table.Name, Columns: table.Columns, Constraints: table.Constraints})
+		for _, idx := range table.Indexes {
+			ops = append(ops, logOp{Op: opCreateIndex, Table: table.Name, Index: idx})
+		}
+		for i := 0; i < table.rows; i++ {
+			inserts = append(inserts, logOp{Op: opInsert, Table: table.Name, Row: table.row(i)})
+		}
+	}
+	for i := range sequences {
+		seqData := &sequences[i]
+		if _, exists := db.sequences[seqData.Name]; exists {
+			ops = append(ops, logOp{Op: opDropSequence, Name: seqData.Name})
+		}
+		ops = append(ops,
+			logOp{Op: opCreateSequence, Sequence: seqData},
+			logOp{Op: opSetSequence, Sequence: seqData})
+	}
+	return append(ops, inserts...)
+}
+
+func (info *ArchiveInfo) sort() {
+	sort.Slice(info.Tables, func(i, j int) bool { return info.Tables[i].Name < info.Tables[j].Name })
+	sort.Strings(info.Sequences)
+}
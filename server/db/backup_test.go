@@ -0,0 +1,67 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 恢复指定的表只替换这些表，不指定时恢复所有的表和序列；恢复写入日志，重新打开后结果相同
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.json")
+	database := openTestLog(t, filepath.Join(dir, "wal"))
+	tbl := createTestTable(t, database)
+	if err := database.CreateTable("u", []Column{{Name: "x", Type: TypeInt}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateSequence("seq", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	tbl.Insert(map[string]interface{}{"id": 1, "v": 1})
+	database.tables["u"].Insert(map[string]interface{}{"x": 1})
+
+	info, err := database.Backup(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Tables) != 2 || info.Tables[0] != (ArchiveTable{Name: "t", Rows: 1}) || len(info.Sequences) != 1 {
+		t.Errorf("backup info: %+v", info)
+	}
+	if _, err := database.Backup(backup); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("second backup to the same file: %v", err)
+	}
+	want := dump(t, database)
+
+	tbl.Insert(map[string]interface{}{"id": 2})
+	database.tables["u"].Insert(map[string]interface{}{"x": 2})
+	database.NextVal("seq")
+	if _, err := database.Restore(backup, []string{"t"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := values(t, database); len(got) != 1 || got[1] != int64(1) {
+		t.Errorf("table t after restoring it: %v", got)
+	}
+	if n := len(database.tables["u"].Select(nil)); n != 2 {
+		t.Errorf("table u has %d rows after restoring only t, want 2", n)
+	}
+	if _, err := tbl.Insert(map[string]interface{}{"id": 3}); err == nil {
+		t.Error("insert through the replaced table succeeded")
+	}
+	if _, err := database.Restore(backup, []string{"missing"}); err == nil || !strings.Contains(err.Error(), "not in backup") {
+		t.Errorf("restore of a missing table: %v", err)
+	}
+
+	if _, err := database.Restore(backup, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := dump(t, database); got != want {
+		t.Errorf("after restoring everything\n%s\nwant\n%s", got, want)
+	}
+	database.CloseLog()
+
+	reopened := openTestLog(t, filepath.Join(dir, "wal"))
+	if got := dump(t, reopened); got != want {
+		t.Errorf("after replay\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 增量检查点
+//
+// 检查点写入的数据文件只是清单：表的定义、自增计数器、索引和序列保存在清单中，
+// 每张表的行保存在数据文件旁的目录（数据文件名加 .tables）中单独的文件里，清单记录文件名。
+// 表的行自上一次检查点以来没有改变时沿用原来的文件，只有修改过的表才重新编码。
+// 表文件与完整的快照格式相同，只包含一张表，按配置的格式编码；清单总是 JSON。
+//
+// 映像在锁内取得，编码和写入都在锁外进行，检查点期间写入不会被阻塞。
+// 清单和表文件都先写入临时文件再重命名，清单替换后才删除新旧两个清单都不再引用的表文件
+
+const tableFileExt = ".tbl"
+
+// tableFile 是表最近一次检查点写入的文件，changes 为写入时表的修改计数
+type tableFile struct {
+	name    string
+	changes uint64
+	rows    int
+}
+
+// tableDir 返回存放数据文件 filename 的表文件的目录，数据文件和上一个快照使用同一个目录
+func tableDir(filename string) string {
+	return strings.TrimSuffix(filename, prevSuffix) + ".tables"
+}
+
+// Unsaved 返回最近一次检查点之后的修改次数，为 0 时数据文件与内存中的数据相同
+func (db *Database) Unsaved() uint64 {
+	if db.tx != nil {
+		return db.tx.db.Unsaved()
+	}
+	return db.modified.Load() - db.saved.Load()
+}
+
+// Checkpoint 保存快照并删除不再需要的日志，没有打开日志时只保存快照。
+// 上一个快照之后的日志仍然保留，新的快照损坏时可以从上一个快照恢复
+func (db *Database) Checkpoint(filename string) error {
+	if db.tx != nil {
+		return db.tx.db.Checkpoint(filename)
+	}
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+
+	img, err := db.capture(db.log != nil)
+	if err != nil {
+		return err
+	}
+	dir := tableDir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	manifest := img.header()
+	files := make([]tableFile, len(img.tables))
+	referenced := make(map[string]bool, len(img.tables))
+	for i := range img.tables {
+		table := &img.tables[i]
+		file := table.state.saved
+		if file.name == "" || file.changes != table.changes {
+			if file, err = table.save(img, dir, i, db.snapshotOptions); err != nil {
+				return err
+			}
+		}
+		files[i] = file
+		referenced[file.name] = true
+
+		data := table.data
+		data.File, data.RowCount = file.name, file.rows
+		manifest.Tables[data.Name] = data
+	}
+	err = writeSnapshot(filename, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(manifest)
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, table := range img.tables {
+		table.state.saved = files[i]
+	}
+	// 上一个清单成为 .prev 文件，它引用的表文件也要保留
+	keep := make(map[string]bool, len(referenced)+len(db.snapshotFiles))
+	for name := range referenced {
+		keep[name] = true
+	}
+	for name := range db.snapshotFiles {
+		keep[name] = true
+	}
+	db.snapshotFiles = referenced
+	if err := removeTableFiles(dir, keep); err != nil {
+		return err
+	}
+
+	db.saved.Store(img.modified)
+	previous := db.snapshotLSN
+	db.snapshotLSN = img.lsn
+	if db.log != nil {
+		return db.log.removeBefore(previous + 1)
+	}
+	return nil
+}
+
+// save 把表写入新的表文件。文件名包含写入的时间，不会与已有的文件相同
+func (t *tableImage) save(img *image, dir string, i int, options SnapshotOptions) (tableFile, error) {
+	name := fmt.Sprintf("%d-%d%s", time.Now().UnixNano(), i, tableFileExt)
+	single := &image{lsn: img.lsn, created: img.created, tables: []tableImage{*t}}
+	err := writeSnapshot(filepath.Join(dir, name), func(w io.Writer) error {
+		return single.encode(w, options)
+	})
+	if err != nil {
+		return tableFile{}, err
+	}
+	return tableFile{name: name, changes: t.changes, rows: len(t.visible())}, nil
+}
+
+// removeTableFiles 删除目录中没有被引用的表文件，以及崩溃时留下的临时文件
+func removeTableFiles(dir string, referenced map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if referenced[name] || !(strings.HasSuffix(name, tableFileExt) || strings.HasSuffix(name, tableFileExt+".tmp")) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTableFile 读取表文件中唯一的一张表
+func readTableFile(path string) (TableData, error) {
+	data, err := readDiskData(path)
+	if err != nil {
+		return TableData{}, err
+	}
+	if len(data.Tables) != 1 {
+		return TableData{}, fmt.Errorf("%s: expected 1 table, found %d", path, len(data.Tables))
+	}
+	for _, table := range data.Tables {
+		return table, nil
+	}
+	return TableData{}, nil
+}
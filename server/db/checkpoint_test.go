@@ -0,0 +1,163 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tableFiles 返回数据文件 filename 的表文件目录中所有的文件名
+func tableFiles(t *testing.T, filename string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(tableDir(filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 检查点只重写修改过的表，保留当前和上一个清单引用的表文件，删除其余的文件
+func TestCheckpointRetention(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "database.json")
+	database := openTestLog(t, filepath.Join(dir, "wal"))
+	tbl := createTestTable(t, database)
+	if err := database.CreateTable("u", []Column{{Name: "x", Type: TypeInt}}); err != nil {
+		t.Fatal(err)
+	}
+	u := database.tables["u"]
+	u.Insert(map[string]interface{}{"x": 1})
+
+	steps := []struct {
+		name   string
+		change func()
+		files  int
+		reused []string // 沿用上一次检查点的文件的表
+	}{
+		{"first", func() { tbl.Insert(map[string]interface{}{"id": 1}) }, 2, nil},
+		{"one table changed", func() { tbl.Insert(map[string]interface{}{"id": 2}) }, 3, []string{"u"}},
+		{"oldest file released", func() { tbl.Update(byID(2), map[string]interface{}{"v": 5}) }, 3, []string{"u"}},
+		{"nothing changed", func() {}, 2, []string{"t", "u"}},
+	}
+	// 崩溃时留下的临时文件由第一次检查点删除
+	if err := os.MkdirAll(tableDir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tableDir(filename), "crashed"+tableFileExt+".tmp"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous := map[string]string{}
+	for _, step := range steps {
+		step.change()
+		if err := database.Checkpoint(filename); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		files := tableFiles(t, filename)
+		if len(files) != step.files {
+			t.Errorf("%s: table files %v, want %d", step.name, files, step.files)
+		}
+		current := map[string]string{"t": tbl.saved.name, "u": u.saved.name}
+		for name, file := range current {
+			reused := previous[name] == file
+			want := false
+			for _, r := range step.reused {
+				want = want || r == name
+			}
+			if reused != want {
+				t.Errorf("%s: table %s reused file = %v, want %v", step.name, name, reused, want)
+			}
+		}
+		previous = current
+	}
+
+	want := dump(t, database)
+	database.CloseLog()
+	tests := []struct {
+		name    string
+		corrupt bool
+	}{
+		{"current snapshot", false},
+		{"previous snapshot and log", true},
+	}
+	for _, tt := range tests {
+		if tt.corrupt {
+			// 校验和不再匹配，加载时改用上一个快照，再从日志重放之后的修改
+			content, _ := os.ReadFile(filename)
+			os.WriteFile(filename, []byte(strings.Replace(string(content), "\"t\"", "\"T\"", 1)), 0644)
+		}
+		loaded := NewDatabase()
+		if err := loaded.LoadFromDisk(filename); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := loaded.OpenLog(filepath.Join(dir, "wal"), LogOptions{}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := dump(t, loaded); got != want {
+			t.Errorf("%s: loaded\n%s\nwant\n%s", tt.name, got, want)
+		}
+		loaded.CloseLog()
+	}
+}
+
+// 提交的修改、表结构和序列的修改计入未保存的修改，失败的语句不计入；
+// 启动时加载数据文件后没有未保存的修改，重放了日志或运行中加载文件时有
+func TestUnsaved(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "database.json")
+	database := openTestLog(t, filepath.Join(dir, "wal"))
+	tbl := createTestTable(t, database)
+	check := func(step string, want uint64) {
+		t.Helper()
+		if got := database.Unsaved(); got != want {
+			t.Errorf("%s: %d unsaved changes, want %d", step, got, want)
+		}
+	}
+	check("create table", 1)
+	tbl.Insert(map[string]interface{}{"id": 1})
+	tbl.Insert(map[string]interface{}{"id": 1})
+	check("insert and duplicate insert", 2)
+	if err := tbl.AddColumn(Column{Name: "w", Type: TypeInt, Nullable: true}); err != nil {
+		t.Fatal(err)
+	}
+	check("add column", 3)
+	if err := database.Checkpoint(filename); err != nil {
+		t.Fatal(err)
+	}
+	check("checkpoint", 0)
+	if err := tbl.Update(byID(1), map[string]interface{}{"v": 5}); err != nil {
+		t.Fatal(err)
+	}
+	check("update", 1)
+	database.CloseLog()
+
+	loaded := NewDatabase()
+	if err := loaded.LoadFromDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	if n := loaded.Unsaved(); n != 0 {
+		t.Errorf("startup load: %d unsaved changes, want 0", n)
+	}
+	if err := loaded.OpenLog(filepath.Join(dir, "wal"), LogOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.CloseLog()
+	if loaded.Unsaved() == 0 {
+		t.Error("no unsaved changes after replay")
+	}
+	if err := loaded.Checkpoint(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.LoadFromDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Unsaved() == 0 {
+		t.Error("no unsaved changes after load while running")
+	}
+}
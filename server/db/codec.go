@@ -0,0 +1,365 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 快照的编码
+//
+// 快照可以编码为 JSON 或二进制格式，并可以用 gzip 压缩，加载时根据文件头自动识别。
+// 二进制格式的内容：
+//
+//	"MEMDBBIN"    8 字节魔数
+//	头部          uvarint 长度 + JSON 编码的 diskData，其中的表没有行
+//	每张表的行    按表名排序，每一列依次是 NULL 位图（每行一位）和非 NULL 的值
+//
+// 值按列类型编码：int 和 timestamp（UTC 纳秒）为 varint，float 为 8 字节小端序，
+// bool 为 1 字节，string、bytes 和 json 为 uvarint 长度 + 内容
+
+// SnapshotFormat 是快照的编码格式
+type SnapshotFormat int
+
+const (
+	FormatJSON   SnapshotFormat = iota // 便于阅读和手工修改
+	FormatBinary                       // 文件更小，编码和加载更快
+)
+
+func (f SnapshotFormat) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatBinary:
+		return "binary"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSnapshotFormat 将名称转换为快照格式
+func ParseSnapshotFormat(name string) (SnapshotFormat, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return FormatJSON, nil
+	case "binary":
+		return FormatBinary, nil
+	default:
+		return 0, fmt.Errorf("invalid snapshot format: %s", name)
+	}
+}
+
+// Compression 是快照的压缩方式
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip             // 使用最快的压缩级别
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseCompression 将名称转换为压缩方式
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	default:
+		return 0, fmt.Errorf("invalid compression: %s", name)
+	}
+}
+
+// SnapshotOptions 决定保存快照使用的格式和压缩方式，默认为不压缩的 JSON
+type SnapshotOptions struct {
+	Format      SnapshotFormat
+	Compression Compression
+}
+
+// SetSnapshotOptions 设置之后保存快照使用的格式，已有的快照不受影响
+func (db *Database) SetSnapshotOptions(options SnapshotOptions) {
+	if db.tx != nil {
+		db.tx.db.SetSnapshotOptions(options)
+		return
+	}
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
+	db.snapshotOptions = options
+}
+
+var (
+	binaryMagic = []byte("MEMDBBIN")
+	gzipMagic   = []byte{0x1f, 0x8b}
+)
+
+// encode 按 options 编码映像
+func (img *image) encode(w io.Writer, options SnapshotOptions) error {
+	if options.Compression == CompressionGzip {
+		zw, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+		if err != nil {
+			return err
+		}
+		if err := img.encode(zw, SnapshotOptions{Format: options.Format}); err != nil {
+			return err
+		}
+		return zw.Close()
+	}
+
+	data := img.header()
+	if options.Format == FormatJSON {
+		for i := range img.tables {
+			table := &img.tables[i]
+			data.Tables[table.data.Name] = table.tableData()
+		}
+		return json.NewEncoder(w).Encode(data)
+	}
+
+	// 行数写在头部，先找出每张表可见的行
+	tables := make(map[string]*tableImage, len(img.tables))
+	for i := range img.tables {
+		table := &img.tables[i]
+		tables[table.data.Name] = table
+		row := table.data
+		row.RowCount = len(table.visible())
+		data.Tables[row.Name] = row
+	}
+	header, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	bw := &binaryWriter{w: bufio.NewWriter(w)}
+	bw.w.Write(binaryMagic)
+	bw.uvarint(uint64(len(header)))
+	bw.w.Write(header)
+	for _, name := range sortedTableNames(data.Tables) {
+		table := tables[name]
+		for _, vec := range table.view.data {
+			bw.vector(vec, table.visible())
+		}
+	}
+	return bw.w.Flush()
+}
+
+// header 返回没有行的数据文件内容
+func (img *image) header() diskData {
+	data := diskData{
+		Checksum:  true,
+		Version:   formatVersion,
+		Created:   img.created,
+		Updated:   time.Now().UTC(),
+		LSN:       img.lsn,
+		Tables:    make(map[string]TableData),
+		Sequences: make(map[string]SequenceData),
+	}
+	for _, seq := range img.sequences {
+		data.Sequences[seq.Name] = seq
+	}
+	return data
+}
+
+func sortedTableNames(tables map[string]TableData) []string {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// binaryWriter 写入二进制格式，写入错误由最后的 Flush 返回
+type binaryWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (bw *binaryWriter) uvarint(x uint64) {
+	bw.w.Write(bw.buf[:binary.PutUvarint(bw.buf[:], x)])
+}
+
+func (bw *binaryWriter) varint(x int64) {
+	bw.w.Write(bw.buf[:binary.PutVarint(bw.buf[:], x)])
+}
+
+// vector 写入一列中 positions 所在行的值
+func (bw *binaryWriter) vector(vec *vector, positions []int) {
+	nulls := make([]byte, (len(positions)+7)/8)
+	for j, i := range positions {
+		if vec.isNull(i) {
+			nulls[j/8] |= 1 << (j % 8)
+		}
+	}
+	bw.w.Write(nulls)
+
+	for _, i := range positions {
+		if vec.isNull(i) {
+			continue
+		}
+		switch vec.typ {
+		case TypeInt, TypeTimestamp:
+			bw.varint(vec.ints[i])
+		case TypeFloat:
+			binary.LittleEndian.PutUint64(bw.buf[:8], math.Float64bits(vec.floats[i]))
+			bw.w.Write(bw.buf[:8])
+		case TypeBool:
+			if vec.bools[i] {
+				bw.w.WriteByte(1)
+			} else {
+				bw.w.WriteByte(0)
+			}
+		case TypeString, TypeBytes, TypeJSON:
+			bw.uvarint(uint64(len(vec.strs[i])))
+			bw.w.WriteString(vec.strs[i])
+		}
+	}
+}
+
+// decompress 解压 gzip 压缩的快照，没有压缩时原样返回
+func decompress(content []byte) ([]byte, error) {
+	if !bytes.HasPrefix(content, gzipMagic) {
+		return content, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// decodeBinary 解析二进制格式的快照，行的值为各列类型的规范值
+func decodeBinary(content []byte) (*diskData, error) {
+	br := &binaryReader{buf: content[len(binaryMagic):]}
+	n := br.uvarint()
+	header := br.bytes(n)
+	if br.err != nil {
+		return nil, br.err
+	}
+	data := &diskData{}
+	if err := unmarshalNumbers(header, data); err != nil {
+		return nil, err
+	}
+	if data.Version > formatVersion {
+		return data, nil
+	}
+
+	for _, name := range sortedTableNames(data.Tables) {
+		table := data.Tables[name]
+		table.Rows = make([]map[string]interface{}, table.RowCount)
+		for j := range table.Rows {
+			table.Rows[j] = make(map[string]interface{}, len(table.Columns))
+		}
+		for _, col := range table.Columns {
+			if err := br.column(col, table.Rows); err != nil {
+				return nil, fmt.Errorf("table %s: column %s: %v", name, col.Name, err)
+			}
+		}
+		data.Tables[name] = table
+	}
+	if len(br.buf) != 0 {
+		return nil, fmt.Errorf("unexpected data after tables")
+	}
+	return data, nil
+}
+
+// binaryReader 读取二进制格式，出错后的读取都返回零值，错误记录在 err 中
+type binaryReader struct {
+	buf []byte
+	err error
+}
+
+var errTruncated = fmt.Errorf("unexpected end of snapshot")
+
+func (br *binaryReader) uvarint() uint64 {
+	if br.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(br.buf)
+	if n <= 0 {
+		br.err = errTruncated
+		return 0
+	}
+	br.buf = br.buf[n:]
+	return x
+}
+
+func (br *binaryReader) varint() int64 {
+	if br.err != nil {
+		return 0
+	}
+	x, n := binary.Varint(br.buf)
+	if n <= 0 {
+		br.err = errTruncated
+		return 0
+	}
+	br.buf = br.buf[n:]
+	return x
+}
+
+func (br *binaryReader) bytes(n uint64) []byte {
+	if br.err != nil {
+		return nil
+	}
+	if uint64(len(br.buf)) < n {
+		br.err = errTruncated
+		return nil
+	}
+	b := br.buf[:n:n]
+	br.buf = br.buf[n:]
+	return b
+}
+
+// column 读取一列的值写入 rows
+func (br *binaryReader) column(col Column, rows []map[string]interface{}) error {
+	nulls := br.bytes(uint64((len(rows) + 7) / 8))
+	for j, row := range rows {
+		if br.err != nil {
+			return br.err
+		}
+		if nulls[j/8]&(1<<(j%8)) != 0 {
+			row[col.Name] = nil
+			continue
+		}
+		switch col.Type {
+		case TypeInt:
+			row[col.Name] = br.varint()
+		case TypeTimestamp:
+			row[col.Name] = time.Unix(0, br.varint()).UTC()
+		case TypeFloat:
+			if b := br.bytes(8); b != nil {
+				row[col.Name] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			}
+		case TypeBool:
+			if b := br.bytes(1); b != nil {
+				row[col.Name] = b[0] != 0
+			}
+		case TypeString:
+			row[col.Name] = string(br.bytes(br.uvarint()))
+		case TypeBytes:
+			row[col.Name] = append([]byte(nil), br.bytes(br.uvarint())...)
+		case TypeJSON:
+			row[col.Name] = JSON(br.bytes(br.uvarint()))
+		default:
+			return fmt.Errorf("unsupported column type: %v", col.Type)
+		}
+	}
+	return br.err
+}
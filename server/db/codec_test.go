@@ -0,0 +1,159 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// newCodecDatabase 返回包含所有列类型、NULL、已删除的行和序列的数据库
+func newCodecDatabase(t *testing.T) *Database {
+	t.Helper()
+	database := NewDatabase()
+	columns := []Column{
+		{Name: "id", Type: TypeInt, PrimaryKey: true, AutoIncrement: true},
+		{Name: "s", Type: TypeString, Nullable: true},
+		{Name: "f", Type: TypeFloat, Nullable: true},
+		{Name: "b", Type: TypeBool, Nullable: true},
+		{Name: "ts", Type: TypeTimestamp, Nullable: true},
+		{Name: "raw", Type: TypeBytes, Nullable: true},
+		{Name: "doc", Type: TypeJSON, Nullable: true},
+	}
+	if err := database.CreateTable("all", columns, Constraint{Columns: []string{"s", "f"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateTable("empty", []Column{{Name: "x", Type: TypeInt}}); err != nil {
+		t.Fatal(err)
+	}
+	tbl, _ := database.GetTable("all")
+	if err := tbl.CreateIndex("by_f", []string{"f"}, false, IndexOrdered); err != nil {
+		t.Fatal(err)
+	}
+	_, err := tbl.InsertRows([]map[string]interface{}{
+		{"s": "héllo\n", "f": -1.5, "b": true, "ts": "2024-02-29 12:34:56.789", "raw": []byte{0, 1, 255}, "doc": `{"a":[1,2.5,"x",null]}`},
+		{"id": int64(1)<<53 + 1, "s": "", "f": math.SmallestNonzeroFloat64, "b": false, "ts": "1969-12-31 23:59:59", "raw": []byte{}, "doc": "123456789012345678"},
+		{"doc": `"text"`},
+		{},
+		{"s": "deleted"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tbl.Delete(func(row map[string]interface{}) (bool, error) { return row["s"] == "deleted", nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateSequence("seq", 10, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.NextVal("seq"); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+// dump 返回数据库中所有表的定义、行和序列 seq 的 JSON 编码，用于比较两个数据库的内容
+func dump(t *testing.T, database *Database) string {
+	t.Helper()
+	names := make([]string, 0, len(database.tables))
+	for name := range database.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out []interface{}
+	for _, name := range names {
+		tbl := database.tables[name]
+		rows := tbl.Select(nil)
+		sort.Slice(rows, func(i, j int) bool {
+			a, _ := json.Marshal(rows[i])
+			b, _ := json.Marshal(rows[j])
+			return bytes.Compare(a, b) < 0
+		})
+		out = append(out, tbl.Name, tbl.Columns, tbl.Constraints, tbl.AutoIncrement, tbl.Indexes, rows)
+	}
+	if seq, ok := database.sequences["seq"]; ok {
+		out = append(out, seq.data())
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	tests := []struct {
+		options SnapshotOptions
+		magic   []byte
+	}{
+		{SnapshotOptions{Format: FormatJSON}, []byte("{")},
+		{SnapshotOptions{Format: FormatBinary}, binaryMagic},
+		{SnapshotOptions{Format: FormatJSON, Compression: CompressionGzip}, gzipMagic},
+		{SnapshotOptions{Format: FormatBinary, Compression: CompressionGzip}, gzipMagic},
+	}
+	database := newCodecDatabase(t)
+	want := dump(t, database)
+	for _, tt := range tests {
+		name := tt.options.Format.String() + "/" + tt.options.Compression.String()
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "database.json")
+			database.SetSnapshotOptions(tt.options)
+			if err := database.SaveToDisk(filename); err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(content, tt.magic) {
+				t.Errorf("file starts with %q, want %q", content[:8], tt.magic)
+			}
+			// 每种格式都记录了写入校验和，缺少校验和时视为损坏
+			if data, err := readDiskData(filename); err != nil || !data.Checksum {
+				t.Errorf("checksum marker not saved: %v", err)
+			}
+
+			loaded := NewDatabase()
+			if err := loaded.LoadFromDisk(filename); err != nil {
+				t.Fatal(err)
+			}
+			if got := dump(t, loaded); got != want {
+				t.Errorf("loaded\n%s\nwant\n%s", got, want)
+			}
+			// 加载后索引和约束仍然可用
+			tbl, _ := loaded.GetTable("all")
+			if _, err := tbl.Insert(map[string]interface{}{"s": "héllo\n", "f": -1.5}); err == nil {
+				t.Error("unique constraint not enforced after loading")
+			}
+		})
+	}
+}
+
+// 二进制快照被截断或内容损坏时加载失败，不会得到不完整的数据
+func TestDecodeBinaryErrors(t *testing.T) {
+	database := newCodecDatabase(t)
+	database.SetSnapshotOptions(SnapshotOptions{Format: FormatBinary})
+	img, err := database.capture(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := img.encode(&buf, SnapshotOptions{Format: FormatBinary}); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+	if _, err := decodeDiskData(content); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{len(binaryMagic) + 1, len(content) / 2, len(content) - 1} {
+		if _, err := decodeDiskData(content[:n]); err == nil {
+			t.Errorf("decoded a snapshot truncated to %d of %d bytes", n, len(content))
+		}
+	}
+	if _, err := decodeDiskData(append(append([]byte{}, content...), 0)); err == nil {
+		t.Error("decoded a snapshot with trailing data")
+	}
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Constraint 是表级的唯一约束，Primary 为 true 时为主键。
+// 单列约束直接记录在 Column 的 PrimaryKey、Unique 上
+type Constraint struct {
+	Primary bool     `json:"primary,omitempty"`
+	Columns []string `json:"columns"`
+}
+
+func (c Constraint) String() string {
+	kind := "unique key"
+	if c.Primary {
+		kind = "primary key"
+	}
+	return fmt.Sprintf("%s (%s)", kind, strings.Join(c.Columns, ", "))
+}
+
+// ConstraintError 表示写入的数据违反了主键或唯一约束
+type ConstraintError struct {
+	Constraint Constraint
+	Key        string // 重复的键值，JSON 编码
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("duplicate value %s for %s", e.Key, e.Constraint)
+}
+
+// validateConstraints 检查约束引用的列是否存在，表最多只能有一个主键，
+// 并把主键列设为 NOT NULL
+func validateConstraints(columns []Column, constraints []Constraint) error {
+	primaryKeys := 0
+	for _, col := range columns {
+		if col.PrimaryKey {
+			primaryKeys++
+		}
+	}
+	for _, c := range constraints {
+		if len(c.Columns) == 0 {
+			return fmt.Errorf("constraint must have at least one column")
+		}
+		if c.Primary {
+			primaryKeys++
+		}
+		for _, name := range c.Columns {
+			if columnIndex(columns, name) < 0 {
+				return fmt.Errorf("%s: column %s does not exist", c, name)
+			}
+		}
+	}
+	if primaryKeys > 1 {
+		return fmt.Errorf("multiple primary keys defined")
+	}
+
+	for i, col := range columns {
+		if col.PrimaryKey {
+			columns[i].Nullable = false
+		}
+	}
+	for _, c := range constraints {
+		if !c.Primary {
+			continue
+		}
+		for _, name := range c.Columns {
+			columns[columnIndex(columns, name)].Nullable = false
+		}
+	}
+	return nil
+}
+
+// uniqueKeys 返回全部唯一约束，包括列上声明的单列约束
+func uniqueKeys(columns []Column, constraints []Constraint) []Constraint {
+	keys := make([]Constraint, 0)
+	for _, col := range columns {
+		if col.PrimaryKey || col.Unique {
+			keys = append(keys, Constraint{Primary: col.PrimaryKey, Columns: []string{col.Name}})
+		}
+	}
+	return append(keys, constraints...)
+}
+
+// keyIndexes 为每个唯一约束生成空的哈希索引，写入时在索引中查找相同的键，不需要扫描所有的行。
+// 约束的索引不保存，与 CREATE INDEX 创建的索引一样在加载和修改列之后重新生成。
+// 含有 NULL 的键不加入索引，因此唯一列可以有多个 NULL
+func keyIndexes(columns []Column, constraints []Constraint) []*Index {
+	keys := uniqueKeys(columns, constraints)
+	indexes := make([]*Index, len(keys))
+	for i := range keys {
+		key := &keys[i]
+		key.Columns = append([]string(nil), key.Columns...)
+		indexes[i] = &Index{Columns: key.Columns, Unique: true, Type: IndexHash, constraint: key}
+		indexes[i].clear()
+	}
+	return indexes
+}
+
+// uniqueKey 计算行在约束列上的键。JSON 编码使 int 与 JSON 解码得到的 float64 得到相同的键
+func uniqueKey(row map[string]interface{}, columns []string) (string, bool) {
+	values := make([]interface{}, len(columns))
+	for i, name := range columns {
+		if row[name] == nil {
+			return "", false
+		}
+		values[i] = row[name]
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func columnIndex(columns []Column, name string) int {
+	for i, col := range columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,59 +1,198 @@
 package db
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type ColumnType int
 
+// 列类型的值会保存在数据文件中，新的类型只能添加在末尾
 const (
 	TypeInt ColumnType = iota
 	TypeString
+	TypeFloat     // 64 位浮点数
+	TypeBool      // 布尔值
+	TypeTimestamp // 时间点，统一转换为 UTC 保存
+	TypeBytes     // 二进制数据，JSON 中以 base64 字符串表示
+	TypeJSON      // JSON 文档
 )
 
+// String 方法用于将列类型转换为类型名
+func (ct ColumnType) String() string {
+	switch ct {
+	case TypeInt:
+		return "int"
+	case TypeString:
+		return "string"
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeTimestamp:
+		return "timestamp"
+	case TypeBytes:
+		return "bytes"
+	case TypeJSON:
+		return "json"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseColumnType 将类型名转换为列类型，double 与 float 相同，boolean 与 bool 相同
+func ParseColumnType(name string) (ColumnType, error) {
+	switch strings.ToLower(name) {
+	case "int":
+		return TypeInt, nil
+	case "string":
+		return TypeString, nil
+	case "float", "double":
+		return TypeFloat, nil
+	case "bool", "boolean":
+		return TypeBool, nil
+	case "timestamp":
+		return TypeTimestamp, nil
+	case "bytes":
+		return TypeBytes, nil
+	case "json":
+		return TypeJSON, nil
+	default:
+		return 0, fmt.Errorf("invalid column type: %s", name)
+	}
+}
+
+// Column 是列定义，Nullable 为 false 的列不能为 NULL，
+// Default 为 INSERT 省略该列时使用的值，为 nil 时表示 NULL。
+// PrimaryKey、Unique 为列上声明的单列约束。
+// AutoIncrement 的列在 INSERT 省略或给出 NULL 时由表的计数器生成值
 type Column struct {
-	Name string     `json:"name"`
-	Type ColumnType `json:"type"`
+	Name          string      `json:"name"`
+	Type          ColumnType  `json:"type"`
+	Nullable      bool        `json:"nullable,omitempty"`
+	Default       interface{} `json:"default,omitempty"`
+	PrimaryKey    bool        `json:"primary_key,omitempty"`
+	Unique        bool        `json:"unique,omitempty"`
+	AutoIncrement bool        `json:"auto_increment,omitempty"`
 }
 
+// Table 是表的句柄，表的数据保存在 tableState 中。
+// 数据库中的句柄不属于任何事务，每次修改自动提交；
+// 事务视图的 GetTable 返回绑定到事务的句柄，与数据库中的句柄共享同一份数据
 type Table struct {
-	Name    string                   `json:"name"`
-	Columns []Column                 `json:"columns"`
-	Rows    []map[string]interface{} `json:"rows"`
-	mu      sync.RWMutex            `json:"-"`
+	*tableState
+	tx *Tx
+}
+
+// tableState 的 AutoIncrement 为自增列已经使用过的最大值，Indexes 为 CREATE INDEX 创建的索引。
+// 行数据按列存储，data[i] 保存第 i 列的值，rows 为行的版本数，
+// xmin、xmax 为每个版本的创建和删除时间，见 mvcc.go
+type tableState struct {
+	Name          string       `json:"name"`
+	Columns       []Column     `json:"columns"`
+	Constraints   []Constraint `json:"constraints,omitempty"`
+	AutoIncrement int          `json:"auto_increment,omitempty"`
+	Indexes       []*Index     `json:"indexes,omitempty"`
+	keys          []*Index     // 唯一约束的索引，见 keyIndexes
+	data          []*vector
+	rows          int
+	xmin          stamps
+	xmax          stamps
+	db            *Database
+	writers       int          // 在表上有未提交写入的事务数，不为 0 时不回收旧版本
+	garbage       int          // 失效但还没有回收的版本数
+	horizon       uint64       // 上次回收时的界限
+	dropped       bool         // 表已经删除，之前取得的句柄不能再写入
+	created       time.Time    // 创建时间
+	updated       time.Time    // 最后一次提交修改数据的时间，由数据库的 commitMu 保护
+	changes       uint64       // 行或列改变的次数，提交时在 commitMu 中增加，修改列时在写锁中增加
+	saved         tableFile    // 最近一次检查点写入的表文件，由数据库的 checkpointMu 保护
+	mu            sync.RWMutex `json:"-"`
 }
 
+// Database 的 tx 不为 nil 时是 Begin 或 Snapshot 返回的视图，视图本身不保存表
 type Database struct {
-	tables map[string]*Table
-	mu     sync.RWMutex
+	tables    map[string]*Table
+	sequences map[string]*Sequence
+	tx        *Tx
+	mu        sync.RWMutex
+
+	clock    atomic.Uint64 // 最近一次提交的时间
+	txSeq    atomic.Uint64 // 最近分配的事务号
+	commitMu sync.Mutex    // 提交按顺序进行
+	txMu     sync.Mutex
+	active   map[*Tx]bool // 进行中的事务，最早的快照决定哪些旧版本可以回收
+
+	log        *walLog   // 预写日志，见 wal.go
+	lsn        uint64    // 最后一条日志记录的序号，由 commitMu 保护
+	recovering bool      // 正在重放日志
+	created    time.Time // 数据库的创建时间，加载数据文件时取文件中的时间
+
+	modified atomic.Uint64 // 修改的次数，在 commitMu 中增加
+	saved    atomic.Uint64 // 最近一次检查点包含的修改次数，与 modified 相等时没有未保存的修改
+
+	checkpointMu    sync.Mutex      // 同一时间只写入一个快照，保护以下字段
+	snapshotLSN     uint64          // 数据文件中快照的日志序号，下一次检查点后它成为上一个快照
+	snapshotOptions SnapshotOptions // 保存快照使用的格式
+	snapshotFiles   map[string]bool // 数据文件引用的表文件，见 checkpoint.go
 }
 
 func NewDatabase() *Database {
 	return &Database{
-		tables: make(map[string]*Table),
+		tables:    make(map[string]*Table),
+		sequences: make(map[string]*Sequence),
+		active:    make(map[*Tx]bool),
+		created:   time.Now().UTC(),
 	}
 }
 
-func (db *Database) CreateTable(name string, columns []Column) error {
+// CreateTable 创建表，constraints 为表级的唯一约束
+func (db *Database) CreateTable(name string, columns []Column, constraints ...Constraint) error {
+	if err := db.notInTransaction("CREATE TABLE"); err != nil {
+		return err
+	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	if _, exists := db.tables[name]; exists {
 		return fmt.Errorf("table %s already exists", name)
 	}
-
-	db.tables[name] = &Table{
-		Name:    name,
-		Columns: columns,
-		Rows:    make([]map[string]interface{}, 0),
+	for i, col := range columns {
+		if col.Default == nil {
+			continue
+		}
+		value, err := coerceValue(col, col.Default)
+		if err != nil {
+			return fmt.Errorf("column %s: invalid default: %v", col.Name, err)
+		}
+		columns[i].Default = value
 	}
-	return nil
+	if err := validateConstraints(columns, constraints); err != nil {
+		return err
+	}
+	if err := validateAutoIncrement(columns); err != nil {
+		return err
+	}
+
+	db.tables[name] = newTable(db, name, columns, constraints)
+	return db.logOps(logOp{Op: opCreateTable, Table: name, Columns: columns, Constraints: constraints})
 }
 
 func (db *Database) GetTable(name string) (*Table, error) {
+	if db.tx != nil {
+		table, err := db.tx.db.GetTable(name)
+		if err != nil {
+			return nil, err
+		}
+		return &Table{tableState: table.tableState, tx: db.tx}, nil
+	}
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
@@ -64,102 +203,332 @@ func (db *Database) GetTable(name string) (*Table, error) {
 	return table, nil
 }
 
+// DropTable 删除表，ifExists 为 true 时表不存在也不报错
+func (db *Database) DropTable(name string, ifExists bool) error {
+	if err := db.notInTransaction("DROP TABLE"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, exists := db.tables[name]
+	if !exists {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("table %s does not exist", name)
+	}
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if err := table.noPendingWrites("DROP TABLE"); err != nil {
+		return err
+	}
+	table.dropped = true
+	delete(db.tables, name)
+	return db.logOps(logOp{Op: opDropTable, Table: name})
+}
+
+// RenameTable 重命名表，新表名不能已经存在
+func (db *Database) RenameTable(oldName, newName string) error {
+	if err := db.notInTransaction("RENAME TABLE"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table, exists := db.tables[oldName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", oldName)
+	}
+	if _, exists := db.tables[newName]; exists {
+		return fmt.Errorf("table %s already exists", newName)
+	}
+
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if err := table.noPendingWrites("RENAME TABLE"); err != nil {
+		return err
+	}
+	table.Name = newName
+
+	delete(db.tables, oldName)
+	db.tables[newName] = table
+	return db.logOps(logOp{Op: opRenameTable, Table: oldName, Name: newName})
+}
+
+// SaveToDisk 保存数据库，在事务视图上调用时保存的是已提交的数据
 func (db *Database) SaveToDisk(filename string) error {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+	if db.tx != nil {
+		return db.tx.db.SaveToDisk(filename)
+	}
+	db.checkpointMu.Lock()
+	defer db.checkpointMu.Unlock()
 
-	file, err := os.Create(filename)
+	img, err := db.capture(false)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	return img.write(filename, db.snapshotOptions)
+}
 
-	data := make(map[string]TableData)
-	for name, table := range db.tables {
-		data[name] = TableData{
-			Name:    table.Name,
-			Columns: table.Columns,
-			Rows:    table.Rows,
+// image 是数据库在某一时刻的映像
+type image struct {
+	lsn       uint64
+	modified  uint64
+	created   time.Time
+	tables    []tableImage
+	sequences []SequenceData
+}
+
+// capture 取得数据库的映像：先锁住所有的表，使表上没有进行中的写入，再阻止提交，
+// 取得的快照与日志序号对应同一时刻。rotate 为 true 时之后的日志写入新的段。
+// 这里只复制存储的切片头，编码在锁外进行，保存期间不阻塞写入
+func (db *Database) capture(rotate bool) (*image, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	tables := make([]*Table, 0, len(db.tables))
+	for _, table := range db.tables {
+		table.mu.RLock()
+		defer table.mu.RUnlock()
+		tables = append(tables, table)
+	}
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+
+	if rotate {
+		if err := db.log.rotate(db.lsn + 1); err != nil {
+			return nil, err
 		}
 	}
+	img := &image{lsn: db.lsn, modified: db.modified.Load(), created: db.created}
+	snap := snapshot{ts: db.clock.Load()}
+	for _, table := range tables {
+		img.tables = append(img.tables, table.image(snap))
+	}
+	for _, seq := range db.sequences {
+		img.sequences = append(img.sequences, seq.data())
+	}
+	return img, nil
+}
 
-	encoder := json.NewEncoder(file)
-	return encoder.Encode(data)
+// write 按 options 把映像写入数据文件，见 snapshot.go 和 codec.go
+func (img *image) write(filename string, options SnapshotOptions) error {
+	return writeSnapshot(filename, func(w io.Writer) error {
+		return img.encode(w, options)
+	})
 }
 
+// LoadFromDisk 用文件中的数据替换数据库中所有的表和序列，文件不存在、不完整或损坏时加载上一个快照。
+// 先在锁外读取文件并生成所有的表和序列，加载失败时数据库保持不变
 func (db *Database) LoadFromDisk(filename string) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+	if err := db.notInTransaction("LOAD"); err != nil {
+		return err
+	}
+	data, err := readDiskData(filename)
+	fallback := err != nil
+	if fallback {
+		previous, prevErr := readDiskData(previousSnapshot(filename))
+		if prevErr != nil {
+			return err
+		}
+		data = previous
+	}
 
-	file, err := os.Open(filename)
+	tables, sequences, err := db.build(data)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	// 损坏的文件移到一边，下一次写入快照时不会用它替换上一个快照
+	if fallback {
+		if _, err := os.Stat(filename); err == nil {
+			if err := os.Rename(filename, corruptSnapshot(filename)); err != nil {
+				return err
+			}
+		}
+	}
+	return db.replace(data, tables, sequences, fallback)
+}
 
-	var data map[string]TableData
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&data); err != nil {
+// load 用 data 替换数据库中所有的表和序列。changed 为 true 时启动时加载的数据也与数据文件不同
+func (db *Database) load(data *diskData, changed bool) error {
+	tables, sequences, err := db.build(data)
+	if err != nil {
 		return err
 	}
+	return db.replace(data, tables, sequences, changed)
+}
+
+// build 在锁外生成 data 中所有的表和序列，任何一张表加载失败时返回错误
+func (db *Database) build(data *diskData) (map[string]*Table, map[string]*Sequence, error) {
+	startup := db.log == nil
+	tables := make(map[string]*Table, len(data.Tables))
+	for _, tableData := range data.Tables {
+		table, err := db.loadTable(tableData)
+		if err != nil {
+			return nil, nil, err
+		}
+		if startup && tableData.File != "" {
+			table.saved = tableFile{name: tableData.File, rows: tableData.RowCount}
+		}
+		tables[tableData.Name] = table
+	}
+	sequences := make(map[string]*Sequence, len(data.Sequences))
+	for _, seqData := range data.Sequences {
+		sequences[seqData.Name] = &Sequence{
+			Name:      seqData.Name,
+			Start:     seqData.Start,
+			Increment: seqData.Increment,
+			Current:   seqData.Current,
+			Used:      seqData.Used,
+		}
+	}
+	return tables, sequences, nil
+}
 
-	db.tables = make(map[string]*Table)
+// replace 用生成的表和序列替换数据库中原有的表和序列，changed 的含义与 load 相同
+func (db *Database) replace(data *diskData, tables map[string]*Table, sequences map[string]*Sequence, changed bool) error {
+	startup := db.log == nil
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	for _, tableData := range data {
-		db.tables[tableData.Name] = &Table{
-			Name:    tableData.Name,
-			Columns: tableData.Columns,
-			Rows:    tableData.Rows,
+	// 原有的表被替换，之前取得的句柄不能再写入
+	for _, table := range db.tables {
+		table.mu.Lock()
+		defer table.mu.Unlock()
+		if err := table.noPendingWrites("LOAD"); err != nil {
+			return err
 		}
 	}
+	for _, table := range db.tables {
+		table.dropped = true
+	}
 
+	db.tables = tables
+	db.sequences = sequences
+	// 日志序号只增不减，运行中加载旧的文件不影响之后的记录
+	// 运行中加载或加载的不是数据文件中的快照时，数据文件与内存中的数据不同
+	db.commitMu.Lock()
+	if data.LSN > db.lsn {
+		db.lsn = data.LSN
+	}
+	if !startup || changed {
+		db.modified.Add(1)
+	}
+	db.commitMu.Unlock()
+	// 启动时加载的是数据文件中的快照，运行中加载其他文件不改变数据文件。
+	// 启动时沿用快照引用的表文件，没有修改的表在检查点时不重新写入
+	if startup {
+		files := make(map[string]bool)
+		for _, tableData := range data.Tables {
+			if tableData.File != "" {
+				files[tableData.File] = true
+			}
+		}
+		db.checkpointMu.Lock()
+		db.snapshotLSN = data.LSN
+		db.snapshotFiles = files
+		db.checkpointMu.Unlock()
+	}
+	db.created = data.Created
 	return nil
 }
 
-func (db *Database) GetTableInfo(name string) (*TableInfo, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	table, exists := db.tables[name]
-	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", name)
+// loadTable 用保存的表生成新的表，加载的行对所有快照可见
+func (db *Database) loadTable(tableData TableData) (*Table, error) {
+	table := newTable(db, tableData.Name, tableData.Columns, tableData.Constraints)
+	table.AutoIncrement = tableData.AutoIncrement
+	table.Indexes = tableData.Indexes
+	table.created, table.updated = tableData.Created, tableData.Updated
+	if err := table.load(tableData.Rows); err != nil {
+		return nil, fmt.Errorf("table %s: %v", table.Name, err)
+	}
+	// 索引只保存定义，加载后重新生成，同时检查唯一约束。早期的索引没有类型，都是哈希索引
+	for _, idx := range table.Indexes {
+		if idx.Type == "" {
+			idx.Type = IndexHash
+		}
 	}
+	if err := table.rebuildIndexes(); err != nil {
+		return nil, fmt.Errorf("table %s: %w", table.Name, err)
+	}
+	return table, nil
+}
 
-	columns := make([]struct {
-		Name string
-		Type string
-	}, len(table.Columns))
+// unmarshalNumbers 解码 JSON，未指定类型的数值解码为 json.Number，避免大整数丢失精度
+func unmarshalNumbers(content []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
 
+func (db *Database) GetTableInfo(name string) (*TableInfo, error) {
+	table, err := db.GetTable(name)
+	if err != nil {
+		return nil, err
+	}
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+
+	columns := make([]ColumnInfo, len(table.Columns))
 	for i, col := range table.Columns {
-		typeName := "string"
-		if col.Type == TypeInt {
-			typeName = "int"
-		}
-		columns[i] = struct {
-			Name string
-			Type string
-		}{
-			Name: col.Name,
-			Type: typeName,
+		columns[i] = ColumnInfo{
+			Name:          col.Name,
+			Type:          col.Type.String(),
+			Nullable:      col.Nullable,
+			Default:       col.Default,
+			PrimaryKey:    col.PrimaryKey,
+			Unique:        col.Unique,
+			AutoIncrement: col.AutoIncrement,
 		}
 	}
 
+	indexes := make([]IndexInfo, len(table.Indexes))
+	for i, idx := range table.Indexes {
+		indexes[i] = IndexInfo{Name: idx.Name, Columns: idx.Columns, Unique: idx.Unique, Type: string(idx.Type)}
+	}
+
 	return &TableInfo{
-		Name:    table.Name,
-		Columns: columns,
+		Name:        table.Name,
+		Columns:     columns,
+		Constraints: table.Constraints,
+		Indexes:     indexes,
 	}, nil
 }
 
 type TableData struct {
-	Name    string                   `json:"name"`
-	Columns []Column                 `json:"columns"`
-	Rows    []map[string]interface{} `json:"rows"`
+	Name          string                   `json:"name"`
+	Columns       []Column                 `json:"columns"`
+	Constraints   []Constraint             `json:"constraints,omitempty"`
+	Rows          []map[string]interface{} `json:"rows"`
+	AutoIncrement int                      `json:"auto_increment,omitempty"`
+	Indexes       []*Index                 `json:"indexes,omitempty"`
+	RowCount      int                      `json:"row_count"`
+	File          string                   `json:"file,omitempty"` // 保存行的表文件，为空时行在 Rows 中
+	Created       time.Time                `json:"created"`
+	Updated       time.Time                `json:"updated"`
 }
 
 type TableInfo struct {
+	Name        string
+	Columns     []ColumnInfo
+	Constraints []Constraint
+	Indexes     []IndexInfo
+}
+
+type IndexInfo struct {
 	Name    string
-	Columns []struct {
-		Name string
-		Type string
-	}
-} 
\ No newline at end of file
+	Columns []string
+	Unique  bool
+	Type    string
+}
+
+type ColumnInfo struct {
+	Name          string
+	Type          string
+	Nullable      bool
+	Default       interface{}
+	PrimaryKey    bool
+	Unique        bool
+	AutoIncrement bool
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// 数据文件的格式
+//
+// 数据文件的内容是带版本号的对象，编码为 JSON 或二进制格式（见 codec.go）。
+// 加载时识别旧的格式并逐版迁移到当前版本，之后的检查点按当前版本写入。各版本的内容：
+//
+//	0  顶层直接是表名到表的映射
+//	1  {tables, sequences, lsn}，增加了序列和日志序号
+//	2  增加 version、数据库的创建和更新时间，以及每张表的创建、更新时间和行数
+//	3  表的行可以保存在单独的表文件中，表的 file 为文件名（见 checkpoint.go）
+//
+// 第 1 版的文件从带有校验和（见 snapshot.go）开始增加 checksum，第 2 版以后的文件都带有校验和
+const formatVersion = 3
+
+// diskData 是数据文件的内容。LSN 为快照包含的最后一条日志记录的序号，
+// Updated 为写入快照的时间，Checksum 表示文件以校验和结尾
+type diskData struct {
+	Version   int                     `json:"version"`
+	Checksum  bool                    `json:"checksum,omitempty"`
+	Created   time.Time               `json:"created"`
+	Updated   time.Time               `json:"updated"`
+	LSN       uint64                  `json:"lsn,omitempty"`
+	Tables    map[string]TableData    `json:"tables"`
+	Sequences map[string]SequenceData `json:"sequences,omitempty"`
+}
+
+// migrations[i] 把第 i 版的内容迁移到第 i+1 版
+var migrations = []func(data *diskData){
+	// 0 → 1：解析时表已经放入 Tables，没有序列
+	func(data *diskData) {},
+	// 1 → 2：旧的文件没有记录时间，取迁移的时间；行数按保存的行计算
+	func(data *diskData) {
+		now := time.Now().UTC()
+		data.Created, data.Updated = now, now
+		for name, table := range data.Tables {
+			table.Created, table.Updated = now, now
+			table.RowCount = len(table.Rows)
+			data.Tables[name] = table
+		}
+	},
+	// 2 → 3：行都在数据文件中
+	func(data *diskData) {},
+}
+
+// readDiskData 读取并解析数据文件，从表文件中读取保存在其中的行。
+// 写入了校验和的文件缺少校验和时视为损坏
+func readDiskData(filename string) (*diskData, error) {
+	content, checked, err := readSnapshot(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeDiskData(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if data.Checksum && !checked {
+		return nil, fmt.Errorf("%s: checksum is missing: %w", filename, errCorruptSnapshot)
+	}
+
+	for name, table := range data.Tables {
+		if table.File == "" {
+			continue
+		}
+		stored, err := readTableFile(filepath.Join(tableDir(filename), table.File))
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %v", name, err)
+		}
+		if len(stored.Rows) != table.RowCount {
+			return nil, fmt.Errorf("table %s: expected %d rows, found %d", name, table.RowCount, len(stored.Rows))
+		}
+		table.Rows = stored.Rows
+		data.Tables[name] = table
+	}
+	return data, nil
+}
+
+// decodeDiskData 按文件头识别压缩方式和编码，解析数据文件后迁移到当前版本
+func decodeDiskData(content []byte) (*diskData, error) {
+	content, err := decompress(content)
+	if err != nil {
+		return nil, err
+	}
+	var data *diskData
+	if bytes.HasPrefix(content, binaryMagic) {
+		data, err = decodeBinary(content)
+	} else {
+		data, err = decodeJSON(content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	version := data.Version
+	if version > formatVersion {
+		return nil, fmt.Errorf("unsupported format version %d (newest supported is %d)", version, formatVersion)
+	}
+	for v := version; v < formatVersion; v++ {
+		migrations[v](data)
+	}
+	data.Version = formatVersion
+
+	for name, table := range data.Tables {
+		if table.File == "" && len(table.Rows) != table.RowCount {
+			return nil, fmt.Errorf("table %s: expected %d rows, found %d", name, table.RowCount, len(table.Rows))
+		}
+	}
+	return data, nil
+}
+
+// decodeJSON 解析 JSON 格式的数据文件，版本号由 detectVersion 识别
+func decodeJSON(content []byte) (*diskData, error) {
+	version, err := detectVersion(content)
+	if err != nil {
+		return nil, err
+	}
+	data := &diskData{}
+	if version > formatVersion {
+		data.Version = version
+		return data, nil
+	}
+	if version == 0 {
+		err = unmarshalNumbers(content, &data.Tables)
+	} else {
+		err = unmarshalNumbers(content, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data.Version = version
+	return data, nil
+}
+
+// detectVersion 识别数据文件的版本。第 1 版没有版本号，顶层的 tables 是表的映射；
+// 第 0 版中名为 tables 的表能解析出列定义，名为 version 的表不是数字
+func detectVersion(content []byte) (int, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return 0, err
+	}
+
+	var version int
+	if v, ok := raw["version"]; ok && json.Unmarshal(v, &version) == nil {
+		return version, nil
+	}
+	var legacy TableData
+	tables, ok := raw["tables"]
+	if !ok || (json.Unmarshal(tables, &legacy) == nil && legacy.Columns != nil) {
+		return 0, nil
+	}
+	return 1, nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeDiskDataVersions(t *testing.T) {
+	const table = `{"name":"t","columns":[{"name":"id","type":0}],"rows":[{"id":1},{"id":2}]}`
+	tests := []struct {
+		name      string
+		content   string
+		lsn       uint64
+		sequences int
+	}{
+		{"version 0", `{"t":` + table + `}`, 0, 0},
+		{"version 1", `{"tables":{"t":` + table + `},"sequences":{"s":{"name":"s","start":1,"increment":1}},"lsn":7}`, 7, 1},
+		{"version 2", `{"version":2,"created":"2024-01-02T00:00:00Z","tables":{"t":` +
+			strings.Replace(table, `"rows"`, `"row_count":2,"created":"2024-01-02T00:00:00Z","rows"`, 1) + `},"lsn":9}`, 9, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := decodeDiskData([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.Version != formatVersion || data.LSN != tt.lsn || len(data.Sequences) != tt.sequences {
+				t.Errorf("version %d, lsn %d, %d sequences", data.Version, data.LSN, len(data.Sequences))
+			}
+			got := data.Tables["t"]
+			if got.RowCount != 2 || len(got.Rows) != 2 || got.Created.IsZero() || data.Created.IsZero() {
+				t.Errorf("table after migration: %+v", got)
+			}
+		})
+	}
+}
+
+func TestDecodeDiskDataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"newer version", `{"version":99,"tables":{}}`, "unsupported format version 99"},
+		{"row count", `{"version":2,"tables":{"t":{"name":"t","columns":[{"name":"id","type":0}],"rows":[],"row_count":1}}}`, "expected 1 rows, found 0"},
+		{"not json", `{"tables":`, "unexpected end"},
+	}
+	for _, tt := range tests {
+		if _, err := decodeDiskData([]byte(tt.content)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// 保存的数据文件是当前版本，数据库和表的创建时间在重新加载后保持不变
+func TestDiskDataMetadata(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	database := newTestDatabase(t)
+	if _, err := mustTable(t, database).Insert(map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SaveToDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := readDiskData(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != formatVersion || saved.Tables["t"].RowCount != 1 {
+		t.Errorf("saved version %d, row count %d", saved.Version, saved.Tables["t"].RowCount)
+	}
+
+	time.Sleep(time.Millisecond)
+	loaded := NewDatabase()
+	if err := loaded.LoadFromDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.SaveToDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	resaved, err := readDiskData(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resaved.Created.Equal(saved.Created) || !resaved.Tables["t"].Created.Equal(saved.Tables["t"].Created) {
+		t.Errorf("created changed after reload: %v → %v", saved.Created, resaved.Created)
+	}
+	if !resaved.Updated.After(saved.Updated) {
+		t.Errorf("updated %v not after %v", resaved.Updated, saved.Updated)
+	}
+}
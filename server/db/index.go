@@ -0,0 +1,492 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IndexType 是索引的存储方式
+type IndexType string
+
+const (
+	IndexHash    IndexType = "hash"    // 哈希索引，只用于等值条件
+	IndexOrdered IndexType = "ordered" // 有序索引，还可用于范围条件和排序
+)
+
+// ParseIndexType 将索引类型名转换为索引类型，空字符串为哈希索引
+func ParseIndexType(name string) (IndexType, error) {
+	switch strings.ToLower(name) {
+	case "", "hash":
+		return IndexHash, nil
+	case "ordered":
+		return IndexOrdered, nil
+	default:
+		return "", fmt.Errorf("invalid index type: %s", name)
+	}
+}
+
+// Index 是表上的索引，把索引列的值映射到行在表中的下标。
+// 哈希索引不保存含有 NULL 的行，因为等值条件不会匹配 NULL；
+// 有序索引保存所有的行，NULL 排在最前面，与 ORDER BY 的顺序一致
+type Index struct {
+	Name    string           `json:"name"`
+	Columns []string         `json:"columns"`
+	Unique  bool             `json:"unique,omitempty"`
+	Type    IndexType        `json:"type,omitempty"`
+	entries map[string][]int // 哈希索引：键 → 行下标
+	tree    *skiplist        // 有序索引
+
+	constraint *Constraint // 唯一约束的索引对应的约束，见 keyIndexes
+}
+
+func (idx *Index) String() string {
+	kind := "index"
+	if idx.Unique {
+		kind = "unique index"
+	}
+	return fmt.Sprintf("%s %s (%s)", kind, idx.Name, strings.Join(idx.Columns, ", "))
+}
+
+func (idx *Index) ordered() bool {
+	return idx.Type == IndexOrdered
+}
+
+// Lookup 是列上的比较条件，Op 为 =、<、<=、>、>= 之一。
+// Select、Update、Delete 可以带上从查询条件中提取的 Lookup，
+// 表在有合适的索引时只检查索引找到的行，条件函数仍然会在这些行上求值
+type Lookup struct {
+	Column string
+	Op     string
+	Value  interface{}
+}
+
+// CreateIndex 在 columns 上创建索引，unique 为 true 时索引列的值不能重复。
+// 有序索引不能建在 json 列上
+func (t *Table) CreateIndex(name string, columns []string, unique bool, kind IndexType) error {
+	if err := t.notInTransaction("CREATE INDEX"); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.index(name) != nil {
+		return fmt.Errorf("index %s already exists", name)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("index %s must have at least one column", name)
+	}
+	for _, colName := range columns {
+		i := columnIndex(t.Columns, colName)
+		if i < 0 {
+			return fmt.Errorf("column %s does not exist", colName)
+		}
+		if kind == IndexOrdered && t.Columns[i].Type == TypeJSON {
+			return fmt.Errorf("column %s: ordered index cannot be created on a json column", colName)
+		}
+	}
+
+	idx := &Index{Name: name, Columns: columns, Unique: unique, Type: kind}
+	if err := idx.build(t.rows, t.row, t.latest); err != nil {
+		return err
+	}
+	t.Indexes = append(t.Indexes, idx)
+	return t.db.logOps(logOp{Op: opCreateIndex, Table: t.Name, Index: idx})
+}
+
+// DropIndex 删除索引
+func (t *Table) DropIndex(name string) error {
+	if err := t.notInTransaction("DROP INDEX"); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, idx := range t.Indexes {
+		if idx.Name == name {
+			t.Indexes = append(t.Indexes[:i:i], t.Indexes[i+1:]...)
+			return t.db.logOps(logOp{Op: opDropIndex, Table: t.Name, Name: name})
+		}
+	}
+	return fmt.Errorf("index %s does not exist", name)
+}
+
+func (t *Table) index(name string) *Index {
+	for _, idx := range t.Indexes {
+		if idx.Name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// indexes 返回表上所有的索引：唯一约束的索引和 CREATE INDEX 创建的索引
+func (t *tableState) indexes() []*Index {
+	return append(append(make([]*Index, 0, len(t.keys)+len(t.Indexes)), t.keys...), t.Indexes...)
+}
+
+// rebuildIndexes 按当前的行重建所有索引，包括唯一约束的索引，用于加载数据之后
+func (t *Table) rebuildIndexes() error {
+	t.keys = keyIndexes(t.Columns, t.Constraints)
+	for _, idx := range t.indexes() {
+		if err := idx.build(t.rows, t.row, t.latest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// candidates 用 lookups 选择最合适的索引，返回可能满足条件的行下标（升序）。
+// 哈希索引要求所有列都有等值条件；有序索引要求前几列有等值条件，
+// 之后的一列可以有范围条件。没有可用的索引时返回 false，调用方需要扫描所有行
+func (t *Table) candidates(lookups []Lookup) ([]int, bool) {
+	lookups = t.coerceLookups(lookups)
+	if len(lookups) == 0 {
+		return nil, false
+	}
+	equal := equalValues(lookups)
+	var best *Index
+	bestScore := 0
+	for _, idx := range t.indexes() {
+		if score := idx.score(equal, lookups); score > bestScore {
+			best, bestScore = idx, score
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+
+	var positions []int
+	if best.ordered() {
+		positions = best.rangeScan(equal, lookups)
+	} else {
+		key, ok := uniqueKey(equal, best.Columns)
+		if !ok {
+			// 与 NULL 比较的等值条件不匹配任何行
+			return []int{}, true
+		}
+		positions = append([]int(nil), best.entries[key]...)
+	}
+	sort.Ints(positions)
+	return positions, true
+}
+
+// coerceLookups 把 lookups 中的值转换为列类型的值，使索引的键与保存的值一致
+// （如把时间文本解析为时间）。无法转换的条件不用于索引，交给条件函数处理
+func (t *Table) coerceLookups(lookups []Lookup) []Lookup {
+	result := make([]Lookup, 0, len(lookups))
+	for _, l := range lookups {
+		i := columnIndex(t.Columns, l.Column)
+		if i < 0 {
+			continue
+		}
+		col := t.Columns[i]
+		col.Nullable = true
+		value, err := coerceValue(col, l.Value)
+		if err != nil {
+			continue
+		}
+		l.Value = value
+		result = append(result, l)
+	}
+	return result
+}
+
+// equalValues 返回 lookups 中等值条件的列和值，
+// 同一列上有多个等值条件时使用第一个，其余的交给条件函数
+func equalValues(lookups []Lookup) map[string]interface{} {
+	equal := make(map[string]interface{})
+	for _, l := range lookups {
+		if _, ok := equal[l.Column]; !ok && l.Op == "=" {
+			equal[l.Column] = l.Value
+		}
+	}
+	return equal
+}
+
+// orderedIndex 寻找能按 columns 的顺序提供行的有序索引：索引中紧接在 columns 之前的列都有等值条件。
+// 返回索引和 columns 在索引列中的起始位置
+func (t *Table) orderedIndex(columns []string, equal map[string]interface{}) (*Index, int) {
+	for _, idx := range t.Indexes {
+		if !idx.ordered() {
+			continue
+		}
+		for k := 0; k+len(columns) <= len(idx.Columns); k++ {
+			if equalColumns(idx.Columns[k:k+len(columns)], columns) {
+				return idx, k
+			}
+			if _, ok := equal[idx.Columns[k]]; !ok {
+				break
+			}
+		}
+	}
+	return nil, 0
+}
+
+func equalColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// score 评估索引对 lookups 的可用程度，0 表示不可用。
+// 每个等值列计 2 分，有序索引上的范围条件计 1 分，同样的列数下哈希索引优先
+func (idx *Index) score(equal map[string]interface{}, lookups []Lookup) int {
+	if !idx.ordered() {
+		for _, colName := range idx.Columns {
+			if _, ok := equal[colName]; !ok {
+				return 0
+			}
+		}
+		return 2*len(idx.Columns) + 1
+	}
+
+	prefix := idx.equalPrefix(equal)
+	score := 2 * prefix
+	if prefix < len(idx.Columns) {
+		for _, l := range lookups {
+			if l.Column == idx.Columns[prefix] && l.Op != "=" {
+				score++
+				break
+			}
+		}
+	}
+	return score
+}
+
+// equalPrefix 返回索引开头有等值条件的列数
+func (idx *Index) equalPrefix(equal map[string]interface{}) int {
+	n := 0
+	for _, colName := range idx.Columns {
+		if _, ok := equal[colName]; !ok {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// rangeScan 在有序索引上查找前缀等于等值条件、下一列落在范围条件之内的行
+func (idx *Index) rangeScan(equal map[string]interface{}, lookups []Lookup) []int {
+	positions := make([]int, 0)
+	low, high, ok := idx.bounds(equal, lookups)
+	if !ok {
+		return positions
+	}
+	for node := idx.tree.seek(low); node != nil && comparePrefix(node.key, high) <= 0; node = node.next[0] {
+		positions = append(positions, node.pos)
+	}
+	return positions
+}
+
+// bounds 计算有序索引上的扫描范围：键的前缀不小于 low 且不大于 high。
+// 边界都按闭区间处理，范围内的行可能多于满足条件的行，由条件函数再过滤。
+// 等值条件为 NULL 时没有任何行满足条件，返回 false
+func (idx *Index) bounds(equal map[string]interface{}, lookups []Lookup) ([]interface{}, []interface{}, bool) {
+	prefix := idx.equalPrefix(equal)
+	low := make([]interface{}, prefix, prefix+1)
+	for i := 0; i < prefix; i++ {
+		low[i] = equal[idx.Columns[i]]
+		if low[i] == nil {
+			return nil, nil, false
+		}
+	}
+	high := append([]interface{}(nil), low...)
+	if prefix == len(idx.Columns) {
+		return low, high, true
+	}
+
+	var lowValue, highValue interface{}
+	for _, l := range lookups {
+		if l.Column != idx.Columns[prefix] || l.Value == nil {
+			continue
+		}
+		switch l.Op {
+		case ">", ">=":
+			if lowValue == nil || Compare(l.Value, lowValue) > 0 {
+				lowValue = l.Value
+			}
+		case "<", "<=":
+			if highValue == nil || Compare(l.Value, highValue) < 0 {
+				highValue = l.Value
+			}
+		}
+	}
+	if lowValue != nil {
+		low = append(low, lowValue)
+	}
+	if highValue != nil {
+		high = append(high, highValue)
+	}
+	return low, high, true
+}
+
+// key 返回行在索引列上的值
+func (idx *Index) key(row map[string]interface{}) []interface{} {
+	key := make([]interface{}, len(idx.Columns))
+	for i, colName := range idx.Columns {
+		key[i] = row[colName]
+	}
+	return key
+}
+
+// build 按 n 行数据重新生成索引，row 返回第 i 行。
+// 旧版本的行同样加入索引，唯一索引只检查 current 返回 true 的行
+func (idx *Index) build(n int, row func(i int) map[string]interface{}, current func(i int) bool) error {
+	idx.clear()
+	skip := func(pos int) bool { return !current(pos) }
+	for i := 0; i < n; i++ {
+		row := row(i)
+		if current(i) {
+			if err := idx.check(row, skip); err != nil {
+				return err
+			}
+		}
+		idx.add(row, i)
+	}
+	return nil
+}
+
+func (idx *Index) clear() {
+	if idx.ordered() {
+		idx.tree = newSkiplist()
+	} else {
+		idx.entries = make(map[string][]int)
+	}
+}
+
+// check 检查写入 row 是否违反唯一索引，skip 返回 true 的行不参与比较
+func (idx *Index) check(row map[string]interface{}, skip func(pos int) bool) error {
+	if !idx.Unique {
+		return nil
+	}
+	key, ok := uniqueKey(row, idx.Columns)
+	if !ok {
+		return nil
+	}
+	for _, pos := range idx.lookup(row) {
+		if !skip(pos) {
+			return idx.violation(key)
+		}
+	}
+	return nil
+}
+
+// violation 返回键 key 重复的错误，唯一约束的索引报告对应的约束
+func (idx *Index) violation(key string) error {
+	c := Constraint{Columns: idx.Columns}
+	if idx.constraint != nil {
+		c = *idx.constraint
+	}
+	return &ConstraintError{Constraint: c, Key: key}
+}
+
+// lookup 返回索引列上的值与 row 相同的行下标，row 的索引列含有 NULL 时返回 nil
+func (idx *Index) lookup(row map[string]interface{}) []int {
+	if !idx.ordered() {
+		key, _ := uniqueKey(row, idx.Columns)
+		return idx.entries[key]
+	}
+	key := idx.key(row)
+	for _, v := range key {
+		if v == nil {
+			return nil
+		}
+	}
+	var positions []int
+	for node := idx.tree.seek(key); node != nil && compareKeys(node.key, key) == 0; node = node.next[0] {
+		positions = append(positions, node.pos)
+	}
+	return positions
+}
+
+func (idx *Index) add(row map[string]interface{}, pos int) {
+	if idx.ordered() {
+		idx.tree.insert(idx.key(row), pos)
+		return
+	}
+	if key, ok := uniqueKey(row, idx.Columns); ok {
+		idx.entries[key] = append(idx.entries[key], pos)
+	}
+}
+
+func (idx *Index) remove(row map[string]interface{}, pos int) {
+	if idx.ordered() {
+		idx.tree.remove(idx.key(row), pos)
+		return
+	}
+	key, ok := uniqueKey(row, idx.Columns)
+	if !ok {
+		return
+	}
+	positions := idx.entries[key]
+	for i, p := range positions {
+		if p == pos {
+			positions = append(positions[:i], positions[i+1:]...)
+			break
+		}
+	}
+	if len(positions) == 0 {
+		delete(idx.entries, key)
+	} else {
+		idx.entries[key] = positions
+	}
+}
+
+// remap 在删除行之后调整下标，newPos[i] 为原来第 i 行的新下标，被删除的行为 -1
+func (idx *Index) remap(newPos []int) {
+	if idx.ordered() {
+		// 保留的行之间的顺序不变，按原来的顺序依次追加即可
+		old := idx.tree
+		idx.tree = newSkiplist()
+		tails := idx.tree.tails()
+		for node := old.first(); node != nil; node = node.next[0] {
+			if newPos[node.pos] >= 0 {
+				idx.tree.append(tails, node.key, newPos[node.pos])
+			}
+		}
+		return
+	}
+	for key, positions := range idx.entries {
+		kept := positions[:0]
+		for _, p := range positions {
+			if newPos[p] >= 0 {
+				kept = append(kept, newPos[p])
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.entries, key)
+		} else {
+			idx.entries[key] = kept
+		}
+	}
+}
+
+// checkUpdate 检查用 changed 中的行替换对应下标的行后是否违反唯一索引，
+// skip 返回 true 的行（包括被替换的行）不参与比较
+func (idx *Index) checkUpdate(changed map[int]map[string]interface{}, skip func(pos int) bool) error {
+	if !idx.Unique {
+		return nil
+	}
+	seen := make(map[string]bool, len(changed))
+	for _, row := range changed {
+		if err := idx.check(row, skip); err != nil {
+			return err
+		}
+		key, ok := uniqueKey(row, idx.Columns)
+		if !ok {
+			continue
+		}
+		if seen[key] {
+			return idx.violation(key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexMaintenance(t *testing.T) {
+	table := newTestTable(t)
+	if err := table.CreateIndex("idx_name", []string{"name"}, false, IndexHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.CreateIndex("idx_id", []string{"id"}, true, IndexHash); err != nil {
+		t.Fatal(err)
+	}
+
+	// lookup 通过索引查找 name 相同的行，返回可见的行的 id
+	lookup := func(name string) []interface{} {
+		t.Helper()
+		where := Lookup{Column: "name", Op: "=", Value: name}
+		if _, ok := table.candidates([]Lookup{where}); !ok {
+			t.Fatalf("candidates(name = %s) did not use an index", name)
+		}
+		var ids []interface{}
+		for _, row := range table.Select(nil, where) {
+			ids = append(ids, row["id"])
+		}
+		return ids
+	}
+
+	// 更新之后索引指向新的值，旧版本不可见
+	match := func(row map[string]interface{}) (bool, error) { return row["id"] == int64(2), nil }
+	if err := table.Update(match, map[string]interface{}{"name": "a"}, Lookup{Column: "id", Op: "=", Value: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lookup("a"), []interface{}{int64(1), int64(2)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after update: name = a has ids %v, want %v", got, want)
+	}
+	if got := lookup("b"); len(got) != 0 {
+		t.Errorf("after update: name = b has ids %v, want none", got)
+	}
+
+	// 删除之后的行不可见
+	match = func(row map[string]interface{}) (bool, error) { return row["id"] == int64(1), nil }
+	if _, err := table.Delete(match); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lookup("a"), []interface{}{int64(2)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after delete: name = a has ids %v, want %v", got, want)
+	}
+	if got, want := lookup("c"), []interface{}{int64(3)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after delete: name = c has ids %v, want %v", got, want)
+	}
+
+	// 唯一索引拒绝重复的值，失败的写入不改变索引
+	if _, err := table.Insert(map[string]interface{}{"id": 3, "name": "d"}); err == nil {
+		t.Error("Insert with duplicate id succeeded, want error")
+	}
+	if got := lookup("d"); len(got) != 0 {
+		t.Errorf("failed insert left name = d at %v", got)
+	}
+	rows := table.Select(nil, Lookup{Column: "id", Op: "=", Value: 3})
+	if len(rows) != 1 || rows[0]["name"] != "c" {
+		t.Errorf("Select(id = 3) = %v, want the row named c", rows)
+	}
+}
+
+func TestOrderedIndex(t *testing.T) {
+	table := newTestTable(t)
+	for i, name := range []string{"a", "b", "c"} {
+		if _, err := table.Insert(map[string]interface{}{"id": i + 1, "name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.CreateIndex("idx_id", []string{"id"}, false, IndexOrdered); err != nil {
+		t.Fatal(err)
+	}
+
+	// 范围按闭区间扫描，id > 1 的边界行由条件函数再过滤
+	positions, ok := table.candidates([]Lookup{{Column: "id", Op: ">", Value: 1}, {Column: "id", Op: "<=", Value: 2}})
+	if !ok {
+		t.Fatal("range lookup did not use the ordered index")
+	}
+	if want := []int{0, 1, 3, 4}; !reflect.DeepEqual(positions, want) {
+		t.Errorf("id in [1, 2]: got %v, want %v", positions, want)
+	}
+
+	// 值相同的行按插入顺序排列，与稳定排序的结果相同
+	rows, ok := table.SelectOrdered(nil, []string{"id"}, true, 3)
+	if !ok {
+		t.Fatal("SelectOrdered did not use the ordered index")
+	}
+	got := make([]interface{}, len(rows))
+	for i, row := range rows {
+		got[i] = row["name"]
+	}
+	if want := []interface{}{"c", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ORDER BY id DESC LIMIT 3: got %v, want %v", got, want)
+	}
+	if _, ok := table.SelectOrdered(nil, []string{"name"}, false, 1); ok {
+		t.Error("SelectOrdered on name used an index, want false")
+	}
+}
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 多版本并发控制
+//
+// 表中的一行可以有多个版本。修改一行时不改动原来的版本，而是把它标记为已删除并追加新的版本。
+// xmin 为创建版本的事务的提交时间，xmax 为删除版本的事务的提交时间，0 表示没有被删除。
+// 未提交的事务在 xmin、xmax 中写入带 txBit 的事务号，提交时替换为提交时间。
+//
+// 读取使用快照：提交时间不晚于快照时间的版本可见，事务还能看到自己写入的版本。
+// 查询只在复制列存储的切片头和查找索引时持有表的读锁，之后不加锁地读取，
+// 写入不用等待耗时的查询，同一事务中读到的所有表都来自同一个快照。
+//
+// 两个事务修改同一行时，后修改的一方立即失败（先修改者获胜），不会等待。
+// 不再被任何快照看到的版本在失效的版本积累到一定数量后由 collect 回收
+
+const (
+	txBit = 1 << 63   // 未提交的事务号
+	never = txBit - 1 // 回滚的插入，对任何快照都不可见
+)
+
+// stampChunk 是 stamps 每次分配的元素个数
+const stampChunk = 1024
+
+// stamps 保存每个版本的时间，按块分配，追加时已有元素的地址不变，
+// 提交和回滚可以不加表锁直接改写。读写元素都使用原子操作
+type stamps struct {
+	chunks []*[stampChunk]uint64
+	n      int
+}
+
+func (s *stamps) append(v uint64) {
+	if s.n%stampChunk == 0 {
+		s.chunks = append(s.chunks, new([stampChunk]uint64))
+	}
+	atomic.StoreUint64(s.at(s.n), v)
+	s.n++
+}
+
+func (s *stamps) at(i int) *uint64 {
+	return &s.chunks[i/stampChunk][i%stampChunk]
+}
+
+func (s *stamps) load(i int) uint64 {
+	return atomic.LoadUint64(s.at(i))
+}
+
+// snapshot 是读取时使用的快照，id 为读取者自己的事务号，没有时为 0
+type snapshot struct {
+	ts uint64
+	id uint64
+}
+
+// visible 判断创建和删除时间分别为 xmin、xmax 的版本对快照是否可见
+func (s snapshot) visible(xmin, xmax uint64) bool {
+	if xmin&txBit != 0 {
+		if xmin != s.id {
+			return false
+		}
+	} else if xmin > s.ts {
+		return false
+	}
+	if xmax == 0 {
+		return true
+	}
+	if xmax&txBit != 0 {
+		return xmax != s.id
+	}
+	return xmax > s.ts
+}
+
+// Tx 是事务。写入的版本记录在 writes 中，提交时统一标记提交时间，回滚时撤销
+type Tx struct {
+	db         *Database
+	id         uint64 // 带 txBit 的事务号
+	ts         uint64 // 快照时间
+	readOnly   bool
+	auto       bool // 单条语句自动提交的事务
+	done       bool
+	writes     []txWrite
+	tables     map[*tableState]int // 写过的表及其中失效的版本数
+	savepoints []savepoint
+	ops        []logOp   // 打开日志时，提交时写入日志的操作
+	time       time.Time // 提交时间，不为零时使用这个时间（重放日志时为记录的时间）
+}
+
+type txWrite struct {
+	table  *tableState
+	stamp  *uint64
+	insert bool // true 为插入的版本（stamp 指向 xmin），false 为删除的版本（指向 xmax）
+}
+
+type savepoint struct {
+	name   string
+	writes int
+	ops    int
+}
+
+// begin 开始事务，快照时间为最近一次提交的时间
+func (db *Database) begin(readOnly bool) *Tx {
+	tx := &Tx{
+		db:       db,
+		id:       db.txSeq.Add(1) | txBit,
+		readOnly: readOnly,
+		tables:   make(map[*tableState]int),
+	}
+	db.txMu.Lock()
+	tx.ts = db.clock.Load()
+	db.active[tx] = true
+	db.txMu.Unlock()
+	return tx
+}
+
+// horizon 返回回收的界限：删除时间不晚于它的版本不会再被任何快照看到
+func (db *Database) horizon() uint64 {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	h := db.clock.Load()
+	for tx := range db.active {
+		if tx.ts < h {
+			h = tx.ts
+		}
+	}
+	return h
+}
+
+func (tx *Tx) snapshot() snapshot {
+	return snapshot{ts: tx.ts, id: tx.id}
+}
+
+// write 检查事务能否在 t 上写入，并记录 t 有未提交的写入，调用者需要持有 t 的写锁
+func (tx *Tx) write(t *tableState) error {
+	if tx.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+	if tx.readOnly {
+		return fmt.Errorf("cannot write in a read-only snapshot")
+	}
+	if _, ok := tx.tables[t]; !ok {
+		tx.tables[t] = 0
+		t.writers++
+	}
+	return nil
+}
+
+// insert 追加版本的创建时间，row 为插入的行，调用者需要持有 t 的写锁
+func (tx *Tx) insert(t *tableState, row map[string]interface{}) {
+	t.xmin.append(tx.id)
+	t.xmax.append(0)
+	tx.writes = append(tx.writes, txWrite{table: t, stamp: t.xmin.at(t.xmin.n - 1), insert: true})
+	tx.log(logOp{Op: opInsert, Table: t.Name, Row: row})
+}
+
+// conflict 检查事务能否删除或修改第 i 个版本。版本在事务的快照之后被其他事务删除或修改过，
+// 或者正在被其他未提交的事务修改时返回错误，调用者需要持有 t 的写锁
+func (tx *Tx) conflict(t *tableState, i int) error {
+	if t.xmax.load(i) != 0 {
+		return fmt.Errorf("write conflict: row was changed by another transaction")
+	}
+	return nil
+}
+
+// delete 把第 i 个版本标记为被事务删除，调用者需要持有 t 的写锁
+func (tx *Tx) delete(t *tableState, i int) {
+	atomic.StoreUint64(t.xmax.at(i), tx.id)
+	tx.writes = append(tx.writes, txWrite{table: t, stamp: t.xmax.at(i)})
+	if tx.db.log != nil {
+		tx.log(logOp{Op: opDelete, Table: t.Name, Row: t.row(i)})
+	}
+}
+
+// log 记录提交时写入日志的操作，没有打开日志时不记录
+func (tx *Tx) log(op logOp) {
+	if tx.db.log != nil {
+		tx.ops = append(tx.ops, op)
+	}
+}
+
+// commit 按顺序取得提交时间，标记写入的版本后再发布新的时间，
+// 其他快照要么看到事务的全部写入，要么都看不到。
+// 打开日志时先把写入作为一条记录追加到日志，追加失败时返回错误，调用者需要回滚事务
+func (tx *Tx) commit() error {
+	db := tx.db
+	now := tx.time
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	db.commitMu.Lock()
+	if db.log != nil && len(tx.ops) > 0 {
+		if err := db.appendLog(tx.ops, now); err != nil {
+			db.commitMu.Unlock()
+			return err
+		}
+	}
+	if len(tx.writes) > 0 {
+		db.modified.Add(1)
+	}
+	ts := db.clock.Load() + 1
+	for _, w := range tx.writes {
+		atomic.StoreUint64(w.stamp, ts)
+		w.table.updated = now
+		w.table.changes++
+		if !w.insert {
+			tx.tables[w.table]++
+		}
+	}
+	db.clock.Store(ts)
+	db.commitMu.Unlock()
+	tx.done = true
+	return nil
+}
+
+// rollback 撤销 writes[n:] 中的写入：插入的版本不再可见，删除的版本恢复
+func (tx *Tx) rollback(n int) {
+	for i := len(tx.writes) - 1; i >= n; i-- {
+		w := tx.writes[i]
+		if w.insert {
+			atomic.StoreUint64(w.stamp, never)
+			tx.tables[w.table]++
+		} else {
+			atomic.StoreUint64(w.stamp, 0)
+		}
+	}
+	tx.writes = tx.writes[:n]
+}
+
+// rollbackTo 撤销保存点之后的写入
+func (tx *Tx) rollbackTo(sp savepoint) {
+	tx.rollback(sp.writes)
+	tx.ops = tx.ops[:sp.ops]
+}
+
+// end 结束事务，locked 为调用者已经持有写锁的表。
+// 先从进行中的事务中移除，回收时不再保留只有这个事务能看到的版本
+func (tx *Tx) end(locked *tableState) {
+	tx.done = true
+	tx.db.txMu.Lock()
+	delete(tx.db.active, tx)
+	tx.db.txMu.Unlock()
+	for t, garbage := range tx.tables {
+		if t != locked {
+			t.mu.Lock()
+		}
+		t.writers--
+		t.garbage += garbage
+		t.collect()
+		if t != locked {
+			t.mu.Unlock()
+		}
+	}
+}
+
+// collect 在失效的版本超过一半且没有未提交的写入时回收不再可见的版本，
+// 调用者需要持有写锁。仍然可能被快照看到的版本留到界限推进后再回收。
+// 回收生成新的存储并替换，已经取得旧存储的查询不受影响
+func (t *tableState) collect() {
+	if t.writers > 0 || t.garbage*2 <= t.rows || t.db.recovering {
+		return
+	}
+	// 界限没有推进时不会有新的版本可以回收
+	h := t.db.horizon()
+	if h == t.horizon {
+		return
+	}
+	t.horizon = h
+
+	newPos := make([]int, t.rows)
+	kept, garbage := 0, 0
+	for i := range newPos {
+		xmin, xmax := t.xmin.load(i), t.xmax.load(i)
+		if xmin == never || (xmax != 0 && xmax <= h) {
+			newPos[i] = -1
+			continue
+		}
+		if xmax != 0 {
+			garbage++
+		}
+		newPos[i] = kept
+		kept++
+	}
+	t.garbage = garbage
+	if kept == t.rows {
+		return
+	}
+
+	data := make([]*vector, len(t.data))
+	for j, vec := range t.data {
+		data[j] = newVector(vec.typ, kept)
+	}
+	var xmin, xmax stamps
+	for i, pos := range newPos {
+		if pos < 0 {
+			continue
+		}
+		for j, vec := range t.data {
+			data[j].append(vec.get(i))
+		}
+		xmin.append(t.xmin.load(i))
+		xmax.append(t.xmax.load(i))
+	}
+	t.data, t.xmin, t.xmax = data, xmin, xmax
+	t.rows = kept
+	for _, idx := range t.indexes() {
+		idx.remap(newPos)
+	}
+}
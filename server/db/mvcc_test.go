@@ -0,0 +1,229 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnapshotVisible(t *testing.T) {
+	s := snapshot{ts: 10, id: 3 | txBit}
+	tests := []struct {
+		name       string
+		xmin, xmax uint64
+		want       bool
+	}{
+		{"committed before", 5, 0, true},
+		{"committed at", 10, 0, true},
+		{"committed after", 11, 0, false},
+		{"own insert", 3 | txBit, 0, true},
+		{"other's insert", 4 | txBit, 0, false},
+		{"rolled back", never, 0, false},
+		{"deleted before", 5, 8, false},
+		{"deleted after", 5, 12, true},
+		{"own delete", 5, 3 | txBit, false},
+		{"other's delete", 5, 4 | txBit, true},
+		{"own insert and delete", 3 | txBit, 3 | txBit, false},
+	}
+	for _, tt := range tests {
+		if got := s.visible(tt.xmin, tt.xmax); got != tt.want {
+			t.Errorf("%s: visible(%d, %d) = %v, want %v", tt.name, tt.xmin, tt.xmax, got, tt.want)
+		}
+	}
+}
+
+// newTestDatabase 返回只有表 t (id int PRIMARY KEY, v int) 的数据库
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	database := NewDatabase()
+	columns := []Column{
+		{Name: "id", Type: TypeInt, PrimaryKey: true},
+		{Name: "v", Type: TypeInt, Nullable: true},
+	}
+	if err := database.CreateTable("t", columns); err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func mustTable(t *testing.T, database *Database) *Table {
+	t.Helper()
+	tbl, err := database.GetTable("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tbl
+}
+
+// values 返回 database 中表 t 的各行 id 到 v 的映射
+func values(t *testing.T, database *Database) map[int64]interface{} {
+	t.Helper()
+	result := make(map[int64]interface{})
+	for _, row := range mustTable(t, database).Select(nil) {
+		result[row["id"].(int64)] = row["v"]
+	}
+	return result
+}
+
+func byID(id int64) func(map[string]interface{}) (bool, error) {
+	return func(row map[string]interface{}) (bool, error) { return row["id"] == id, nil }
+}
+
+func TestTransactionVisibility(t *testing.T) {
+	database := newTestDatabase(t)
+	tbl := mustTable(t, database)
+	if _, err := tbl.InsertRows([]map[string]interface{}{{"id": 1, "v": 1}, {"id": 2, "v": 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, release := database.Snapshot()
+	defer release()
+
+	txTable := mustTable(t, tx)
+	if _, err := txTable.Insert(map[string]interface{}{"id": 3, "v": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := txTable.Update(byID(1), map[string]interface{}{"v": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := txTable.Delete(byID(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 事务看到自己的写入，其他读取在提交前看不到
+	if got := values(t, tx); len(got) != 2 || got[1] != int64(10) || got[3] != int64(3) {
+		t.Errorf("inside transaction: %v", got)
+	}
+	if got := values(t, database); len(got) != 2 || got[1] != int64(1) || got[2] != int64(2) {
+		t.Errorf("before commit: %v", got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := values(t, database); len(got) != 2 || got[1] != int64(10) || got[3] != int64(3) {
+		t.Errorf("after commit: %v", got)
+	}
+	// 提交前开始的快照仍然看到原来的数据
+	if got := values(t, snap); len(got) != 2 || got[1] != int64(1) || got[2] != int64(2) {
+		t.Errorf("old snapshot: %v", got)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	database := newTestDatabase(t)
+	if _, err := mustTable(t, database).Insert(map[string]interface{}{"id": 1, "v": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, _ := database.Begin()
+	txTable := mustTable(t, tx)
+	txTable.Insert(map[string]interface{}{"id": 2})
+	if err := tx.Savepoint("sp"); err != nil {
+		t.Fatal(err)
+	}
+	txTable.Insert(map[string]interface{}{"id": 3})
+	txTable.Update(byID(1), map[string]interface{}{"v": 5})
+	if err := tx.RollbackTo("sp"); err != nil {
+		t.Fatal(err)
+	}
+	if got := values(t, tx); len(got) != 2 || got[1] != int64(1) || got[2] != nil {
+		t.Errorf("after ROLLBACK TO: %v", got)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := values(t, database); len(got) != 1 || got[1] != int64(1) {
+		t.Errorf("after ROLLBACK: %v", got)
+	}
+	// 回滚的行不再占用主键
+	if _, err := mustTable(t, database).Insert(map[string]interface{}{"id": 2}); err != nil {
+		t.Errorf("insert rolled back key: %v", err)
+	}
+}
+
+func TestWriteConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		first  func(*Table) error
+		second func(*Table) error
+	}{
+		{
+			"update after uncommitted update",
+			func(tbl *Table) error { return tbl.Update(byID(1), map[string]interface{}{"v": 2}) },
+			func(tbl *Table) error { return tbl.Update(byID(1), map[string]interface{}{"v": 3}) },
+		},
+		{
+			"delete after uncommitted update",
+			func(tbl *Table) error { return tbl.Update(byID(1), map[string]interface{}{"v": 2}) },
+			func(tbl *Table) error { _, err := tbl.Delete(byID(1)); return err },
+		},
+		{
+			"update after uncommitted delete",
+			func(tbl *Table) error { _, err := tbl.Delete(byID(1)); return err },
+			func(tbl *Table) error { return tbl.Update(byID(1), map[string]interface{}{"v": 3}) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			if _, err := mustTable(t, database).Insert(map[string]interface{}{"id": 1, "v": 1}); err != nil {
+				t.Fatal(err)
+			}
+			a, _ := database.Begin()
+			b, _ := database.Begin()
+			if err := tt.first(mustTable(t, a)); err != nil {
+				t.Fatal(err)
+			}
+			// 未提交时后修改的一方立即失败
+			if err := tt.second(mustTable(t, b)); err == nil || !strings.Contains(err.Error(), "write conflict") {
+				t.Errorf("uncommitted: got %v, want write conflict", err)
+			}
+			// 提交后快照早于提交的事务仍然失败
+			if err := a.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.second(mustTable(t, b)); err == nil || !strings.Contains(err.Error(), "write conflict") {
+				t.Errorf("committed: got %v, want write conflict", err)
+			}
+			b.Rollback()
+		})
+	}
+}
+
+// 回收旧版本后数据不变，进行中的快照看到的版本不被回收
+func TestCollect(t *testing.T) {
+	database := newTestDatabase(t)
+	tbl := mustTable(t, database)
+	if _, err := tbl.InsertRows([]map[string]interface{}{{"id": 1, "v": 0}, {"id": 2, "v": 0}}); err != nil {
+		t.Fatal(err)
+	}
+	snap, release := database.Snapshot()
+	for i := 1; i <= 10; i++ {
+		if err := tbl.Update(byID(1), map[string]interface{}{"v": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := values(t, snap); got[1] != int64(0) {
+		t.Errorf("snapshot sees v = %v, want 0", got[1])
+	}
+	release()
+
+	// 快照释放后的下一次写入回收失效的版本
+	if err := tbl.Update(byID(2), map[string]interface{}{"v": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if tbl.rows != 2 {
+		t.Errorf("%d versions after collect, want 2", tbl.rows)
+	}
+	if got := values(t, database); got[1] != int64(10) || got[2] != int64(1) {
+		t.Errorf("after collect: %v", got)
+	}
+	// 回收后索引中的位置也随之更新
+	if err := tbl.Update(byID(1), map[string]interface{}{"id": 2}); err == nil {
+		t.Error("duplicate primary key accepted after collect")
+	}
+}
@@ -0,0 +1,288 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 时间点恢复
+//
+// 从日志序号不超过目标的快照开始，重放日志中到目标为止的记录，把数据库恢复到某条记录或某个时间。
+// 快照可以是数据文件、上一个快照或备份，选择之后的记录都还在日志中的最新的一个；
+// 都不可用时从空数据库开始，这需要日志从第一条记录起都还在。检查点会删除旧的段，
+// 需要恢复到更早的时间时用日志的归档目录保留它们（见 wal.go）。
+//
+// 恢复后的日志序号从日志中最大的序号继续，目标之后被放弃的记录不会在之后的重放中被再次应用
+
+// RecoveryTarget 是时间点恢复的目标。LSN 不为 0 时恢复到该序号的记录为止，
+// 否则恢复到第一条时间晚于 Time 的记录之前
+type RecoveryTarget struct {
+	LSN  uint64
+	Time time.Time
+}
+
+// ParseRecoveryTarget 解析 lsn:N 或时间文本，时间的格式见 ParseTimestamp
+func ParseRecoveryTarget(text string) (RecoveryTarget, error) {
+	text = strings.TrimSpace(text)
+	if rest, ok := strings.CutPrefix(strings.ToLower(text), "lsn:"); ok {
+		lsn, err := strconv.ParseUint(rest, 10, 64)
+		if err != nil || lsn == 0 {
+			return RecoveryTarget{}, fmt.Errorf("invalid recovery target %q", text)
+		}
+		return RecoveryTarget{LSN: lsn}, nil
+	}
+	t, err := ParseTimestamp(text)
+	if err != nil {
+		return RecoveryTarget{}, fmt.Errorf("invalid recovery target %q: expected lsn:N or a timestamp", text)
+	}
+	return RecoveryTarget{Time: t}, nil
+}
+
+func (t RecoveryTarget) String() string {
+	if t.LSN != 0 {
+		return fmt.Sprintf("lsn:%d", t.LSN)
+	}
+	return t.Time.Format(time.RFC3339Nano)
+}
+
+// RecoveryOptions 是时间点恢复的输入。Snapshots 为候选的快照，同时也尝试它们的上一个快照；
+// LogDirs 为日志目录和归档目录，同一个段出现在多个目录中时使用前面的目录中的
+type RecoveryOptions struct {
+	Target    RecoveryTarget
+	Snapshots []string
+	LogDirs   []string
+}
+
+// RecoveryInfo 是时间点恢复的结果
+type RecoveryInfo struct {
+	Snapshot    string    // 作为起点的快照，为空时从空数据库开始
+	SnapshotLSN uint64    // 快照包含的最后一条记录的序号
+	LSN         uint64    // 恢复到的记录的序号
+	Time        time.Time // 最后一条重放的记录的时间，没有重放记录时为零
+	Replayed    int       // 重放的记录数
+	Discarded   uint64    // 日志中目标之后被放弃的记录数
+}
+
+// errRecoveryDone 在重放到目标之后停止读取日志
+var errRecoveryDone = errors.New("recovery target reached")
+
+// Recover 把刚创建的数据库恢复到 options.Target，需要在打开日志之前调用。
+// 恢复的数据还没有保存，调用者随后执行检查点或备份
+func (db *Database) Recover(options RecoveryOptions) (*RecoveryInfo, error) {
+	if err := db.notInTransaction("RECOVER"); err != nil {
+		return nil, err
+	}
+	if db.log != nil {
+		return nil, fmt.Errorf("cannot recover after the write-ahead log is opened")
+	}
+	segments, err := collectSegments(options.LogDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 第一遍只读取序号和时间，确定目标的序号
+	var first, last, target uint64
+	passed := false
+	err = readSegments(segments, func(rec *logRecord) error {
+		if rec.LSN <= last {
+			return nil
+		}
+		if first == 0 {
+			first = rec.LSN
+		}
+		last = rec.LSN
+		if options.Target.LSN == 0 && !passed {
+			if rec.Time.After(options.Target.Time) {
+				passed = true
+			} else {
+				target = rec.LSN
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if first == 0 {
+		return nil, fmt.Errorf("no write-ahead log records found")
+	}
+	switch {
+	case options.Target.LSN != 0:
+		if options.Target.LSN > last {
+			return nil, fmt.Errorf("recovery target lsn %d is after the end of the log (%d)", options.Target.LSN, last)
+		}
+		target = options.Target.LSN
+	case target == 0:
+		// 日志中的第一条记录已经晚于目标时间
+		target = first - 1
+	}
+
+	// 选择序号不超过目标、且之后到目标的记录都在日志中的最新的快照
+	covers := func(data *diskData) bool {
+		if data.LSN == target && target < first && options.Target.LSN == 0 {
+			// 日志中没有不晚于目标时间的记录，只有在目标时间之前写入的快照才确定不包含之后的修改
+			return !data.Updated.After(options.Target.Time)
+		}
+		return data.LSN == target || (data.LSN < target && data.LSN+1 >= first)
+	}
+	info := &RecoveryInfo{LSN: target}
+	var base *diskData
+	files := make(map[string]bool)
+	var loadErr error
+	for _, filename := range snapshotCandidates(options.Snapshots) {
+		data, err := readDiskData(filename)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				loadErr = err
+			}
+			continue
+		}
+		for _, table := range data.Tables {
+			if table.File != "" {
+				files[table.File] = true
+			}
+		}
+		if covers(data) && (base == nil || data.LSN > base.LSN) {
+			base, info.Snapshot, info.SnapshotLSN = data, filename, data.LSN
+		}
+	}
+	if base == nil {
+		// 日志从第一条记录起都还在时从空数据库开始
+		if first != 1 {
+			err := fmt.Errorf("no snapshot to recover to %s from: the log starts at record %d", options.Target, first)
+			if loadErr != nil {
+				err = fmt.Errorf("%v (%v)", err, loadErr)
+			}
+			return nil, err
+		}
+		base = &diskData{
+			Version:   formatVersion,
+			Created:   time.Now().UTC(),
+			Tables:    make(map[string]TableData),
+			Sequences: make(map[string]SequenceData),
+		}
+	}
+
+	if err := db.load(base, true); err != nil {
+		return nil, err
+	}
+	// 快照不一定是数据文件，下一次检查点重新写入所有的表，并保留候选快照引用的表文件
+	for _, table := range db.tables {
+		table.saved = tableFile{}
+	}
+	db.checkpointMu.Lock()
+	db.snapshotFiles = files
+	db.checkpointMu.Unlock()
+
+	r := &replayer{db: db, finders: make(map[*tableState]map[string][]int)}
+	next := base.LSN + 1
+	db.recovering = true
+	err = readSegments(segments, func(rec *logRecord) error {
+		if rec.LSN < next {
+			return nil
+		}
+		if rec.LSN > target {
+			return errRecoveryDone
+		}
+		if rec.LSN != next {
+			return fmt.Errorf("missing records %d-%d", next, rec.LSN-1)
+		}
+		if err := r.apply(rec); err != nil {
+			return fmt.Errorf("record %d: %v", rec.LSN, err)
+		}
+		info.Time = rec.Time
+		info.Replayed++
+		next++
+		return nil
+	})
+	db.recovering = false
+	for _, table := range db.tables {
+		table.collect()
+	}
+	if err != nil && !errors.Is(err, errRecoveryDone) {
+		return nil, err
+	}
+	if next <= target {
+		return nil, fmt.Errorf("missing records %d-%d", next, target)
+	}
+
+	info.Discarded = last - target
+	db.commitMu.Lock()
+	if last > db.lsn {
+		db.lsn = last
+	}
+	db.commitMu.Unlock()
+	return info, nil
+}
+
+// snapshotCandidates 返回候选的快照及其上一个快照，去掉重复的文件
+func snapshotCandidates(snapshots []string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, filename := range snapshots {
+		names := []string{filename}
+		if !strings.HasSuffix(filename, prevSuffix) {
+			names = append(names, previousSnapshot(filename))
+		}
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// collectSegments 返回各目录中的段文件，按第一条记录的序号排列，不存在的目录被忽略
+func collectSegments(dirs []string) ([]string, error) {
+	found := make(map[uint64]string)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		segments, err := listSegments(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, start := range segments {
+			if _, exists := found[start]; !exists {
+				found[start] = segmentPath(dir, start)
+			}
+		}
+	}
+	starts := make([]uint64, 0, len(found))
+	for start := range found {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	paths := make([]string, len(starts))
+	for i, start := range starts {
+		paths[i] = found[start]
+	}
+	return paths, nil
+}
+
+// readSegments 依次读取各段中的记录，不修改文件。只有最后一段的结尾可以不完整，
+// 服务器正在写入日志时也可以读取
+func readSegments(paths []string, fn func(rec *logRecord) error) error {
+	for i, path := range paths {
+		_, err := readSegment(path, fn)
+		if errors.Is(err, errTornRecord) && i == len(paths)-1 {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("write-ahead log %s: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecoveryTarget(t *testing.T) {
+	tests := []struct {
+		text string
+		want RecoveryTarget
+		err  bool
+	}{
+		{"lsn:42", RecoveryTarget{LSN: 42}, false},
+		{" LSN:7 ", RecoveryTarget{LSN: 7}, false},
+		{"2024-03-01 10:00:00", RecoveryTarget{Time: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}, false},
+		{"2024-03-01T10:00:00+08:00", RecoveryTarget{Time: time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)}, false},
+		{"lsn:0", RecoveryTarget{}, true},
+		{"lsn:-1", RecoveryTarget{}, true},
+		{"lsn:", RecoveryTarget{}, true},
+		{"yesterday", RecoveryTarget{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRecoveryTarget(tt.text)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseRecoveryTarget(%q) error = %v, want error %v", tt.text, err, tt.err)
+			continue
+		}
+		if got.LSN != tt.want.LSN || !got.Time.Equal(tt.want.Time) {
+			t.Errorf("ParseRecoveryTarget(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+// recoveryHistory 写入以下历史并返回数据文件名、日志目录、归档目录和每条记录的时间：
+//
+//	1 创建表 t，2 插入 id 1，检查点（序号 2，之后成为上一个快照），
+//	3 插入 id 2，检查点（序号 3，段 1 移入归档目录），4 插入 id 3，5 删除 id 1
+func recoveryHistory(t *testing.T) (filename, logDir, archive string, times map[uint64]time.Time) {
+	t.Helper()
+	dir := t.TempDir()
+	filename = filepath.Join(dir, "database.json")
+	logDir, archive = filepath.Join(dir, "wal"), filepath.Join(dir, "archive")
+
+	database := NewDatabase()
+	if err := database.OpenLog(logDir, LogOptions{Sync: SyncAlways, Archive: archive}); err != nil {
+		t.Fatal(err)
+	}
+	tbl := createTestTable(t, database)
+	tbl.Insert(map[string]interface{}{"id": 1})
+	if err := database.Checkpoint(filename); err != nil {
+		t.Fatal(err)
+	}
+	tbl.Insert(map[string]interface{}{"id": 2})
+	if err := database.Checkpoint(filename); err != nil {
+		t.Fatal(err)
+	}
+	tbl.Insert(map[string]interface{}{"id": 3})
+	tbl.Delete(byID(1))
+	if err := database.CloseLog(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := collectSegments([]string{logDir, archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	times = make(map[uint64]time.Time)
+	err = readSegments(segments, func(rec *logRecord) error {
+		times[rec.LSN] = rec.Time
+		return nil
+	})
+	if err != nil || len(times) != 5 {
+		t.Fatalf("log records %v, %v", times, err)
+	}
+	return filename, logDir, archive, times
+}
+
+func TestRecover(t *testing.T) {
+	filename, logDir, archive, times := recoveryHistory(t)
+	all := []string{logDir, archive}
+	tests := []struct {
+		name     string
+		target   RecoveryTarget
+		logDirs  []string
+		snapshot string // 作为起点的快照，为空时从空数据库开始
+		replayed int
+		ids      []int64
+		err      string
+	}{
+		{"end of log", RecoveryTarget{LSN: 5}, all, filename, 2, []int64{2, 3}, ""},
+		{"data file", RecoveryTarget{LSN: 3}, all, filename, 0, []int64{1, 2}, ""},
+		{"previous snapshot", RecoveryTarget{LSN: 2}, all, filename + prevSuffix, 0, []int64{1}, ""},
+		{"empty database", RecoveryTarget{LSN: 1}, all, "", 1, nil, ""},
+		{"archived log needed", RecoveryTarget{LSN: 1}, []string{logDir}, "", 0, nil, "log starts at record 3"},
+		{"after end", RecoveryTarget{LSN: 6}, all, "", 0, nil, "after the end of the log"},
+		{"time", RecoveryTarget{Time: times[4]}, all, filename, 1, []int64{1, 2, 3}, ""},
+		{"time between records", RecoveryTarget{Time: times[3].Add(-time.Nanosecond)}, all, filename + prevSuffix, 0, []int64{1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := NewDatabase()
+			info, err := database.Recover(RecoveryOptions{Target: tt.target, Snapshots: []string{filename}, LogDirs: tt.logDirs})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Snapshot != tt.snapshot || info.Replayed != tt.replayed || info.Discarded != 5-info.LSN {
+				t.Errorf("recovered from %q replaying %d records, discarding %d; want %q, %d",
+					info.Snapshot, info.Replayed, info.Discarded, tt.snapshot, tt.replayed)
+			}
+			got := values(t, database)
+			if len(got) != len(tt.ids) {
+				t.Fatalf("recovered rows %v, want ids %v", got, tt.ids)
+			}
+			for _, id := range tt.ids {
+				if _, ok := got[id]; !ok {
+					t.Errorf("recovered rows %v, want ids %v", got, tt.ids)
+				}
+			}
+			// 之后的日志序号接在日志的最后一条记录之后
+			if database.lsn != 5 {
+				t.Errorf("lsn after recovery = %d, want 5", database.lsn)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// logOp 是日志记录中的一个操作。行的插入和删除记录整行的值，
+// 重放删除时按值找到对应的行，值完全相同的行可以互相替代
+type logOp struct {
+	Op          string                 `json:"op"`
+	Table       string                 `json:"table,omitempty"`
+	Row         map[string]interface{} `json:"row,omitempty"`
+	Name        string                 `json:"name,omitempty"` // 列名、索引名、序列名或新的表名
+	NewName     string                 `json:"new_name,omitempty"`
+	Columns     []Column               `json:"columns,omitempty"`
+	Constraints []Constraint           `json:"constraints,omitempty"`
+	Column      *Column                `json:"column,omitempty"`
+	Index       *Index                 `json:"index,omitempty"`
+	Sequence    *SequenceData          `json:"sequence,omitempty"`
+}
+
+// 日志中的操作类型
+const (
+	opInsert             = "insert"
+	opDelete             = "delete"
+	opResetAutoIncrement = "reset_auto_increment" // TRUNCATE 重置自增计数器
+	opCreateTable        = "create_table"
+	opDropTable          = "drop_table"
+	opRenameTable        = "rename_table"
+	opAddColumn          = "add_column"
+	opDropColumn         = "drop_column"
+	opRenameColumn       = "rename_column"
+	opModifyColumn       = "modify_column"
+	opCreateIndex        = "create_index"
+	opDropIndex          = "drop_index"
+	opCreateSequence     = "create_sequence"
+	opDropSequence       = "drop_sequence"
+	opSetSequence        = "set_sequence" // NEXTVAL 之后序列的状态
+)
+
+// OpenLog 打开 dir 中的预写日志，重放比已加载的快照新的记录，之后的修改都先写入日志。
+// 应在加载快照之后、开始处理请求之前调用
+func (db *Database) OpenLog(dir string, options LogOptions) error {
+	if err := db.notInTransaction("OPEN LOG"); err != nil {
+		return err
+	}
+	if db.log != nil {
+		return fmt.Errorf("write-ahead log is already open")
+	}
+	if options.Sync == SyncInterval && options.Interval <= 0 {
+		return fmt.Errorf("sync interval must be positive")
+	}
+
+	r := &replayer{db: db, finders: make(map[*tableState]map[string][]int)}
+	from := db.lsn
+	db.recovering = true
+	l, last, err := openLog(dir, options, from, r.apply)
+	db.recovering = false
+	// 重放期间不回收旧版本，避免行的位置改变
+	for _, table := range db.tables {
+		table.collect()
+	}
+	if err != nil {
+		return err
+	}
+	// 重放了记录时数据文件比内存中的数据旧
+	if last > from {
+		db.modified.Add(1)
+	}
+	db.lsn = last
+	db.log = l
+	return nil
+}
+
+// SyncLog 按日志的同步策略等待已经提交的修改写入磁盘，没有打开日志时直接返回
+func (db *Database) SyncLog() error {
+	if db.tx != nil {
+		return db.tx.db.SyncLog()
+	}
+	if db.log == nil {
+		return nil
+	}
+	return db.log.wait()
+}
+
+// LogSize 返回日志的大小，用于决定何时执行检查点
+func (db *Database) LogSize() int64 {
+	if db.log == nil {
+		return 0
+	}
+	return db.log.length()
+}
+
+// CloseLog 写入并关闭日志，之后的修改都会失败
+func (db *Database) CloseLog() error {
+	if db.log == nil {
+		return nil
+	}
+	return db.log.close()
+}
+
+// logOps 记录一次不属于事务的修改（修改表结构、序列等），打开日志时把操作作为一条记录写入日志。
+// 调用者需要持有被修改对象的锁，保证日志中的顺序与执行的顺序相同
+func (db *Database) logOps(ops ...logOp) error {
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+	db.modified.Add(1)
+	if db.log == nil {
+		return nil
+	}
+	return db.appendLog(ops, time.Now().UTC())
+}
+
+// appendLog 分配日志序号并追加在 now 写入的记录，调用者需要持有 commitMu
+func (db *Database) appendLog(ops []logOp, now time.Time) error {
+	rec := &logRecord{LSN: db.lsn + 1, Time: now, Ops: ops}
+	if err := db.log.append(rec); err != nil {
+		return err
+	}
+	db.lsn = rec.LSN
+	return nil
+}
+
+// replayer 把日志记录应用到数据库。finders 按行的值查找每张表中的行，第一次删除时生成
+type replayer struct {
+	db      *Database
+	finders map[*tableState]map[string][]int
+}
+
+func (r *replayer) apply(rec *logRecord) error {
+	db := r.db
+	var tx *Tx
+	for _, op := range rec.Ops {
+		switch op.Op {
+		case opInsert, opDelete, opResetAutoIncrement:
+			table, exists := db.tables[op.Table]
+			if !exists {
+				return fmt.Errorf("table %s does not exist", op.Table)
+			}
+			if tx == nil {
+				tx = db.begin(false)
+				tx.time = rec.Time
+			}
+			if err := tx.write(table.tableState); err != nil {
+				return err
+			}
+			if err := r.applyRow(tx, table, op); err != nil {
+				return fmt.Errorf("table %s: %v", op.Table, err)
+			}
+			continue
+		}
+
+		// 修改表结构后行的值可能改变，重新生成查找用的映射
+		r.finders = make(map[*tableState]map[string][]int)
+		if err := r.applySchema(op); err != nil {
+			return err
+		}
+		if op.Op == opCreateTable {
+			table := db.tables[op.Table]
+			table.created, table.updated = rec.Time, rec.Time
+		}
+	}
+	if tx != nil {
+		if err := tx.commit(); err != nil {
+			return err
+		}
+		tx.end(nil)
+	}
+	db.lsn = rec.LSN
+	return nil
+}
+
+func (r *replayer) applyRow(tx *Tx, t *Table, op logOp) error {
+	switch op.Op {
+	case opResetAutoIncrement:
+		t.AutoIncrement = 0
+		return nil
+	case opInsert:
+		row, err := t.coerceRow(op.Row)
+		if err != nil {
+			return err
+		}
+		t.appendRow(row)
+		tx.insert(t.tableState, row)
+		for _, idx := range t.indexes() {
+			idx.add(row, t.rows-1)
+		}
+		if col := t.autoIncrementColumn(); col != nil {
+			t.advanceAutoIncrement(row[col.Name])
+		}
+		if finder, ok := r.finders[t.tableState]; ok {
+			key := rowKey(t.Columns, row)
+			finder[key] = append(finder[key], t.rows-1)
+		}
+		return nil
+	default:
+		row, err := t.coerceRow(op.Row)
+		if err != nil {
+			return err
+		}
+		finder := r.finder(t)
+		key := rowKey(t.Columns, row)
+		positions := finder[key]
+		if len(positions) == 0 {
+			return fmt.Errorf("deleted row %s not found", key)
+		}
+		tx.delete(t.tableState, positions[len(positions)-1])
+		finder[key] = positions[:len(positions)-1]
+		return nil
+	}
+}
+
+// finder 返回表的行的值到位置的映射
+func (r *replayer) finder(t *Table) map[string][]int {
+	finder, ok := r.finders[t.tableState]
+	if !ok {
+		finder = make(map[string][]int)
+		for _, i := range t.currentRows(0, nil) {
+			key := rowKey(t.Columns, t.row(i))
+			finder[key] = append(finder[key], i)
+		}
+		r.finders[t.tableState] = finder
+	}
+	return finder
+}
+
+func (r *replayer) applySchema(op logOp) error {
+	db := r.db
+	switch op.Op {
+	case opCreateTable:
+		return db.CreateTable(op.Table, op.Columns, op.Constraints...)
+	case opDropTable:
+		return db.DropTable(op.Table, false)
+	case opRenameTable:
+		return db.RenameTable(op.Table, op.Name)
+	case opCreateSequence:
+		return db.CreateSequence(op.Sequence.Name, op.Sequence.Start, op.Sequence.Increment)
+	case opDropSequence:
+		return db.DropSequence(op.Name, false)
+	case opSetSequence:
+		seq, exists := db.sequences[op.Sequence.Name]
+		if !exists {
+			return fmt.Errorf("sequence %s does not exist", op.Sequence.Name)
+		}
+		seq.Current, seq.Used = op.Sequence.Current, op.Sequence.Used
+		return nil
+	}
+
+	table, exists := db.tables[op.Table]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", op.Table)
+	}
+	switch op.Op {
+	case opAddColumn:
+		return table.AddColumn(*op.Column)
+	case opDropColumn:
+		return table.DropColumn(op.Name)
+	case opRenameColumn:
+		return table.RenameColumn(op.Name, op.NewName)
+	case opModifyColumn:
+		return table.ModifyColumn(*op.Column)
+	case opCreateIndex:
+		return table.CreateIndex(op.Index.Name, op.Index.Columns, op.Index.Unique, op.Index.Type)
+	case opDropIndex:
+		return table.DropIndex(op.Name)
+	default:
+		return fmt.Errorf("unknown operation %s", op.Op)
+	}
+}
+
+// coerceRow 按列类型转换日志或数据文件中的一行，省略的列取默认值。
+// 与 load 相同，只检查值的类型
+func (t *tableState) coerceRow(values map[string]interface{}) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, len(t.Columns))
+	for _, col := range t.Columns {
+		val, ok := values[col.Name]
+		if !ok {
+			val = col.Default
+		}
+		col.Nullable = true
+		value, err := storedValue(col, val)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", col.Name, err)
+		}
+		row[col.Name] = value
+	}
+	return row, nil
+}
+
+// rowKey 把一行的所有值编码为字符串，值相同的行得到相同的结果
+func rowKey(columns []Column, row map[string]interface{}) string {
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		values[i] = row[col.Name]
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
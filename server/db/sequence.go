@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sequence 是独立的整数序列，NextVal 依次返回 Start、Start+Increment、...
+type Sequence struct {
+	Name      string
+	Start     int
+	Increment int
+	Current   int  // 最近一次返回的值
+	Used      bool // 是否已经调用过 NextVal
+	mu        sync.Mutex
+}
+
+type SequenceData struct {
+	Name      string `json:"name"`
+	Start     int    `json:"start"`
+	Increment int    `json:"increment"`
+	Current   int    `json:"current"`
+	Used      bool   `json:"used,omitempty"`
+}
+
+// NextVal 推进序列并返回新的值
+func (s *Sequence) NextVal() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Used {
+		s.Current += s.Increment
+	} else {
+		s.Current = s.Start
+		s.Used = true
+	}
+	return s.Current
+}
+
+func (s *Sequence) data() SequenceData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SequenceData{
+		Name:      s.Name,
+		Start:     s.Start,
+		Increment: s.Increment,
+		Current:   s.Current,
+		Used:      s.Used,
+	}
+}
+
+// CreateSequence 创建序列，increment 不能为 0
+func (db *Database) CreateSequence(name string, start, increment int) error {
+	if err := db.notInTransaction("CREATE SEQUENCE"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.sequences[name]; exists {
+		return fmt.Errorf("sequence %s already exists", name)
+	}
+	if increment == 0 {
+		return fmt.Errorf("sequence %s: increment must not be zero", name)
+	}
+
+	seq := &Sequence{Name: name, Start: start, Increment: increment}
+	db.sequences[name] = seq
+	data := seq.data()
+	return db.logOps(logOp{Op: opCreateSequence, Sequence: &data})
+}
+
+// DropSequence 删除序列，ifExists 为 true 时序列不存在也不报错
+func (db *Database) DropSequence(name string, ifExists bool) error {
+	if err := db.notInTransaction("DROP SEQUENCE"); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.sequences[name]; !exists {
+		if ifExists {
+			return nil
+		}
+		return fmt.Errorf("sequence %s does not exist", name)
+	}
+	delete(db.sequences, name)
+	return db.logOps(logOp{Op: opDropSequence, Name: name})
+}
+
+// NextVal 推进指定的序列并返回新的值，在事务视图上调用时直接推进数据库中的序列。
+// 推进和写入日志都在 commitMu 中进行，日志中序列的状态与推进的顺序一致
+func (db *Database) NextVal(name string) (int, error) {
+	if db.tx != nil {
+		return db.tx.db.NextVal(name)
+	}
+	db.mu.RLock()
+	seq, exists := db.sequences[name]
+	db.mu.RUnlock()
+
+	if !exists {
+		return 0, fmt.Errorf("sequence %s does not exist", name)
+	}
+
+	db.commitMu.Lock()
+	defer db.commitMu.Unlock()
+	value := seq.NextVal()
+	db.modified.Add(1)
+	if db.log != nil {
+		data := seq.data()
+		if err := db.appendLog([]logOp{{Op: opSetSequence, Sequence: &data}}, time.Now().UTC()); err != nil {
+			return 0, err
+		}
+	}
+	return value, nil
+}
+
+// validateAutoIncrement 检查自增列：只能是 int 类型、没有默认值，且表中最多只有一个。
+// 自增列总会得到值，因此设为 NOT NULL
+func validateAutoIncrement(columns []Column) error {
+	count := 0
+	for i, col := range columns {
+		if !col.AutoIncrement {
+			continue
+		}
+		count++
+		if col.Type != TypeInt {
+			return fmt.Errorf("column %s: AUTO_INCREMENT requires an int column", col.Name)
+		}
+		if col.Default != nil {
+			return fmt.Errorf("column %s: AUTO_INCREMENT column cannot have a default value", col.Name)
+		}
+		columns[i].Nullable = false
+	}
+	if count > 1 {
+		return fmt.Errorf("multiple AUTO_INCREMENT columns defined")
+	}
+	return nil
+}
+
+// autoIncrementColumn 返回表的自增列，没有时返回 nil
+func (t *Table) autoIncrementColumn() *Column {
+	for i := range t.Columns {
+		if t.Columns[i].AutoIncrement {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// advanceAutoIncrement 在写入的值超过计数器时推进计数器，避免之后生成重复的值
+func (t *Table) advanceAutoIncrement(val interface{}) {
+	if n, ok := intValue(val); ok && int(n) > t.AutoIncrement {
+		t.AutoIncrement = int(n)
+	}
+}
+
+// intValue 把整数值（包括未规范化的 int 和 float64）转换为 int64
+func intValue(val interface{}) (int64, bool) {
+	value, err := Normalize(val)
+	if err != nil {
+		return 0, false
+	}
+	n, ok := value.(int64)
+	return n, ok
+}
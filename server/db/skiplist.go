@@ -0,0 +1,173 @@
+package db
+
+import "math/rand"
+
+const maxLevel = 24
+
+// skiplist 是有序索引的存储结构，按 (键, 行下标) 升序保存，
+// 行下标使相同的键按插入顺序排列，也使每个节点都能被唯一地找到
+type skiplist struct {
+	head  *skipNode
+	level int
+}
+
+type skipNode struct {
+	key  []interface{}
+	pos  int
+	next []*skipNode
+	prev *skipNode // 第 0 层的前一个节点，用于反向遍历
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{head: &skipNode{next: make([]*skipNode, maxLevel)}, level: 1}
+}
+
+func randomLevel() int {
+	level := 1
+	for level < maxLevel && rand.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// less 判断节点是否排在 (key, pos) 之前
+func (n *skipNode) less(key []interface{}, pos int) bool {
+	if cmp := compareKeys(n.key, key); cmp != 0 {
+		return cmp < 0
+	}
+	return n.pos < pos
+}
+
+// findPath 返回每一层中最后一个排在 (key, pos) 之前的节点
+func (sl *skiplist) findPath(key []interface{}, pos int) []*skipNode {
+	path := make([]*skipNode, maxLevel)
+	node := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].less(key, pos) {
+			node = node.next[i]
+		}
+		path[i] = node
+	}
+	return path
+}
+
+func (sl *skiplist) insert(key []interface{}, pos int) {
+	path := sl.findPath(key, pos)
+	level := randomLevel()
+	for i := sl.level; i < level; i++ {
+		path[i] = sl.head
+	}
+	if level > sl.level {
+		sl.level = level
+	}
+
+	node := &skipNode{key: key, pos: pos, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = path[i].next[i]
+		path[i].next[i] = node
+	}
+	if path[0] != sl.head {
+		node.prev = path[0]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node
+	}
+}
+
+// tails 返回用于 append 的每一层的末尾节点，只能用于空的跳表
+func (sl *skiplist) tails() []*skipNode {
+	tails := make([]*skipNode, maxLevel)
+	for i := range tails {
+		tails[i] = sl.head
+	}
+	return tails
+}
+
+// append 把 (key, pos) 追加到末尾，调用方保证它不小于已有的节点
+func (sl *skiplist) append(tails []*skipNode, key []interface{}, pos int) {
+	level := randomLevel()
+	if level > sl.level {
+		sl.level = level
+	}
+	node := &skipNode{key: key, pos: pos, next: make([]*skipNode, level)}
+	if tails[0] != sl.head {
+		node.prev = tails[0]
+	}
+	for i := 0; i < level; i++ {
+		tails[i].next[i] = node
+		tails[i] = node
+	}
+}
+
+func (sl *skiplist) remove(key []interface{}, pos int) {
+	path := sl.findPath(key, pos)
+	node := path[0].next[0]
+	if node == nil || node.pos != pos || compareKeys(node.key, key) != 0 {
+		return
+	}
+	for i := 0; i < len(node.next); i++ {
+		path[i].next[i] = node.next[i]
+	}
+	if node.next[0] != nil {
+		node.next[0].prev = node.prev
+	}
+	for sl.level > 1 && sl.head.next[sl.level-1] == nil {
+		sl.level--
+	}
+}
+
+// seek 返回第一个键的前缀不小于 prefix 的节点
+func (sl *skiplist) seek(prefix []interface{}) *skipNode {
+	node := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && comparePrefix(node.next[i].key, prefix) < 0 {
+			node = node.next[i]
+		}
+	}
+	return node.next[0]
+}
+
+// step 返回升序或降序遍历时的下一个节点
+func (n *skipNode) step(desc bool) *skipNode {
+	if desc {
+		return n.prev
+	}
+	return n.next[0]
+}
+
+// seekLast 返回最后一个键的前缀不大于 prefix 的节点
+func (sl *skiplist) seekLast(prefix []interface{}) *skipNode {
+	node := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && comparePrefix(node.next[i].key, prefix) <= 0 {
+			node = node.next[i]
+		}
+	}
+	if node == sl.head {
+		return nil
+	}
+	return node
+}
+
+// first 返回最小的节点，为空时返回 nil
+func (sl *skiplist) first() *skipNode {
+	return sl.head.next[0]
+}
+
+// compareKeys 按列依次比较两个键
+func compareKeys(a, b []interface{}) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if cmp := Compare(a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return len(a) - len(b)
+}
+
+// comparePrefix 只比较 key 的前 len(prefix) 列
+func comparePrefix(key, prefix []interface{}) int {
+	if len(key) > len(prefix) {
+		key = key[:len(prefix)]
+	}
+	return compareKeys(key, prefix)
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// 快照文件
+//
+// 快照先写入同目录的临时文件并 fsync，再重命名为目标文件并 fsync 目录，
+// 崩溃时目标文件要么是完整的旧快照，要么是完整的新快照。被替换的快照重命名为 .prev 文件保留，
+// 目标文件不存在、不完整或损坏时加载它，检查点也保留它之后的日志。
+// 加载了上一个快照时，损坏的文件重命名为 .corrupt 文件，之后的检查点不会用它替换上一个快照。
+//
+// 文件的最后一行是之前所有内容的 CRC32 校验和，校验失败的快照被拒绝。
+// 没有这一行的旧文件不校验，但内容表明写入了校验和的文件（diskData.Checksum）没有这一行时视为损坏。
+// 编码的内容不以换行结尾时（如二进制格式）补上一个换行，读取时去掉
+
+const (
+	checksumPrefix = "#crc32="
+	prevSuffix     = ".prev"
+)
+
+// errCorruptSnapshot 表示快照的校验和不匹配或缺失
+var errCorruptSnapshot = errors.New("corrupt snapshot")
+
+// previousSnapshot 返回保留的上一个快照的文件名
+func previousSnapshot(filename string) string {
+	return filename + prevSuffix
+}
+
+// corruptSnapshot 返回损坏的快照被移到的文件名
+func corruptSnapshot(filename string) string {
+	return filename + ".corrupt"
+}
+
+// writeSnapshot 用 encode 写入快照并替换 filename，原有的文件成为上一个快照
+func writeSnapshot(filename string, encode func(w io.Writer) error) error {
+	tmp := filename + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// 失败时删除临时文件，成功重命名后删除不存在的文件没有影响
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	hw := &hashWriter{w: w, hash: crc32.NewIEEE()}
+	if err := encode(hw); err != nil {
+		return err
+	}
+	if hw.last != '\n' {
+		if _, err := hw.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "%s%08x\n", checksumPrefix, hw.hash.Sum32()); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filename); err == nil {
+		if err := os.Rename(filename, previousSnapshot(filename)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filename))
+}
+
+// hashWriter 计算写入内容的校验和，并记录最后写入的字节
+type hashWriter struct {
+	w    io.Writer
+	hash hash.Hash32
+	last byte
+}
+
+func (hw *hashWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	hw.hash.Write(p)
+	hw.last = p[len(p)-1]
+	return hw.w.Write(p)
+}
+
+// readSnapshot 读取快照并检查校验和，返回去掉校验和及其之前的换行后的内容。
+// 文件没有校验和时 checked 为 false，由调用者判断是否为旧的文件
+func readSnapshot(filename string) (body []byte, checked bool, err error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false, err
+	}
+	i := bytes.LastIndex(content, []byte("\n"+checksumPrefix))
+	if i < 0 {
+		return content, false, nil
+	}
+	body, trailer := content[:i+1], bytes.TrimSpace(content[i+1+len(checksumPrefix):])
+	sum, err := strconv.ParseUint(string(trailer), 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(body) {
+		return nil, false, fmt.Errorf("%s: checksum mismatch: %w", filename, errCorruptSnapshot)
+	}
+	return body[:i], true, nil
+}
+
+// syncDir fsync 目录，使目录中文件的创建和重命名写入磁盘
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
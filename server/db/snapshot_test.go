@@ -0,0 +1,109 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// saveValues 把表 t 的 v 列都改为 v 后保存到 filename
+func saveValues(t *testing.T, database *Database, filename string, v int) {
+	t.Helper()
+	if err := mustTable(t, database).Update(nil, map[string]interface{}{"v": v}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Checkpoint(filename); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadValues 加载 filename 并返回表 t 的内容
+func loadValues(t *testing.T, filename string) map[int64]interface{} {
+	t.Helper()
+	database := NewDatabase()
+	if err := database.LoadFromDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	return values(t, database)
+}
+
+// 数据文件损坏时加载上一个快照，之后的检查点不会用损坏的文件替换上一个快照
+func TestSnapshotFallbackKeepsPrevious(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "data.json")
+	database := newTestDatabase(t)
+	if _, err := mustTable(t, database).Insert(map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	saveValues(t, database, filename, 1)
+	saveValues(t, database, filename, 2)
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)/2] ^= 0xff
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewDatabase()
+	if err := loaded.LoadFromDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	if got := values(t, loaded); got[1] != int64(1) {
+		t.Errorf("after fallback: %v, want the previous snapshot", got)
+	}
+	if _, err := os.Stat(filename + ".corrupt"); err != nil {
+		t.Errorf("corrupt file was not moved aside: %v", err)
+	}
+
+	saveValues(t, loaded, filename, 3)
+	if got := loadValues(t, previousSnapshot(filename)); got[1] != int64(1) {
+		t.Errorf("previous snapshot after checkpoint: %v, want v = 1", got)
+	}
+	if got := loadValues(t, filename); got[1] != int64(3) {
+		t.Errorf("data file after checkpoint: %v, want v = 3", got)
+	}
+}
+
+// 写入了校验和的文件缺少校验和时视为损坏，早期没有校验和的文件正常加载
+func TestSnapshotMissingChecksum(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.json")
+	database := newTestDatabase(t)
+	if _, err := mustTable(t, database).Insert(map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	saveValues(t, database, filename, 1)
+	saveValues(t, database, filename, 2)
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.LastIndex(content, []byte(checksumPrefix))
+	if i < 0 {
+		t.Fatal("snapshot has no checksum")
+	}
+	if err := os.WriteFile(filename, content[:i], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readDiskData(filename); !errors.Is(err, errCorruptSnapshot) {
+		t.Errorf("readDiskData without checksum: got %v, want errCorruptSnapshot", err)
+	}
+	if got := loadValues(t, filename); got[1] != int64(1) {
+		t.Errorf("after fallback: %v, want the previous snapshot", got)
+	}
+
+	legacy := filepath.Join(dir, "legacy.json")
+	old := `{"tables":{"t":{"name":"t","columns":[{"name":"id","type":0},{"name":"v","type":0,"nullable":true}],` +
+		`"rows":[{"id":1,"v":5}]}}}` + "\n"
+	if err := os.WriteFile(legacy, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadValues(t, legacy); got[1] != int64(5) {
+		t.Errorf("legacy file: %v, want v = 5", got)
+	}
+}
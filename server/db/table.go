@@ -2,137 +2,351 @@ package db
 
 import (
 	"fmt"
-	"reflect"
+	"sort"
+	"time"
 )
 
-// Insert 插入一行数据
-func (t *Table) Insert(values map[string]interface{}) error {
+// Insert 插入一行数据，返回自增列的值，表没有自增列时返回 0
+func (t *Table) Insert(values map[string]interface{}) (id int, err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	tx, err := t.writeTx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = t.finish(tx, err) }()
+
+	return t.insert(tx, values)
+}
+
+// InsertRows 在一次写入中插入多行，返回每一行自增列的值，表没有自增列时返回 nil。
+// 任何一行失败时所有的行都不插入，自增计数器也恢复原值；在事务中执行时只撤销这次写入插入的行
+func (t *Table) InsertRows(rows []map[string]interface{}) (ids []int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, err := t.writeTx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = t.finish(tx, err) }()
+
+	start := savepoint{writes: len(tx.writes), ops: len(tx.ops)}
+	counter := t.AutoIncrement
+	for i, values := range rows {
+		id, err := t.insert(tx, values)
+		if err != nil {
+			if !tx.auto {
+				tx.rollbackTo(start)
+			}
+			t.AutoIncrement = counter
+			if len(rows) > 1 {
+				err = fmt.Errorf("row %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		if id != 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// insert 在事务 tx 中插入一行，调用者需要持有写锁
+func (t *Table) insert(tx *Tx, values map[string]interface{}) (id int, err error) {
+	if err := t.checkColumnNames(values); err != nil {
+		return 0, err
+	}
+
 	// 创建一个新的行，确保所有列都有值
 	row := make(map[string]interface{})
 	
-	// 验证并设置每个列的值
+	// 验证并设置每个列的值，省略的列取默认值
 	for _, col := range t.Columns {
 		val, ok := values[col.Name]
 		if !ok {
-			return fmt.Errorf("missing value for column %s", col.Name)
+			val = col.Default
+		}
+		if col.AutoIncrement && val == nil {
+			val = t.AutoIncrement + 1
 		}
 
-		// 验证值类型
-		if err := validateValueType(col, val); err != nil {
-			return fmt.Errorf("column %s: %v", col.Name, err)
+		// 验证值类型并转换为列类型的值
+		value, err := coerceValue(col, val)
+		if err != nil {
+			return 0, fmt.Errorf("column %s: %v", col.Name, err)
 		}
+		row[col.Name] = value
+	}
 
-		row[col.Name] = val
+	skip := func(pos int) bool { return !t.current(pos, tx.id) }
+	indexes := t.indexes()
+	for _, idx := range indexes {
+		if err := idx.check(row, skip); err != nil {
+			return 0, err
+		}
+	}
+	t.appendRow(row)
+	tx.insert(t.tableState, row)
+	for _, idx := range indexes {
+		idx.add(row, t.rows-1)
 	}
 
-	t.Rows = append(t.Rows, row)
-	return nil
+	if col := t.autoIncrementColumn(); col != nil {
+		n, _ := intValue(row[col.Name])
+		id = int(n)
+		t.advanceAutoIncrement(id)
+	}
+	return id, nil
 }
 
-// Select 查询数据
-func (t *Table) Select(condition func(map[string]interface{}) bool) []map[string]interface{} {
+// Select 查询数据，lookups 为条件中的等值部分，用于选择索引。
+// 只在取得存储和查找索引时持有读锁，条件在锁外求值
+func (t *Table) Select(condition func(map[string]interface{}) bool, lookups ...Lookup) []map[string]interface{} {
 	t.mu.RLock()
-	defer t.mu.RUnlock()
+	v := t.view(t.readSnapshot())
+	positions, ok := t.candidates(lookups)
+	t.mu.RUnlock()
 
 	result := make([]map[string]interface{}, 0)
-	for _, row := range t.Rows {
-		if condition == nil || condition(row) {
-			// 创建行的副本
-			rowCopy := make(map[string]interface{})
-			for k, v := range row {
-				rowCopy[k] = v
+	for _, i := range v.match(condition, positions, ok) {
+		// 创建行的副本
+		result = append(result, v.row(i))
+	}
+	return result
+}
+
+// SelectOrdered 按 columns 的顺序返回满足条件的前 limit 行，desc 为 true 时按降序，
+// 排序的值相同的行按插入顺序排列，与对全表稳定排序的结果相同。
+// 需要有能按该顺序提供行的有序索引，没有时返回 false，调用方需要自己排序
+func (t *Table) SelectOrdered(condition func(map[string]interface{}) bool, columns []string, desc bool,
+	limit int, lookups ...Lookup) ([]map[string]interface{}, bool) {
+	v, runs, ok := t.orderedRuns(columns, desc, lookups)
+	if !ok {
+		return nil, false
+	}
+
+	// 排序的值相同的一组行按下标排序后再依次检查条件
+	result := make([]map[string]interface{}, 0)
+	scratch := make(map[string]interface{}, len(v.columns))
+	for _, run := range runs {
+		if len(result) >= limit {
+			break
+		}
+		sort.Ints(run)
+		for _, i := range run {
+			if condition == nil || condition(v.fill(i, scratch)) {
+				result = append(result, v.row(i))
+				if len(result) == limit {
+					break
+				}
 			}
-			result = append(result, rowCopy)
 		}
 	}
-	return result
+	return result, true
+}
+
+// orderedRuns 在读锁内按有序索引的顺序取得可见的行，排序的值相同的行分为一组。
+// 没有合适的有序索引时返回 false
+func (t *Table) orderedRuns(columns []string, desc bool, lookups []Lookup) (*tableView, [][]int, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	lookups = t.coerceLookups(lookups)
+	equal := equalValues(lookups)
+	idx, k := t.orderedIndex(columns, equal)
+	if idx == nil {
+		return nil, nil, false
+	}
+	v := t.view(t.readSnapshot())
+	low, high, ok := idx.bounds(equal, lookups)
+	if !ok {
+		return v, nil, true
+	}
+
+	var node *skipNode
+	if desc {
+		node = idx.tree.seekLast(high)
+	} else {
+		node = idx.tree.seek(low)
+	}
+	inRange := func(n *skipNode) bool {
+		return n != nil && comparePrefix(n.key, low) >= 0 && comparePrefix(n.key, high) <= 0
+	}
+	orderKey := func(n *skipNode) []interface{} {
+		return n.key[k : k+len(columns)]
+	}
+
+	runs := make([][]int, 0)
+	var last *skipNode
+	for ; inRange(node); node = node.step(desc) {
+		if !v.visible(node.pos) {
+			continue
+		}
+		if last == nil || compareKeys(orderKey(last), orderKey(node)) != 0 {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], node.pos)
+		last = node
+	}
+	return v, runs, true
 }
 
-// Update 更新数据
-func (t *Table) Update(condition func(map[string]interface{}) bool, values map[string]interface{}) error {
+// Update 更新数据，lookups 为条件中的等值部分，用于选择索引。
+// 被更新的行标记为删除，更新后的行作为新的版本追加。条件求值出错时不更新任何行
+func (t *Table) Update(condition func(map[string]interface{}) (bool, error), values map[string]interface{}, lookups ...Lookup) (err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	tx, err := t.writeTx()
+	if err != nil {
+		return err
+	}
+	defer func() { err = t.finish(tx, err) }()
+
+	if err := t.checkColumnNames(values); err != nil {
+		return err
+	}
+
 	// 首先验证所有要更新的值的类型
+	coerced := make(map[string]interface{}, len(values))
 	for _, col := range t.Columns {
 		if val, ok := values[col.Name]; ok {
-			if err := validateValueType(col, val); err != nil {
+			value, err := coerceValue(col, val)
+			if err != nil {
 				return fmt.Errorf("column %s: %v", col.Name, err)
 			}
+			coerced[col.Name] = value
 		}
 	}
+	values = coerced
 
-	// 执行更新
-	updated := false
-	for i, row := range t.Rows {
-		if condition == nil || condition(row) {
-			updated = true
-			// 只更新指定的列
-			for colName, val := range values {
-				row[colName] = val
-			}
-			t.Rows[i] = row
+	matched, err := t.matching(tx.snapshot(), condition, lookups)
+	if err != nil {
+		return err
+	}
+	if len(matched) == 0 {
+		return fmt.Errorf("no matching records found")
+	}
+	for _, i := range matched {
+		if err := tx.conflict(t.tableState, i); err != nil {
+			return err
 		}
 	}
 
-	if !updated {
-		return fmt.Errorf("no matching records found")
+	// 生成更新后的行，检查约束通过后再写入
+	changed := make(map[int]map[string]interface{}, len(matched))
+	newRows := make([]map[string]interface{}, len(matched))
+	for j, i := range matched {
+		// 只更新指定的列
+		newRow := t.row(i)
+		for colName, val := range values {
+			newRow[colName] = val
+		}
+		changed[i] = newRow
+		newRows[j] = newRow
+	}
+
+	skip := func(pos int) bool {
+		_, ok := changed[pos]
+		return ok || !t.current(pos, tx.id)
+	}
+	indexes := t.indexes()
+	for _, idx := range indexes {
+		if err := idx.checkUpdate(changed, skip); err != nil {
+			return err
+		}
+	}
+
+	for j, i := range matched {
+		tx.delete(t.tableState, i)
+		t.appendRow(newRows[j])
+		tx.insert(t.tableState, newRows[j])
+		for _, idx := range indexes {
+			idx.add(newRows[j], t.rows-1)
+		}
+	}
+	if col := t.autoIncrementColumn(); col != nil {
+		t.advanceAutoIncrement(values[col.Name])
 	}
 	return nil
 }
 
-// Delete 删除数据
-func (t *Table) Delete(condition func(map[string]interface{}) bool) (int, error) {
+// Delete 删除数据，lookups 为条件中的等值部分，用于选择索引。
+// 被删除的行只是标记为删除，不再可见后由 collect 回收。条件求值出错时不删除任何行
+func (t *Table) Delete(condition func(map[string]interface{}) (bool, error), lookups ...Lookup) (deletedCount int, err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	originalLen := len(t.Rows)
-	newRows := make([]map[string]interface{}, 0, originalLen)
-	
-	for _, row := range t.Rows {
-		if condition == nil || !condition(row) {
-			newRows = append(newRows, row)
-		}
+	tx, err := t.writeTx()
+	if err != nil {
+		return 0, err
 	}
+	defer func() { err = t.finish(tx, err) }()
 
-	deletedCount := originalLen - len(newRows)
+	matched, err := t.matching(tx.snapshot(), condition, lookups)
+	if err != nil {
+		return 0, err
+	}
+	deletedCount = len(matched)
 	if deletedCount == 0 {
 		return 0, fmt.Errorf("no matching records found")
 	}
-
-	t.Rows = newRows
+	for _, i := range matched {
+		if err := tx.conflict(t.tableState, i); err != nil {
+			return 0, err
+		}
+	}
+	for _, i := range matched {
+		tx.delete(t.tableState, i)
+	}
 	return deletedCount, nil
 }
 
-// 辅助函数：验证值类型
-func validateValueType(col Column, val interface{}) error {
-	switch col.Type {
-	case TypeInt:
-		switch v := val.(type) {
-		case int:
-			return nil
-		case float64:
-			// JSON 解码可能会将整数解析为 float64
-			if v == float64(int(v)) {
-				return nil
-			}
-			return fmt.Errorf("expected integer value, got float")
-		default:
-			return fmt.Errorf("expected int, got %v", reflect.TypeOf(val))
+// Truncate 删除表中的所有行并重置自增计数器，返回删除的行数。
+// 在事务中执行时不重置自增计数器，因为计数器的修改无法回滚
+func (t *Table) Truncate() (count int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tx, err := t.writeTx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { err = t.finish(tx, err) }()
+
+	matched, _ := t.matching(tx.snapshot(), nil, nil)
+	for _, i := range matched {
+		if err := tx.conflict(t.tableState, i); err != nil {
+			return 0, err
 		}
-	
-	case TypeString:
-		if _, ok := val.(string); !ok {
-			return fmt.Errorf("expected string, got %v", reflect.TypeOf(val))
+	}
+	for _, i := range matched {
+		tx.delete(t.tableState, i)
+	}
+	if tx.auto {
+		t.AutoIncrement = 0
+		tx.log(logOp{Op: opResetAutoIncrement, Table: t.Name})
+	}
+	return len(matched), nil
+}
+
+// matching 返回对快照可见且满足条件的行下标（升序），有可用的索引时只检查索引找到的行。
+// 条件求值出错时返回错误。调用者需要持有锁
+func (t *Table) matching(s snapshot, condition func(map[string]interface{}) (bool, error), lookups []Lookup) ([]int, error) {
+	positions, ok := t.candidates(lookups)
+	return t.view(s).filter(condition, positions, ok)
+}
+
+// checkColumnNames 确认 values 中的列都存在
+func (t *Table) checkColumnNames(values map[string]interface{}) error {
+	for name := range values {
+		if columnIndex(t.Columns, name) < 0 {
+			return fmt.Errorf("column %s does not exist", name)
 		}
-		return nil
-	
-	default:
-		return fmt.Errorf("unsupported column type: %v", col.Type)
 	}
+	return nil
 }
 
 // GetColumns 返回表的列定义
@@ -149,6 +363,266 @@ func (t *Table) GetColumns() []Column {
 // RowCount 返回表中的行数
 func (t *Table) RowCount() int {
 	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return len(t.Rows)
-} 
\ No newline at end of file
+	v := t.view(t.readSnapshot())
+	t.mu.RUnlock()
+	return len(v.match(nil, nil, false))
+}
+
+// newTable 创建空表，为每一列分配存储
+func newTable(db *Database, name string, columns []Column, constraints []Constraint) *Table {
+	now := time.Now().UTC()
+	t := &Table{tableState: &tableState{Name: name, Columns: columns, Constraints: constraints, db: db, created: now, updated: now}}
+	t.keys = keyIndexes(columns, constraints)
+	t.resetRows()
+	return t
+}
+
+// resetRows 清空所有行，重新分配每一列的存储
+func (t *Table) resetRows() {
+	t.data = make([]*vector, len(t.Columns))
+	for i, col := range t.Columns {
+		t.data[i] = newVector(col.Type, 0)
+	}
+	t.xmin, t.xmax = stamps{}, stamps{}
+	t.rows = 0
+}
+
+// appendRow 追加一行的值，row 中的值需要已经通过类型检查。
+// 调用者还需要追加这一行的创建和删除时间
+func (t *Table) appendRow(row map[string]interface{}) {
+	for i, col := range t.Columns {
+		t.data[i].append(row[col.Name])
+	}
+	t.rows++
+}
+
+// row 返回第 i 行的副本
+func (t *tableState) row(i int) map[string]interface{} {
+	return t.fill(i, make(map[string]interface{}, len(t.Columns)))
+}
+
+// fill 把第 i 行的值写入 row 并返回 row
+func (t *tableState) fill(i int, row map[string]interface{}) map[string]interface{} {
+	return fillRow(t.Columns, t.data, i, row)
+}
+
+func fillRow(columns []Column, data []*vector, i int, row map[string]interface{}) map[string]interface{} {
+	for j, col := range columns {
+		row[col.Name] = data[j].get(i)
+	}
+	return row
+}
+
+// tableImage 是保存时取得的表，包括表的定义和快照中的存储。
+// changes 为取得映像时表的修改计数，positions 为快照中可见的行，第一次使用时查找
+type tableImage struct {
+	data      TableData // 没有行
+	view      *tableView
+	state     *tableState
+	changes   uint64
+	positions []int
+}
+
+// image 取得表的定义和在快照 s 中的存储，调用者需要持有锁和 commitMu
+func (t *tableState) image(s snapshot) tableImage {
+	data := TableData{
+		Name:          t.Name,
+		Columns:       append([]Column(nil), t.Columns...),
+		Constraints:   make([]Constraint, len(t.Constraints)),
+		AutoIncrement: t.AutoIncrement,
+		Indexes:       make([]*Index, len(t.Indexes)),
+		Created:       t.created,
+		Updated:       t.updated,
+	}
+	for i, c := range t.Constraints {
+		data.Constraints[i] = Constraint{Primary: c.Primary, Columns: append([]string(nil), c.Columns...)}
+	}
+	for i, idx := range t.Indexes {
+		data.Indexes[i] = &Index{Name: idx.Name, Columns: append([]string(nil), idx.Columns...), Unique: idx.Unique, Type: idx.Type}
+	}
+	return tableImage{data: data, view: t.view(s), state: t, changes: t.changes}
+}
+
+// visible 返回快照中可见的行
+func (img *tableImage) visible() []int {
+	if img.positions == nil {
+		img.positions = img.view.match(nil, nil, false)
+	}
+	return img.positions
+}
+
+// tableData 返回保存的表，读取存储不需要持有锁
+func (img *tableImage) tableData() TableData {
+	data := img.data
+	positions := img.visible()
+	data.RowCount = len(positions)
+	data.Rows = make([]map[string]interface{}, len(positions))
+	for j, i := range positions {
+		data.Rows[j] = img.view.row(i)
+	}
+	return data
+}
+
+// load 把保存的行写入表，值按列类型转换（如 JSON 解码得到的 json.Number 转换为整数或浮点数，
+// 时间文本解析为时间）。早期的数据文件可能在非空列中有 NULL，这里只检查值的类型。
+// 加载的行视为在时间 0 提交，对所有快照可见
+func (t *Table) load(rows []map[string]interface{}) error {
+	for i, row := range rows {
+		values, err := t.coerceRow(row)
+		if err != nil {
+			return fmt.Errorf("row %d: %v", i+1, err)
+		}
+		t.appendRow(values)
+		t.xmin.append(0)
+		t.xmax.append(0)
+	}
+	return nil
+}
+
+// readSnapshot 返回查询使用的快照：绑定事务的句柄使用事务的快照，
+// 否则使用最近一次提交的时间。调用者需要持有锁
+func (t *Table) readSnapshot() snapshot {
+	if t.tx != nil {
+		return t.tx.snapshot()
+	}
+	return snapshot{ts: t.db.clock.Load()}
+}
+
+// writeTx 返回写入使用的事务：绑定事务的句柄使用该事务，否则开始一个只包含这次写入的事务。
+// 调用者需要持有写锁，并在写入结束后调用 finish
+func (t *Table) writeTx() (*Tx, error) {
+	if t.dropped {
+		return nil, fmt.Errorf("table %s does not exist", t.Name)
+	}
+	tx := t.tx
+	if tx == nil {
+		tx = t.db.begin(false)
+		tx.auto = true
+	}
+	if err := tx.write(t.tableState); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// finish 结束自动提交的事务，err 为 nil 时提交，否则回滚。返回写入最终的错误
+func (t *Table) finish(tx *Tx, err error) error {
+	if !tx.auto {
+		return err
+	}
+	if err == nil {
+		err = tx.commit()
+	}
+	if err != nil {
+		tx.rollback(0)
+	}
+	tx.end(t.tableState)
+	return err
+}
+
+// current 判断第 i 行是否属于表的最新状态，用于检查唯一约束：
+// 除了 id 对应的事务删除的行和回滚的行之外，其他事务未提交的插入和删除都按已经生效之前计算
+func (t *tableState) current(i int, id uint64) bool {
+	if t.xmin.load(i) == never {
+		return false
+	}
+	xmax := t.xmax.load(i)
+	return xmax == 0 || (xmax&txBit != 0 && xmax != id)
+}
+
+// latest 判断第 i 行是否属于表的最新状态，不排除任何事务删除的行
+func (t *tableState) latest(i int) bool {
+	return t.current(i, 0)
+}
+
+// currentRows 返回属于表的最新状态的行下标，skip 不为 nil 时跳过它返回 true 的行
+func (t *tableState) currentRows(id uint64, skip func(i int) bool) []int {
+	rows := make([]int, 0, t.rows)
+	for i := 0; i < t.rows; i++ {
+		if t.current(i, id) && (skip == nil || !skip(i)) {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// tableView 是查询取得的表的存储。取得之后读取不需要持有锁：
+// 写入只会追加新的行或原子地修改行的时间，回收和修改列会生成新的存储而不改动原有的存储
+type tableView struct {
+	columns []Column
+	data    []*vector
+	xmin    stamps
+	xmax    stamps
+	rows    int
+	snap    snapshot
+}
+
+// view 取得表当前的存储，调用者需要持有锁
+func (t *tableState) view(s snapshot) *tableView {
+	v := &tableView{
+		columns: append([]Column(nil), t.Columns...),
+		data:    make([]*vector, len(t.data)),
+		xmin:    t.xmin,
+		xmax:    t.xmax,
+		rows:    t.rows,
+		snap:    s,
+	}
+	for i, vec := range t.data {
+		copied := *vec
+		v.data[i] = &copied
+	}
+	return v
+}
+
+func (v *tableView) visible(i int) bool {
+	return v.snap.visible(v.xmin.load(i), v.xmax.load(i))
+}
+
+func (v *tableView) row(i int) map[string]interface{} {
+	return v.fill(i, make(map[string]interface{}, len(v.columns)))
+}
+
+func (v *tableView) fill(i int, row map[string]interface{}) map[string]interface{} {
+	return fillRow(v.columns, v.data, i, row)
+}
+
+// match 返回可见且满足条件的行下标（升序）。indexed 为 true 时只检查 positions 中的行，
+// 否则检查所有的行
+func (v *tableView) match(condition func(map[string]interface{}) bool, positions []int, indexed bool) []int {
+	var check func(map[string]interface{}) (bool, error)
+	if condition != nil {
+		check = func(row map[string]interface{}) (bool, error) { return condition(row), nil }
+	}
+	matched, _ := v.filter(check, positions, indexed)
+	return matched
+}
+
+// filter 与 match 相同，但条件可以返回错误，遇到第一个错误时停止并返回它
+func (v *tableView) filter(condition func(map[string]interface{}) (bool, error), positions []int, indexed bool) ([]int, error) {
+	if !indexed {
+		positions = make([]int, v.rows)
+		for i := range positions {
+			positions[i] = i
+		}
+	}
+
+	// 条件函数在同一个 map 上依次求值，不能保留传入的行
+	matched := make([]int, 0)
+	scratch := make(map[string]interface{}, len(v.columns))
+	for _, i := range positions {
+		if !v.visible(i) {
+			continue
+		}
+		if condition != nil {
+			ok, err := condition(v.fill(i, scratch))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		matched = append(matched, i)
+	}
+	return matched, nil
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestTable(t *testing.T) *Table {
+	t.Helper()
+	database := NewDatabase()
+	if err := database.CreateTable("t", []Column{{Name: "id", Type: TypeInt}, {Name: "name", Type: TypeString}}); err != nil {
+		t.Fatal(err)
+	}
+	table, err := database.GetTable("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		if _, err := table.Insert(map[string]interface{}{"id": i + 1, "name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return table
+}
+
+// failAt 返回在第 n 次调用时出错的条件，之前的行都匹配
+func failAt(n int) func(map[string]interface{}) (bool, error) {
+	calls := 0
+	return func(map[string]interface{}) (bool, error) {
+		calls++
+		if calls == n {
+			return false, errors.New("boom")
+		}
+		return true, nil
+	}
+}
+
+func TestWriteConditionError(t *testing.T) {
+	table := newTestTable(t)
+	want := table.Select(nil)
+
+	if err := table.Update(failAt(2), map[string]interface{}{"name": "x"}); err == nil {
+		t.Error("Update succeeded, want error")
+	}
+	if n, err := table.Delete(failAt(3)); err == nil {
+		t.Errorf("Delete deleted %d rows, want error", n)
+	}
+	if got := table.Select(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows changed after failed writes:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestLoadFromDiskFailureKeepsTables(t *testing.T) {
+	database := NewDatabase()
+	if err := database.CreateTable("t", []Column{{Name: "id", Type: TypeInt}}); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "database.json")
+	if err := os.WriteFile(filename, []byte(`{"u": {"name": "u", "columns": [`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.LoadFromDisk(filename); err == nil {
+		t.Fatal("LoadFromDisk succeeded, want error")
+	}
+	if _, err := database.GetTable("t"); err != nil {
+		t.Errorf("table t lost after failed load: %v", err)
+	}
+}
+
+func TestLoadFromDiskDuplicateKey(t *testing.T) {
+	database := NewDatabase()
+	if err := database.CreateTable("t", []Column{{Name: "id", Type: TypeInt}}); err != nil {
+		t.Fatal(err)
+	}
+	// 数据文件中 id 为 1 的行重复，加载失败且原有的表不变
+	filename := filepath.Join(t.TempDir(), "database.json")
+	data := `{"u": {"name": "u", "columns": [{"name": "id", "type": 0, "primary_key": true}], "rows": [{"id": 1}, {"id": 1}]}}`
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := database.LoadFromDisk(filename)
+	var constraintErr *ConstraintError
+	if !errors.As(err, &constraintErr) {
+		t.Fatalf("LoadFromDisk error = %v, want ConstraintError", err)
+	}
+	if _, err := database.GetTable("t"); err != nil {
+		t.Errorf("table t lost after failed load: %v", err)
+	}
+}
+
+// jsonDocs 是 json 列的测试数据：字符串、数值和对象文档
+var jsonDocs = []string{`"hello"`, `2.5`, `{"a":[1,"x"],"b":null}`}
+
+// newTypedTable 创建包含各种列类型的表 t，第 i 行的 doc 列为 jsonDocs[i]
+func newTypedTable(t *testing.T, database *Database) *Table {
+	t.Helper()
+	columns := []Column{
+		{Name: "id", Type: TypeInt},
+		{Name: "f", Type: TypeFloat, Nullable: true},
+		{Name: "b", Type: TypeBool, Nullable: true},
+		{Name: "ts", Type: TypeTimestamp, Nullable: true},
+		{Name: "data", Type: TypeBytes, Nullable: true},
+		{Name: "doc", Type: TypeJSON, Nullable: true},
+	}
+	if err := database.CreateTable("t", columns); err != nil {
+		t.Fatal(err)
+	}
+	table, err := database.GetTable("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, doc := range jsonDocs {
+		row := map[string]interface{}{
+			"id":   i + 1,
+			"f":    1.5,
+			"b":    true,
+			"ts":   "2024-01-02T03:04:05.123456789Z",
+			"data": []byte{0, 1, 255},
+			"doc":  doc,
+		}
+		if _, err := table.Insert(row); err != nil {
+			t.Fatalf("insert %s: %v", doc, err)
+		}
+	}
+	return table
+}
+
+func TestJSONSnapshotRoundTrip(t *testing.T) {
+	database := NewDatabase()
+	want := newTypedTable(t, database).Select(nil)
+	for i, row := range want {
+		if got := row["doc"]; got != JSON(jsonDocs[i]) {
+			t.Errorf("doc %d = %#v, want %s", i, got, jsonDocs[i])
+		}
+	}
+
+	filename := filepath.Join(t.TempDir(), "database.json")
+	if err := database.SaveToDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewDatabase()
+	if err := loaded.LoadFromDisk(filename); err != nil {
+		t.Fatal(err)
+	}
+	table, err := loaded.GetTable("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := table.Select(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after load:\n got %v\nwant %v", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package db
+
+import "fmt"
+
+// Begin 开始事务，返回事务视图。视图的 GetTable 返回绑定到事务的表，
+// 读取都基于事务开始时的快照，写入在 Commit 前对其他连接不可见，Rollback 时撤销。
+// 视图中不能创建、删除或重命名表和序列，也不能修改表结构和索引，NEXTVAL 不受事务影响
+func (db *Database) Begin() (*Database, error) {
+	if db.tx != nil {
+		return nil, fmt.Errorf("transaction already in progress")
+	}
+	return &Database{tx: db.begin(false)}, nil
+}
+
+// Snapshot 返回只读的快照视图和释放快照的函数，查询多张表时用来得到一致的结果。
+// 在事务视图上调用时直接使用事务的快照
+func (db *Database) Snapshot() (*Database, func()) {
+	if db.tx != nil {
+		return db, func() {}
+	}
+	view := &Database{tx: db.begin(true)}
+	return view, func() { view.tx.end(nil) }
+}
+
+// InTransaction 返回 db 是否为事务或快照视图
+func (db *Database) InTransaction() bool {
+	return db.tx != nil
+}
+
+// notInTransaction 用于拒绝在事务中执行的操作
+func (db *Database) notInTransaction(op string) error {
+	if db.tx != nil {
+		return fmt.Errorf("%s is not allowed in a transaction", op)
+	}
+	return nil
+}
+
+// notInTransaction 用于拒绝在事务中修改表结构和索引。
+// 表结构和索引没有多个版本，修改立即生效且无法回滚
+func (t *Table) notInTransaction(op string) error {
+	if t.tx != nil {
+		return fmt.Errorf("%s is not allowed in a transaction", op)
+	}
+	return nil
+}
+
+// noPendingWrites 用于拒绝在其他事务有未提交的写入时删除、重命名表或修改表结构，
+// 调用者需要持有写锁。未提交的写入按写入时的表名和表结构记录在日志中
+func (t *tableState) noPendingWrites(op string) error {
+	if t.writers > 0 {
+		return fmt.Errorf("%s: table %s has uncommitted changes in another transaction", op, t.Name)
+	}
+	return nil
+}
+
+// activeTx 返回进行中的事务，db 不是事务视图或事务已经结束时返回错误
+func (db *Database) activeTx() (*Tx, error) {
+	if db.tx == nil || db.tx.readOnly || db.tx.done {
+		return nil, fmt.Errorf("no transaction in progress")
+	}
+	return db.tx, nil
+}
+
+// Commit 提交事务，之后开始的读取都能看到事务的全部写入
+func (db *Database) Commit() error {
+	tx, err := db.activeTx()
+	if err != nil {
+		return err
+	}
+	if err := tx.commit(); err != nil {
+		tx.rollback(0)
+		tx.end(nil)
+		return err
+	}
+	tx.end(nil)
+	return nil
+}
+
+// Rollback 撤销事务的全部写入
+func (db *Database) Rollback() error {
+	tx, err := db.activeTx()
+	if err != nil {
+		return err
+	}
+	tx.rollback(0)
+	tx.end(nil)
+	return nil
+}
+
+// Savepoint 建立保存点，同名的保存点可以重复建立，ROLLBACK TO 回到最近的一个
+func (db *Database) Savepoint(name string) error {
+	tx, err := db.activeTx()
+	if err != nil {
+		return fmt.Errorf("SAVEPOINT can only be used in a transaction")
+	}
+	tx.savepoints = append(tx.savepoints, savepoint{name: name, writes: len(tx.writes), ops: len(tx.ops)})
+	return nil
+}
+
+// RollbackTo 撤销保存点之后的写入，保存点本身保留，之后建立的保存点被删除
+func (db *Database) RollbackTo(name string) error {
+	tx, err := db.activeTx()
+	if err != nil {
+		return fmt.Errorf("ROLLBACK TO can only be used in a transaction")
+	}
+	i := tx.savepoint(name)
+	if i < 0 {
+		return fmt.Errorf("savepoint %s does not exist", name)
+	}
+	tx.rollbackTo(tx.savepoints[i])
+	tx.savepoints = tx.savepoints[:i+1]
+	return nil
+}
+
+// ReleaseSavepoint 删除保存点及其之后建立的保存点，已做的修改保留
+func (db *Database) ReleaseSavepoint(name string) error {
+	tx, err := db.activeTx()
+	if err != nil {
+		return fmt.Errorf("RELEASE SAVEPOINT can only be used in a transaction")
+	}
+	i := tx.savepoint(name)
+	if i < 0 {
+		return fmt.Errorf("savepoint %s does not exist", name)
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+// savepoint 返回最近一个名为 name 的保存点的下标，不存在时返回 -1
+func (tx *Tx) savepoint(name string) int {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
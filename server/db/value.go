@@ -0,0 +1,440 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value 是规范化的列值，只会是以下类型之一：
+// nil（NULL）、int64、float64、string、bool、time.Time（UTC）、[]byte、JSON。
+// 来自协议的值（JSON 解码得到的 float64、对象和数组）、SQL 常量和 Go 代码中的 int 都先经过 Normalize，
+// 写入列时再由 coerceValue 按列类型转换（如把字符串解析为时间）。
+// 值之间的比较统一使用 Compare 或 CompareValues，不要直接用 == 比较
+type Value = interface{}
+
+// JSON 是 JSON 列的值，内容为紧凑且对象键有序的 JSON 文本，编码时原样输出
+type JSON string
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// ParseJSON 解析 JSON 文本并转换为规范形式，内容相同的文档得到相同的文本
+func ParseJSON(text string) (JSON, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return "", fmt.Errorf("invalid json: %v", err)
+	}
+	if decoder.More() {
+		return "", fmt.Errorf("invalid json: unexpected data after document")
+	}
+	return toJSON(doc)
+}
+
+// toJSON 编码文档，其中的数值按 Normalize 规范化，使 2、2.0 和 2.50、2.5 得到相同的文本
+func toJSON(doc interface{}) (JSON, error) {
+	doc, err := canonicalDoc(doc)
+	if err != nil {
+		return "", fmt.Errorf("invalid json: %v", err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("invalid json: %v", err)
+	}
+	return JSON(data), nil
+}
+
+func canonicalDoc(doc interface{}) (interface{}, error) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			value, err := canonicalDoc(item)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = value
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := canonicalDoc(item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	case json.Number, float64, int, int64:
+		return Normalize(v)
+	default:
+		return v, nil
+	}
+}
+
+// 时间的文本格式，没有时区的时间按 UTC 处理
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// ParseTimestamp 解析时间文本，支持 RFC 3339 和 "2006-01-02 15:04:05" 等格式，
+// 带时区偏移的时间按偏移换算，没有时区的时间按 UTC 处理。结果为 UTC
+func ParseTimestamp(text string) (time.Time, error) {
+	text = strings.TrimSpace(text)
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", text)
+}
+
+// Normalize 把值转换为规范形式：整数和值为整数的 float64 转换为 int64，
+// JSON 对象和数组转换为 JSON，时间转换为 UTC
+func Normalize(v interface{}) (Value, error) {
+	switch n := v.(type) {
+	case nil, int64, string, bool, []byte, JSON:
+		return v, nil
+	case int:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case float64:
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("invalid number %v", n)
+		}
+		if n == math.Trunc(n) && n >= math.MinInt64 && n < math.MaxInt64 {
+			return int64(n), nil
+		}
+		return n, nil
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %v", n)
+		}
+		return Normalize(f)
+	case time.Time:
+		return n.UTC(), nil
+	case map[string]interface{}, []interface{}:
+		return toJSON(n)
+	default:
+		return nil, fmt.Errorf("unsupported value %v (%T)", v, v)
+	}
+}
+
+// NormalizeRow 规范化一行（或一组条件）中的所有值，返回新的 map
+func NormalizeRow(row map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		value, err := Normalize(v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", k, err)
+		}
+		result[k] = value
+	}
+	return result, nil
+}
+
+// coerceValue 检查值能否写入列，并转换为该列类型的规范值。
+// 字符串可以写入 timestamp 列（按 ParseTimestamp 解析）、bytes 列（按 base64 解码）
+// 和 json 列（按 JSON 文本解析）；json 列还接受数值、布尔值、对象和数组
+func coerceValue(col Column, val interface{}) (Value, error) {
+	value, err := Normalize(val)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		if col.Nullable {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot be null")
+	}
+
+	switch col.Type {
+	case TypeInt:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			// 值为整数的 float64 已经由 Normalize 转换为 int64
+			return nil, fmt.Errorf("expected integer value, got float")
+		}
+	case TypeString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case TypeFloat:
+		switch v := value.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case TypeBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case TypeTimestamp:
+		var t time.Time
+		switch v := value.(type) {
+		case time.Time:
+			t = v
+		case string:
+			if t, err = ParseTimestamp(v); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("expected timestamp, got %v", reflect.TypeOf(value))
+		}
+		// 时间以纳秒保存在 int64 中
+		if !time.Unix(0, t.UnixNano()).Equal(t) {
+			return nil, fmt.Errorf("timestamp %s out of range", t.Format(time.RFC3339))
+		}
+		return t, nil
+	case TypeBytes:
+		switch v := value.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			data, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 value: %v", err)
+			}
+			return data, nil
+		}
+	case TypeJSON:
+		switch v := value.(type) {
+		case JSON:
+			return v, nil
+		case string:
+			return ParseJSON(v)
+		case int64, float64, bool:
+			return toJSON(v)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported column type: %v", col.Type)
+	}
+	return nil, fmt.Errorf("expected %s, got %v", col.Type, reflect.TypeOf(value))
+}
+
+// storedValue 把从数据文件或日志中解码得到的值转换为列的类型。
+// json 列在文件中保存的是文档本身而不是 JSON 文本，字符串文档不能再按 JSON 文本解析
+func storedValue(col Column, val interface{}) (Value, error) {
+	if col.Type != TypeJSON || val == nil {
+		return coerceValue(col, val)
+	}
+	if j, ok := val.(JSON); ok {
+		return j, nil
+	}
+	return toJSON(val)
+}
+
+// FormatValue 把值转换为文本：时间为 RFC 3339 格式，二进制数据为 base64，NULL 为空字符串
+func FormatValue(v Value) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case int:
+		return strconv.Itoa(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x)
+	case JSON:
+		return string(x)
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
+
+// CompareValues 比较两个非 NULL 的值：数值按大小比较，字符串按字典序比较，
+// false 小于 true，时间按先后比较，二进制数据按字节比较，JSON 按规范文本比较。
+// 字符串与时间、二进制数据、JSON 比较时先按对方的类型解析。
+// 类型不同且无法转换的值不能比较，返回 false
+func CompareValues(a, b Value) (int, bool) {
+	a, b = coercePair(a, b)
+	if x, ok := numeric(a); ok {
+		y, ok := numeric(b)
+		if !ok {
+			return 0, false
+		}
+		return compareNumbers(x, y), true
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y), true
+		}
+	case JSON:
+		if y, ok := b.(JSON); ok {
+			return strings.Compare(string(x), string(y)), true
+		}
+	}
+	return 0, false
+}
+
+// coercePair 在一方为字符串、另一方为时间、二进制数据或 JSON 时，把字符串转换为对方的类型
+func coercePair(a, b Value) (Value, Value) {
+	if s, ok := a.(string); ok {
+		if v, ok := parseAs(s, b); ok {
+			return v, b
+		}
+	}
+	if s, ok := b.(string); ok {
+		if v, ok := parseAs(s, a); ok {
+			return a, v
+		}
+	}
+	return a, b
+}
+
+func parseAs(s string, like Value) (Value, bool) {
+	var col Column
+	switch like.(type) {
+	case time.Time:
+		col.Type = TypeTimestamp
+	case []byte:
+		col.Type = TypeBytes
+	case JSON:
+		col.Type = TypeJSON
+	default:
+		return nil, false
+	}
+	v, err := coerceValue(col, s)
+	return v, err == nil
+}
+
+// Compare 按全序比较两个值：NULL 最小，能用 CompareValues 比较的值按其结果，
+// 其余的值按类型排序，保证排序和索引的结果稳定
+func Compare(a, b Value) int {
+	if a != nil && b != nil {
+		if cmp, ok := CompareValues(a, b); ok {
+			return cmp
+		}
+	}
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	return strings.Compare(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b))
+}
+
+// rank 是不同类型的值之间的顺序
+func rank(v Value) int {
+	if _, ok := numeric(v); ok {
+		return 2
+	}
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return 3
+	case []byte:
+		return 4
+	case time.Time:
+		return 5
+	case JSON:
+		return 6
+	}
+	return 7
+}
+
+// number 是比较用的数值，整数保留为 int64 以免大整数丢失精度
+type number struct {
+	i       int64
+	f       float64
+	isFloat bool
+}
+
+func numeric(v Value) (number, bool) {
+	switch n := v.(type) {
+	case int64:
+		return number{i: n}, true
+	case int:
+		return number{i: int64(n)}, true
+	case float64:
+		if math.IsNaN(n) {
+			return number{}, false
+		}
+		return number{f: n, isFloat: true}, true
+	}
+	return number{}, false
+}
+
+func compareNumbers(x, y number) int {
+	if !x.isFloat && !y.isFloat {
+		switch {
+		case x.i < y.i:
+			return -1
+		case x.i > y.i:
+			return 1
+		default:
+			return 0
+		}
+	}
+	a, b := x.f, y.f
+	if !x.isFloat {
+		a = float64(x.i)
+	}
+	if !y.isFloat {
+		b = float64(y.i)
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
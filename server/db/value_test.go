@@ -0,0 +1,78 @@
+package db
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want Value
+	}{
+		{nil, nil},
+		{3, int64(3)},
+		{int32(-3), int64(-3)},
+		{int64(3), int64(3)},
+		// JSON 解码得到的整数是 float64
+		{float64(3), int64(3)},
+		{2.5, 2.5},
+		{json.Number("9007199254740993"), int64(9007199254740993)},
+		{"x", "x"},
+		{true, true},
+		{time.Date(2024, 1, 2, 11, 0, 0, 0, time.FixedZone("", 8*3600)), time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{map[string]interface{}{"b": 2.0, "a": "x"}, JSON(`{"a":"x","b":2}`)},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%#v) = %#v, %v, want %#v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []interface{}{math.NaN(), math.Inf(1), struct{}{}} {
+		if got, err := Normalize(in); err == nil {
+			t.Errorf("Normalize(%#v) = %#v, want error", in, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	big := int64(1) << 62
+	tests := []struct {
+		a, b Value
+		want int
+	}{
+		{nil, nil, 0},
+		{nil, int64(0), -1},
+		{int64(1), "a", -1},
+		{int64(2), 1.5, 1},
+		{1.0, int64(1), 0},
+		// 超过 2^53 的整数不经过 float64 比较
+		{big, big + 1, -1},
+		{"b", "a", 1},
+	}
+	for _, tt := range tests {
+		if got := Compare(tt.a, tt.b); sign(got) != tt.want {
+			t.Errorf("Compare(%#v, %#v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := Compare(tt.b, tt.a); sign(got) != -tt.want {
+			t.Errorf("Compare(%#v, %#v) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+	if _, ok := CompareValues(int64(1), "1"); ok {
+		t.Error("CompareValues(1, \"1\") succeeded, want false")
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
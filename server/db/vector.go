@@ -0,0 +1,127 @@
+package db
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// vector 是一列数据的存储，只有与列类型对应的切片会被使用：
+// int 和 timestamp（UTC 纳秒）列保存在 ints 中，float 列保存在 floats 中，bool 列保存在 bools 中，
+// string、bytes 和 json（规范文本）列保存在 strs 中。
+// NULL 记录在位图 nulls 中，此时切片中对应位置为零值。
+// 与每行一个 map 相比，值不需要装箱，数值列也不含指针，不会增加 GC 扫描的负担。
+// 查询会在不加锁的情况下读取已有的行，同时写入可能在后面追加新的行，
+// 因此位图中同一个字的读写使用原子操作
+type vector struct {
+	typ    ColumnType
+	n      int
+	ints   []int64
+	floats []float64
+	bools  []bool
+	strs   []string
+	nulls  []uint64 // 第 i 位为 1 表示第 i 行为 NULL，超出长度的部分视为 0
+}
+
+func newVector(typ ColumnType, capacity int) *vector {
+	v := &vector{typ: typ}
+	switch typ {
+	case TypeInt, TypeTimestamp:
+		v.ints = make([]int64, 0, capacity)
+	case TypeFloat:
+		v.floats = make([]float64, 0, capacity)
+	case TypeBool:
+		v.bools = make([]bool, 0, capacity)
+	case TypeString, TypeBytes, TypeJSON:
+		v.strs = make([]string, 0, capacity)
+	}
+	return v
+}
+
+func (v *vector) isNull(i int) bool {
+	w := i / 64
+	return w < len(v.nulls) && atomic.LoadUint64(&v.nulls[w])&(1<<(uint(i)%64)) != 0
+}
+
+func (v *vector) setNull(i int, null bool) {
+	w := i / 64
+	if !null {
+		if w < len(v.nulls) {
+			atomic.AndUint64(&v.nulls[w], ^uint64(1<<(uint(i)%64)))
+		}
+		return
+	}
+	for w >= len(v.nulls) {
+		v.nulls = append(v.nulls, 0)
+	}
+	atomic.OrUint64(&v.nulls[w], 1<<(uint(i)%64))
+}
+
+// get 返回第 i 行的值，NULL 返回 nil
+func (v *vector) get(i int) interface{} {
+	if v.isNull(i) {
+		return nil
+	}
+	switch v.typ {
+	case TypeInt:
+		return v.ints[i]
+	case TypeTimestamp:
+		return time.Unix(0, v.ints[i]).UTC()
+	case TypeFloat:
+		return v.floats[i]
+	case TypeBool:
+		return v.bools[i]
+	case TypeString:
+		return v.strs[i]
+	case TypeBytes:
+		return []byte(v.strs[i])
+	case TypeJSON:
+		return JSON(v.strs[i])
+	}
+	return nil
+}
+
+// set 设置第 i 行的值，val 需要是经过 coerceValue 转换的该列类型的值
+func (v *vector) set(i int, val interface{}) {
+	v.setNull(i, val == nil)
+	switch v.typ {
+	case TypeInt:
+		n, _ := intValue(val)
+		v.ints[i] = n
+	case TypeTimestamp:
+		var n int64
+		if t, ok := val.(time.Time); ok {
+			n = t.UnixNano()
+		}
+		v.ints[i] = n
+	case TypeFloat:
+		f, _ := val.(float64)
+		v.floats[i] = f
+	case TypeBool:
+		b, _ := val.(bool)
+		v.bools[i] = b
+	case TypeString:
+		s, _ := val.(string)
+		v.strs[i] = s
+	case TypeBytes:
+		b, _ := val.([]byte)
+		v.strs[i] = string(b)
+	case TypeJSON:
+		j, _ := val.(JSON)
+		v.strs[i] = string(j)
+	}
+}
+
+func (v *vector) append(val interface{}) {
+	switch v.typ {
+	case TypeInt, TypeTimestamp:
+		v.ints = append(v.ints, 0)
+	case TypeFloat:
+		v.floats = append(v.floats, 0)
+	case TypeBool:
+		v.bools = append(v.bools, false)
+	case TypeString, TypeBytes, TypeJSON:
+		v.strs = append(v.strs, "")
+	}
+	v.n++
+	v.set(v.n-1, val)
+}
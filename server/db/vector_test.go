@@ -0,0 +1,65 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	ints := newVector(TypeInt, 0)
+	strs := newVector(TypeString, 0)
+	// 超过 64 行，NULL 位图需要多个字
+	for i := 0; i < 100; i++ {
+		var n, s interface{}
+		if i%3 != 0 {
+			n, s = int64(i), string(rune('a'+i%26))
+		}
+		ints.append(n)
+		strs.append(s)
+	}
+	if got := ints.get(65); got != int64(65) {
+		t.Errorf("ints.get(65) = %v, want 65", got)
+	}
+	if got := strs.get(66); got != nil {
+		t.Errorf("strs.get(66) = %v, want nil", got)
+	}
+	ints.set(66, int64(7))
+	ints.set(65, nil)
+	if ints.get(66) != int64(7) || ints.get(65) != nil {
+		t.Errorf("after set: got %v, %v, want 7, nil", ints.get(66), ints.get(65))
+	}
+}
+
+func TestTableColumnStorage(t *testing.T) {
+	table := newTable(NewDatabase(), "t", []Column{
+		{Name: "id", Type: TypeInt},
+		{Name: "name", Type: TypeString, Nullable: true},
+	}, nil)
+	// JSON 解码得到的 float64 在 int 列中保存为整数
+	rows := []map[string]interface{}{
+		{"id": float64(1), "name": "a"},
+		{"id": float64(2), "name": nil},
+		{"id": float64(3), "name": "c"},
+	}
+	if err := table.load(rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.load([]map[string]interface{}{{"id": "x"}}); err == nil {
+		t.Error("load with a string in an int column succeeded, want error")
+	}
+
+	want := []map[string]interface{}{
+		{"id": int64(1), "name": "a"},
+		{"id": int64(2), "name": nil},
+		{"id": int64(3), "name": "c"},
+	}
+	if got := table.Select(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("Select(nil) = %v, want %v", got, want)
+	}
+	if err := table.ModifyColumn(Column{Name: "id", Type: TypeString}); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.Select(nil)[2]["id"]; got != "3" {
+		t.Errorf("after MODIFY COLUMN: id = %#v, want \"3\"", got)
+	}
+}
@@ -0,0 +1,419 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 预写日志
+//
+// 提交的事务以及修改表结构和序列的操作按顺序作为记录追加到日志中，每条记录有递增的日志序号（LSN）。
+// 启动时先加载快照，再重放日志中比快照新的记录。检查点保存新的快照后删除旧的日志。
+//
+// 日志目录中有多个段文件，每次检查点开始一个新的段，文件名为段中第一条记录的序号。
+// 检查点删除上一个快照之前的段，新的快照损坏时仍然可以从上一个快照和日志恢复。
+// 每条记录的格式为：4 字节长度、4 字节 CRC32 校验和、JSON 编码的内容。
+// 崩溃时最后一条记录可能只写入了一部分，打开日志时截掉校验失败的结尾。
+// 指定了归档目录时，检查点不删除旧的段，而是移动到归档目录，用于时间点恢复（见 recovery.go）
+
+// SyncPolicy 决定提交何时写入磁盘
+type SyncPolicy int
+
+const (
+	SyncAlways   SyncPolicy = iota // 每次提交都执行 fsync
+	SyncGroup                      // 同时等待的提交合并为一次 fsync
+	SyncInterval                   // 定期 fsync，崩溃时可能丢失最近一个间隔内的提交
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncGroup:
+		return "group"
+	case SyncInterval:
+		return "interval"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSyncPolicy 将名称转换为同步策略
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch strings.ToLower(name) {
+	case "always":
+		return SyncAlways, nil
+	case "group":
+		return SyncGroup, nil
+	case "interval":
+		return SyncInterval, nil
+	default:
+		return 0, fmt.Errorf("invalid sync policy: %s", name)
+	}
+}
+
+// LogOptions 是预写日志的配置，Interval 为 SyncInterval 策略的 fsync 间隔。
+// Archive 为归档目录，需要与日志目录在同一文件系统中，为空时删除旧的段
+type LogOptions struct {
+	Sync     SyncPolicy
+	Interval time.Duration
+	Archive  string
+}
+
+// logRecord 是日志中的一条记录，Time 为写入日志的时间
+type logRecord struct {
+	LSN  uint64    `json:"lsn"`
+	Time time.Time `json:"time"`
+	Ops  []logOp   `json:"ops"`
+}
+
+const segmentExt = ".wal"
+
+// walLog 是打开的日志，追加写入当前的段
+type walLog struct {
+	dir     string
+	options LogOptions
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	file    *os.File
+	w       *bufio.Writer
+	start   uint64 // 当前段的第一条记录的序号
+	size    int64  // 所有段的大小
+	written uint64 // 最后写入的记录的序号
+	synced  uint64 // 已经 fsync 的最后一条记录的序号
+	syncing bool
+	err     error // 写入失败后日志不再可用
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// openLog 打开 dir 中的日志，按顺序把序号大于 from 的记录交给 apply，
+// 返回打开的日志和最后一条记录的序号（没有更新的记录时为 from）
+func openLog(dir string, options LogOptions, from uint64, apply func(rec *logRecord) error) (*walLog, uint64, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, 0, err
+	}
+	if options.Archive != "" {
+		if err := os.MkdirAll(options.Archive, 0755); err != nil {
+			return nil, 0, err
+		}
+	}
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	l := &walLog{dir: dir, options: options}
+	l.cond = sync.NewCond(&l.mu)
+	last := from
+	for i, start := range segments {
+		path := segmentPath(dir, start)
+		valid, err := readSegment(path, func(rec *logRecord) error {
+			if rec.LSN <= last {
+				return nil
+			}
+			if rec.LSN != last+1 {
+				return fmt.Errorf("missing records %d-%d", last+1, rec.LSN-1)
+			}
+			if err := apply(rec); err != nil {
+				return fmt.Errorf("record %d: %v", rec.LSN, err)
+			}
+			last = rec.LSN
+			return nil
+		})
+		if errors.Is(err, errTornRecord) && i == len(segments)-1 {
+			// 最后一条记录没有写完，截掉之后的内容
+			err = os.Truncate(path, valid)
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("write-ahead log %s: %v", path, err)
+		}
+		l.size += valid
+	}
+
+	if err := l.openSegment(last + 1); err != nil {
+		return nil, 0, err
+	}
+	l.written, l.synced = last, last
+	if options.Sync == SyncInterval {
+		l.stop, l.done = make(chan struct{}), make(chan struct{})
+		go l.syncLoop()
+	}
+	return l, last, nil
+}
+
+// listSegments 返回日志目录中所有段的第一条记录的序号，从小到大排列
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, start)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func segmentPath(dir string, start uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", start, segmentExt))
+}
+
+// errTornRecord 表示记录不完整或校验失败
+var errTornRecord = errors.New("torn or corrupted record")
+
+// readSegment 依次读取段中的记录，返回完整记录的总长度
+func readSegment(path string, fn func(rec *logRecord) error) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var valid int64
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return valid, nil
+			}
+			return valid, errTornRecord
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return valid, errTornRecord
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			return valid, errTornRecord
+		}
+		var rec logRecord
+		if err := unmarshalNumbers(payload, &rec); err != nil {
+			return valid, errTornRecord
+		}
+		if err := fn(&rec); err != nil {
+			return valid, err
+		}
+		valid += int64(len(header) + len(payload))
+	}
+}
+
+// openSegment 开始新的段，调用者需要持有锁或者日志还没有开始使用
+func (l *walLog) openSegment(start uint64) error {
+	file, err := os.OpenFile(segmentPath(l.dir, start), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	l.file, l.w, l.start = file, bufio.NewWriter(file), start
+	return syncDir(l.dir)
+}
+
+// append 追加一条记录，SyncAlways 策略下写入磁盘后才返回
+func (l *walLog) append(rec *logRecord) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	if _, err := l.w.Write(header); err != nil {
+		return l.fail(err)
+	}
+	if _, err := l.w.Write(payload); err != nil {
+		return l.fail(err)
+	}
+	l.size += int64(len(header) + len(payload))
+	l.written = rec.LSN
+	if l.options.Sync == SyncAlways {
+		if err := l.flush(); err != nil {
+			return l.fail(err)
+		}
+		l.synced = l.written
+	}
+	return nil
+}
+
+// wait 按同步策略等待已经追加的记录写入磁盘
+func (l *walLog) wait() error {
+	if l.options.Sync == SyncInterval {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.err
+	}
+	return l.sync()
+}
+
+// sync 把已经追加的记录写入磁盘。同时调用的 sync 中只有一个执行 fsync，
+// 其余的等待它完成，fsync 期间追加的记录由下一次 fsync 写入
+func (l *walLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	target := l.written
+	for l.synced < target && l.err == nil {
+		if l.syncing {
+			l.cond.Wait()
+			continue
+		}
+		l.syncing = true
+		upto := l.written
+		err := l.w.Flush()
+		file := l.file
+		l.mu.Unlock()
+		if err == nil {
+			err = file.Sync()
+		}
+		l.mu.Lock()
+		l.syncing = false
+		if err != nil {
+			l.fail(err)
+		} else if upto > l.synced {
+			l.synced = upto
+		}
+		l.cond.Broadcast()
+	}
+	return l.err
+}
+
+// flush 写出缓冲区并 fsync，调用者需要持有锁
+func (l *walLog) flush() error {
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// fail 记录写入错误，之后的写入都返回这个错误。调用者需要持有锁
+func (l *walLog) fail(err error) error {
+	if l.err == nil {
+		l.err = fmt.Errorf("write-ahead log: %v", err)
+	}
+	return l.err
+}
+
+func (l *walLog) syncLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.sync()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// rotate 结束当前的段，之后的记录从序号 start 开始写入新的段
+func (l *walLog) rotate(start uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.syncing {
+		l.cond.Wait()
+	}
+	if l.err != nil {
+		return l.err
+	}
+	if start == l.start {
+		return nil
+	}
+	if err := l.flush(); err != nil {
+		return l.fail(err)
+	}
+	l.synced = l.written
+	if err := l.file.Close(); err != nil {
+		return l.fail(err)
+	}
+	if err := l.openSegment(start); err != nil {
+		return l.fail(err)
+	}
+	return nil
+}
+
+// removeBefore 删除或归档只包含序号小于 lsn 的记录的段，检查点保存快照后调用。当前的段不会被删除
+func (l *walLog) removeBefore(lsn uint64) error {
+	segments, err := listSegments(l.dir)
+	if err != nil {
+		return err
+	}
+	// 段中的记录都小于下一个段的第一条记录
+	for i := 0; i+1 < len(segments) && segments[i+1] <= lsn; i++ {
+		path := segmentPath(l.dir, segments[i])
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if l.options.Archive != "" {
+			err = os.Rename(path, segmentPath(l.options.Archive, segments[i]))
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return err
+		}
+		l.mu.Lock()
+		l.size -= info.Size()
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// length 返回日志所有段的大小
+func (l *walLog) length() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// close 写入剩余的记录并关闭日志，之后的写入返回错误
+func (l *walLog) close() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.syncing {
+		l.cond.Wait()
+	}
+	if l.err != nil {
+		return l.err
+	}
+	err := l.flush()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.err = fmt.Errorf("write-ahead log is closed")
+	return err
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// openTestLog 返回在 dir 中打开了日志的数据库，重放 dir 中已有的记录
+func openTestLog(t *testing.T, dir string) *Database {
+	t.Helper()
+	database := NewDatabase()
+	if err := database.OpenLog(dir, LogOptions{Sync: SyncAlways}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.CloseLog() })
+	return database
+}
+
+// createTestTable 在 database 中创建与 newTestDatabase 相同的表 t
+func createTestTable(t *testing.T, database *Database) *Table {
+	t.Helper()
+	columns := []Column{
+		{Name: "id", Type: TypeInt, PrimaryKey: true},
+		{Name: "v", Type: TypeInt, Nullable: true},
+	}
+	if err := database.CreateTable("t", columns); err != nil {
+		t.Fatal(err)
+	}
+	return mustTable(t, database)
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, database *Database)
+		want map[int64]interface{}
+	}{
+		{"insert, update and delete", func(t *testing.T, database *Database) {
+			tbl := createTestTable(t, database)
+			tbl.InsertRows([]map[string]interface{}{{"id": 1, "v": 1}, {"id": 2, "v": 2}, {"id": 3}})
+			tbl.Update(byID(1), map[string]interface{}{"v": 10})
+			tbl.Delete(byID(2))
+		}, map[int64]interface{}{1: int64(10), 3: nil}},
+		{"identical rows", func(t *testing.T, database *Database) {
+			tbl := createTestTable(t, database)
+			tbl.Insert(map[string]interface{}{"id": 1, "v": 1})
+			tbl.Update(byID(1), map[string]interface{}{"v": 2})
+			tbl.Update(byID(1), map[string]interface{}{"v": 1})
+			tbl.Update(byID(1), map[string]interface{}{"v": 2})
+		}, map[int64]interface{}{1: int64(2)}},
+		{"transactions", func(t *testing.T, database *Database) {
+			createTestTable(t, database)
+			tx, _ := database.Begin()
+			mustTable(t, tx).Insert(map[string]interface{}{"id": 1})
+			tx.Savepoint("sp")
+			mustTable(t, tx).Insert(map[string]interface{}{"id": 2})
+			tx.RollbackTo("sp")
+			tx.Commit()
+			tx, _ = database.Begin()
+			mustTable(t, tx).Insert(map[string]interface{}{"id": 3})
+			tx.Rollback()
+		}, map[int64]interface{}{1: nil}},
+		{"failed multi-row insert", func(t *testing.T, database *Database) {
+			tbl := createTestTable(t, database)
+			tbl.Insert(map[string]interface{}{"id": 1})
+			if _, err := tbl.InsertRows([]map[string]interface{}{{"id": 2}, {"id": 1}}); err == nil {
+				t.Error("duplicate key accepted")
+			}
+		}, map[int64]interface{}{1: nil}},
+		{"schema changes", func(t *testing.T, database *Database) {
+			tbl := createTestTable(t, database)
+			tbl.Insert(map[string]interface{}{"id": 1, "v": 1})
+			if err := tbl.AddColumn(Column{Name: "w", Type: TypeInt, Nullable: true}); err != nil {
+				t.Fatal(err)
+			}
+			tbl.Update(byID(1), map[string]interface{}{"w": 5})
+			if err := tbl.DropColumn("v"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tbl.RenameColumn("w", "v"); err != nil {
+				t.Fatal(err)
+			}
+		}, map[int64]interface{}{1: int64(5)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			database := openTestLog(t, dir)
+			tt.run(t, database)
+			if err := database.CloseLog(); err != nil {
+				t.Fatal(err)
+			}
+			replayed := openTestLog(t, dir)
+			got := values(t, replayed)
+			if len(got) != len(tt.want) {
+				t.Fatalf("replayed %v, want %v", got, tt.want)
+			}
+			for id, v := range tt.want {
+				if got[id] != v {
+					t.Errorf("replayed %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// json 列的字符串、数值和对象文档都能从日志中重放
+func TestJSONLogRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	database := openTestLog(t, dir)
+	want := newTypedTable(t, database).Select(nil)
+	if err := database.CloseLog(); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := openTestLog(t, dir).GetTable("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := table.Select(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after replay:\n got %v\nwant %v", got, want)
+	}
+}
+
+// 最后一条记录只写入一部分时截掉它，之前的记录正常重放，之后的写入接在截断的位置
+func TestReplayTornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tear func(data []byte) []byte
+		want int // 重放得到的行数
+	}{
+		{"partial header", func(data []byte) []byte { return append(data, 1, 2, 3) }, 2},
+		{"partial payload", func(data []byte) []byte { return data[:len(data)-5] }, 1},
+		{"bad checksum", func(data []byte) []byte {
+			data[len(data)-2] ^= 0xff
+			return data
+		}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			database := openTestLog(t, dir)
+			tbl := createTestTable(t, database)
+			tbl.Insert(map[string]interface{}{"id": 1})
+			tbl.Insert(map[string]interface{}{"id": 2})
+			database.CloseLog()
+			tearSegment(t, dir, 0, tt.tear)
+
+			database = openTestLog(t, dir)
+			got := values(t, database)
+			if _, ok := got[1]; !ok || len(got) != tt.want {
+				t.Fatalf("after torn tail: %v, want %d rows", got, tt.want)
+			}
+			if _, err := mustTable(t, database).Insert(map[string]interface{}{"id": 3}); err != nil {
+				t.Fatal(err)
+			}
+			database.CloseLog()
+
+			got = values(t, openTestLog(t, dir))
+			if _, ok := got[3]; !ok || len(got) != tt.want+1 {
+				t.Errorf("after reopening: %v", got)
+			}
+		})
+	}
+}
+
+// 只有最后一个段的结尾可以不完整，更早的段损坏时拒绝打开日志
+func TestReplayCorruptedSegment(t *testing.T) {
+	dir := t.TempDir()
+	database := openTestLog(t, dir)
+	createTestTable(t, database).Insert(map[string]interface{}{"id": 1})
+	database.CloseLog()
+	// 重新打开日志时开始新的段
+	database = openTestLog(t, dir)
+	mustTable(t, database).Insert(map[string]interface{}{"id": 2})
+	database.CloseLog()
+	tearSegment(t, dir, 0, func(data []byte) []byte { return data[:len(data)-5] })
+
+	if err := NewDatabase().OpenLog(dir, LogOptions{}); err == nil {
+		t.Error("opened a log with a corrupted segment")
+	}
+}
+
+// tearSegment 用 tear 的结果替换日志目录中第 i 个段的内容
+func tearSegment(t *testing.T, dir string, i int, tear func(data []byte) []byte) {
+	t.Helper()
+	segments, err := listSegments(dir)
+	if err != nil || len(segments) <= i {
+		t.Fatalf("segments %v, %v", segments, err)
+	}
+	path := segmentPath(dir, segments[i])
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, tear(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
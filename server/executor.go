@@ -0,0 +1,487 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liubaotong/mem-db/server/db"
+	"github.com/liubaotong/mem-db/server/protocol"
+	"github.com/liubaotong/mem-db/server/sql"
+)
+
+func handleExecSQL(payload interface{}, sess *session) protocol.Response {
+	execPayload, ok := payload.(protocol.ExecSQLPayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	stmts, err := sql.ParseScript(execPayload.SQL)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 依次执行每条语句，遇到错误立即停止，返回最后一条语句的结果
+	var response protocol.Response
+	for _, stmt := range stmts {
+		response = executeStatement(stmt, sess)
+		if !response.Success {
+			return response
+		}
+	}
+	return response
+}
+
+// executeStatement 执行一条语句。事务语句会改变会话的状态，因此每条语句执行前重新取得数据库
+func executeStatement(stmt sql.Statement, sess *session) protocol.Response {
+	database := sess.current()
+	switch s := stmt.(type) {
+	case *sql.CreateTableStmt:
+		return executeCreateTable(s, database)
+	case *sql.InsertStmt:
+		return executeInsert(s, database)
+	case *sql.SelectStmt:
+		return executeSelect(s, database)
+	case *sql.UpdateStmt:
+		return executeUpdate(s, database)
+	case *sql.DeleteStmt:
+		return executeDelete(s, database)
+	case *sql.DropTableStmt:
+		return handleDropTable(protocol.DropTablePayload{TableName: s.Table, IfExists: s.IfExists}, database)
+	case *sql.RenameTableStmt:
+		return handleRenameTable(protocol.RenameTablePayload{TableName: s.Table, NewName: s.NewName}, database)
+	case *sql.AlterTableStmt:
+		return executeAlterTable(s, database)
+	case *sql.TruncateStmt:
+		return handleTruncateTable(protocol.TruncateTablePayload{TableName: s.Table}, database)
+	case *sql.CreateSequenceStmt:
+		return handleCreateSequence(protocol.CreateSequencePayload{
+			Name:      s.Name,
+			Start:     &s.Start,
+			Increment: s.Increment,
+		}, database)
+	case *sql.DropSequenceStmt:
+		return handleDropSequence(protocol.DropSequencePayload{Name: s.Name, IfExists: s.IfExists}, database)
+	case *sql.CreateIndexStmt:
+		return handleCreateIndex(protocol.CreateIndexPayload{
+			TableName: s.Table,
+			Name:      s.Name,
+			Columns:   s.Columns,
+			Unique:    s.Unique,
+			Type:      s.Using,
+		}, database)
+	case *sql.DropIndexStmt:
+		return handleDropIndex(protocol.DropIndexPayload{TableName: s.Table, Name: s.Name}, database)
+	case *sql.BeginStmt:
+		return sess.begin()
+	case *sql.CommitStmt:
+		return sess.commit()
+	case *sql.RollbackStmt:
+		if s.Savepoint != "" {
+			return sess.rollbackTo(protocol.SavepointPayload{Name: s.Savepoint})
+		}
+		return sess.rollback()
+	case *sql.SavepointStmt:
+		return sess.savepoint(protocol.SavepointPayload{Name: s.Name})
+	case *sql.ReleaseSavepointStmt:
+		return sess.releaseSavepoint(protocol.SavepointPayload{Name: s.Name})
+	case *sql.SetAutoSaveStmt:
+		return handleAutoSave(protocol.AutoSavePayload{Policy: s.Policy})
+	case *sql.ShowAutoSaveStmt:
+		return handleAutoSave(protocol.AutoSavePayload{})
+	case *sql.BackupStmt:
+		return handleBackup(protocol.BackupPayload{File: s.File}, database)
+	case *sql.RestoreStmt:
+		return handleRestore(protocol.RestorePayload{File: s.File, Tables: s.Tables}, database)
+	default:
+		return protocol.Response{Success: false, Error: "unsupported statement"}
+	}
+}
+
+func executeCreateTable(stmt *sql.CreateTableStmt, database *db.Database) protocol.Response {
+	payload := protocol.CreateTablePayload{TableName: stmt.Table}
+	for _, col := range stmt.Columns {
+		payload.Columns = append(payload.Columns, columnData(col))
+	}
+	for _, c := range stmt.Constraints {
+		payload.Constraints = append(payload.Constraints, protocol.ConstraintData{
+			Primary: c.PrimaryKey,
+			Columns: c.Columns,
+		})
+	}
+	return handleCreateTable(payload, database)
+}
+
+// columnData 把 SQL 列定义转换为协议中的列定义，未声明 NOT NULL 的列可空
+func columnData(col sql.ColumnDef) protocol.ColumnData {
+	data := protocol.ColumnData{
+		Name:          col.Name,
+		Type:          protocol.ColumnType(col.Type),
+		Nullable:      !col.NotNull,
+		PrimaryKey:    col.PrimaryKey,
+		Unique:        col.Unique,
+		AutoIncrement: col.AutoIncrement,
+	}
+	if col.Default != nil {
+		data.Default = col.Default.(*sql.Literal).Value
+	}
+	return data
+}
+
+func executeAlterTable(stmt *sql.AlterTableStmt, database *db.Database) protocol.Response {
+	col := columnData(stmt.Column)
+	payload := protocol.AlterTablePayload{
+		TableName:     stmt.Table,
+		Column:        col.Name,
+		Type:          string(col.Type),
+		Nullable:      col.Nullable,
+		Default:       col.Default,
+		PrimaryKey:    col.PrimaryKey,
+		Unique:        col.Unique,
+		AutoIncrement: col.AutoIncrement,
+		NewName:       stmt.NewName,
+	}
+	switch stmt.Action {
+	case sql.AddColumn:
+		payload.Action = protocol.AddColumn
+	case sql.DropColumn:
+		payload.Action = protocol.DropColumn
+	case sql.RenameColumn:
+		payload.Action = protocol.RenameColumn
+	case sql.ModifyColumn:
+		payload.Action = protocol.ModifyColumn
+	}
+	return handleAlterTable(payload, database)
+}
+
+func executeInsert(stmt *sql.InsertStmt, database *db.Database) protocol.Response {
+	table, err := database.GetTable(stmt.Table)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 未指定列名时按表定义的列顺序赋值
+	columns := stmt.Columns
+	if len(columns) == 0 {
+		for _, col := range table.GetColumns() {
+			columns = append(columns, col.Name)
+		}
+	}
+
+	rows := make([]map[string]interface{}, 0, len(stmt.Rows))
+	for _, exprs := range stmt.Rows {
+		if len(exprs) != len(columns) {
+			return protocol.Response{
+				Success: false,
+				Error:   fmt.Sprintf("expected %d values, got %d", len(columns), len(exprs)),
+			}
+		}
+		values := make(map[string]interface{})
+		for i, expr := range exprs {
+			value, err := evalValue(expr, database)
+			if err != nil {
+				return protocol.Response{Success: false, Error: err.Error()}
+			}
+			values[columns[i]] = value
+		}
+		rows = append(rows, values)
+	}
+
+	// 所有的行一起插入，任何一行失败时整条语句不生效
+	ids, err := table.InsertRows(rows)
+	if err != nil {
+		return errorResponse(err)
+	}
+	result := protocol.InsertResult{Inserted: len(rows), IDs: ids}
+	if len(ids) > 0 {
+		result.LastInsertID = ids[len(ids)-1]
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{
+		Success: true,
+		Data:    result,
+	}
+}
+
+// evalValue 计算 INSERT、UPDATE 中的值，除常量外只支持 NEXTVAL('seq')
+func evalValue(expr sql.Expr, database *db.Database) (interface{}, error) {
+	switch e := expr.(type) {
+	case *sql.Literal:
+		return e.Value, nil
+	case *sql.FuncCall:
+		if e.Name != "NEXTVAL" {
+			return nil, fmt.Errorf("function %s is not allowed here", e.Name)
+		}
+		var name string
+		if len(e.Args) == 1 {
+			if lit, ok := e.Args[0].(*sql.Literal); ok {
+				name, _ = lit.Value.(string)
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("NEXTVAL expects a sequence name string")
+		}
+		n, err := database.NextVal(name)
+		if err != nil {
+			return nil, err
+		}
+		return int64(n), nil
+	default:
+		return nil, fmt.Errorf("unsupported value %s", expr)
+	}
+}
+
+func executeSelect(stmt *sql.SelectStmt, database *db.Database) protocol.Response {
+	// 连接的各张表从同一个快照读取
+	database, release := database.Snapshot()
+	defer release()
+
+	refs := []sql.TableRef{stmt.From}
+	for _, join := range stmt.Joins {
+		refs = append(refs, join.Table)
+	}
+	sc, err := newScope(database, refs...)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	if err := sc.checkAmbiguous(selectExprs(stmt)...); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	for i, join := range stmt.Joins {
+		// ON 条件只能引用在它之前出现的表
+		if err := sql.Check(join.On, sc.columnTypes(i+2)); err != nil {
+			return protocol.Response{Success: false, Error: err.Error()}
+		}
+	}
+	filter, err := newRowFilter(stmt.Where, sc.columnTypes(len(sc.tables)))
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	plan, err := newSelectPlan(stmt, sc)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	var rows []map[string]interface{}
+	if len(stmt.Joins) == 0 {
+		var ok bool
+		if rows, ok = orderedSelect(stmt, plan, sc.tables[0].table, filter); !ok {
+			rows = sc.tables[0].table.Select(filter.match, whereLookups(stmt.Where, stmt.From.RefName())...)
+		}
+	} else {
+		joined, err := sc.join(stmt.Joins)
+		if err != nil {
+			return protocol.Response{Success: false, Error: err.Error()}
+		}
+		rows = make([]map[string]interface{}, 0, len(joined))
+		for _, row := range joined {
+			if filter.match(row) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	if filter.err != nil {
+		return protocol.Response{Success: false, Error: filter.err.Error()}
+	}
+
+	result, err := plan.execute(rows)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	return protocol.Response{
+		Success: true,
+		Data:    result,
+	}
+}
+
+// selectExprs 返回 SELECT 语句中出现的所有表达式
+func selectExprs(stmt *sql.SelectStmt) []sql.Expr {
+	exprs := []sql.Expr{stmt.Where, stmt.Having}
+	aliases := make(map[string]bool)
+	for _, item := range stmt.Items {
+		exprs = append(exprs, item.Expr)
+		aliases[item.Alias] = true
+	}
+	for _, join := range stmt.Joins {
+		exprs = append(exprs, join.On)
+	}
+	exprs = append(exprs, stmt.GroupBy...)
+	for _, item := range stmt.OrderBy {
+		// ORDER BY 中的别名在 newSelectPlan 中解析
+		if ref, ok := item.Expr.(*sql.ColumnRef); ok && ref.Table == "" && aliases[ref.Name] {
+			continue
+		}
+		exprs = append(exprs, item.Expr)
+	}
+	return exprs
+}
+
+func executeUpdate(stmt *sql.UpdateStmt, database *db.Database) protocol.Response {
+	table, err := database.GetTable(stmt.Table)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	filter, err := newRowFilter(stmt.Where, tableColumnTypes(stmt.Table, table))
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	values := make(map[string]interface{})
+	for _, assign := range stmt.Set {
+		value, err := evalValue(assign.Value, database)
+		if err != nil {
+			return protocol.Response{Success: false, Error: err.Error()}
+		}
+		values[assign.Column] = value
+	}
+
+	if err := table.Update(filter.check, values, whereLookups(stmt.Where, stmt.Table)...); err != nil {
+		return errorResponse(err)
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+func executeDelete(stmt *sql.DeleteStmt, database *db.Database) protocol.Response {
+	table, err := database.GetTable(stmt.Table)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	filter, err := newRowFilter(stmt.Where, tableColumnTypes(stmt.Table, table))
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	count, err := table.Delete(filter.check, whereLookups(stmt.Where, stmt.Table)...)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{
+		Success: true,
+		Data:    fmt.Sprintf("Deleted %d records", count),
+	}
+}
+
+// rowFilter 把 WHERE 表达式包装成 db 包使用的行过滤函数。查询使用 match，
+// 求值过程中的第一个错误记录在 err 中，之后的行都视为不匹配；
+// 修改使用 check，错误直接返回给表，在修改任何行之前中止
+type rowFilter struct {
+	expr sql.Expr
+	err  error
+}
+
+// newRowFilter 在扫描之前按列类型校验 WHERE 条件
+func newRowFilter(where sql.Expr, columnTypes map[string]string) (*rowFilter, error) {
+	if err := sql.Check(where, columnTypes); err != nil {
+		return nil, err
+	}
+	return &rowFilter{expr: where}, nil
+}
+
+// tableColumnTypes 返回单表语句中可以引用的列类型，列名可以用表名限定
+func tableColumnTypes(name string, table *db.Table) map[string]string {
+	columnTypes := make(map[string]string)
+	for _, col := range table.GetColumns() {
+		columnTypes[col.Name] = col.Type.String()
+		columnTypes[name+"."+col.Name] = col.Type.String()
+	}
+	return columnTypes
+}
+
+// whereLookups 从 WHERE 的 AND 分支中提取列与常量的比较（=、<、<=、>、>=、BETWEEN），
+// 交给表选择索引。name 为语句中引用表的名字，用于识别限定列
+func whereLookups(where sql.Expr, name string) []db.Lookup {
+	if where == nil {
+		return nil
+	}
+	column := func(expr sql.Expr) (string, bool) {
+		ref, ok := expr.(*sql.ColumnRef)
+		if !ok || (ref.Table != "" && ref.Table != name) {
+			return "", false
+		}
+		return ref.Name, true
+	}
+	literal := func(expr sql.Expr) (interface{}, bool) {
+		lit, ok := expr.(*sql.Literal)
+		if !ok {
+			return nil, false
+		}
+		return lit.Value, true
+	}
+
+	lookups := make([]db.Lookup, 0)
+	for _, cond := range conjuncts(where) {
+		switch e := cond.(type) {
+		case *sql.BinaryExpr:
+			if _, ok := flippedOps[e.Op]; !ok {
+				continue
+			}
+			if col, ok := column(e.Left); ok {
+				if value, ok := literal(e.Right); ok {
+					lookups = append(lookups, db.Lookup{Column: col, Op: e.Op, Value: value})
+				}
+			} else if col, ok := column(e.Right); ok {
+				if value, ok := literal(e.Left); ok {
+					lookups = append(lookups, db.Lookup{Column: col, Op: flippedOps[e.Op], Value: value})
+				}
+			}
+		case *sql.BetweenExpr:
+			col, ok := column(e.Expr)
+			low, lowOK := literal(e.Low)
+			high, highOK := literal(e.High)
+			if ok && lowOK && highOK && !e.Not {
+				lookups = append(lookups,
+					db.Lookup{Column: col, Op: ">=", Value: low},
+					db.Lookup{Column: col, Op: "<=", Value: high})
+			}
+		}
+	}
+	return lookups
+}
+
+// flippedOps 是可以用索引求值的比较运算符，值为交换左右两侧之后的运算符
+var flippedOps = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// orderedSelect 在单表、不分组、带 LIMIT 且 ORDER BY 都是同方向的列时，
+// 尝试按有序索引的顺序只读取前 offset+limit 行，返回 false 时需要扫描全表
+func orderedSelect(stmt *sql.SelectStmt, plan *selectPlan, table *db.Table, filter *rowFilter) ([]map[string]interface{}, bool) {
+	if plan.grouped || plan.limit == nil || len(plan.orderBy) == 0 {
+		return nil, false
+	}
+	columns := make([]string, 0, len(plan.orderBy))
+	desc := plan.orderBy[0].Desc
+	for _, item := range plan.orderBy {
+		ref, ok := item.Expr.(*sql.ColumnRef)
+		if !ok || item.Desc != desc || (ref.Table != "" && ref.Table != stmt.From.RefName()) {
+			return nil, false
+		}
+		columns = append(columns, ref.Name)
+	}
+
+	limit := *plan.limit
+	if plan.offset != nil {
+		limit += *plan.offset
+	}
+	return table.SelectOrdered(filter.match, columns, desc, limit, whereLookups(stmt.Where, stmt.From.RefName())...)
+}
+
+func (f *rowFilter) match(row map[string]interface{}) bool {
+	if f.err != nil {
+		return false
+	}
+	ok, err := sql.Match(f.expr, row)
+	if err != nil {
+		f.err = err
+		return false
+	}
+	return ok
+}
+
+func (f *rowFilter) check(row map[string]interface{}) (bool, error) {
+	return sql.Match(f.expr, row)
+}
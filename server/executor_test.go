@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liubaotong/mem-db/server/db"
+	"github.com/liubaotong/mem-db/server/protocol"
+)
+
+// newTestSession 返回内存数据库上的会话，自动保存只在关闭时写入临时目录，备份也在临时目录中
+func newTestSession(t *testing.T) *session {
+	t.Helper()
+	database := db.NewDatabase()
+	*backupDir = filepath.Join(t.TempDir(), "backups")
+	saver = newAutoSaver(database, filepath.Join(t.TempDir(), "database.json"), savePolicy{mode: saveShutdown})
+	return newSession(database)
+}
+
+// execStep 是依次执行的一条 SQL：err 不为空时期望失败且错误信息包含 err，
+// 否则 data 不为空时比较结果的 JSON 编码
+type execStep struct {
+	sql  string
+	data string
+	err  string
+}
+
+func runSteps(t *testing.T, sess *session, steps []execStep) {
+	t.Helper()
+	for _, step := range steps {
+		resp := handleExecSQL(protocol.ExecSQLPayload{SQL: step.sql}, sess)
+		if step.err != "" {
+			if resp.Success || !strings.Contains(resp.Error, step.err) {
+				t.Errorf("%s: got success=%v error=%q, want error containing %q", step.sql, resp.Success, resp.Error, step.err)
+			}
+			continue
+		}
+		if !resp.Success {
+			t.Errorf("%s: %s", step.sql, resp.Error)
+			continue
+		}
+		if step.data == "" {
+			continue
+		}
+		data, err := json.Marshal(resp.Data)
+		if err != nil {
+			t.Fatalf("%s: %v", step.sql, err)
+		}
+		if string(data) != step.data {
+			t.Errorf("%s:\n got %s\nwant %s", step.sql, data, step.data)
+		}
+	}
+}
+
+func TestExecuteStatements(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []execStep
+	}{
+		{"insert and select", []execStep{
+			{sql: "CREATE TABLE t (id int, name string)"},
+			{sql: "INSERT INTO t VALUES (1, 'a, b'), (2, 'it''s')", data: `{"inserted":2}`},
+			{sql: "INSERT INTO t (name, id) VALUES ('c', 3)"},
+			{sql: "SELECT * FROM t WHERE id = 2", data: `{"columns":["id","name"],"rows":[[2,"it's"]]}`},
+			{sql: "SELECT * FROM t WHERE name = 'a, b' AND id = 1", data: `{"columns":["id","name"],"rows":[[1,"a, b"]]}`},
+			{sql: "SELECT * FROM missing", err: "does not exist"},
+			{sql: "INSERT INTO t VALUES (1)", err: "expected 2 values"},
+		}},
+		{"projection and ordering", []execStep{
+			{sql: "CREATE TABLE t (id int, name string, age int)"},
+			{sql: "INSERT INTO t VALUES (1, 'a', 30), (2, 'b', 5), (3, 'c', 20), (4, 'd', 30)"},
+			{sql: "SELECT name FROM t WHERE age > 10 ORDER BY age, id DESC", data: `{"columns":["name"],"rows":[["c"],["d"],["a"]]}`},
+			{sql: "SELECT name AS n, age FROM t ORDER BY n DESC LIMIT 2", data: `{"columns":["n","age"],"rows":[["d",30],["c",20]]}`},
+			{sql: "SELECT id FROM t ORDER BY id LIMIT 2 OFFSET 1", data: `{"columns":["id"],"rows":[[2],[3]]}`},
+			{sql: "SELECT id FROM t OFFSET 10", data: `{"columns":["id"],"rows":[]}`},
+			{sql: "SELECT id, name FROM t ORDER BY 2 DESC LIMIT 1", data: `{"columns":["id","name"],"rows":[[4,"d"]]}`},
+			{sql: "SELECT * FROM t WHERE age > 10 ORDER BY 3, 1 DESC", data: `{"columns":["id","name","age"],"rows":[[3,"c",20],[4,"d",30],[1,"a",30]]}`},
+			{sql: "SELECT id FROM t ORDER BY 2", err: "ORDER BY position 2 is not in select list"},
+			{sql: "SELECT id FROM t ORDER BY 0", err: "ORDER BY position 0"},
+			{sql: "SELECT id FROM t ORDER BY 'x'", err: "not a select list position"},
+			{sql: "SELECT missing FROM t", err: "does not exist"},
+		}},
+		{"aggregates", []execStep{
+			{sql: "CREATE TABLE t (id int, name string, age int)"},
+			{sql: "INSERT INTO t VALUES (1, 'a', 30), (2, 'b', 5), (3, 'a', 20), (4, 'c', 30)"},
+			{sql: "SELECT COUNT(*), SUM(age), AVG(id), MIN(name), MAX(age) FROM t", data: `{"columns":["COUNT(*)","SUM(age)","AVG(id)","MIN(name)","MAX(age)"],"rows":[[4,85,2.5,"a",30]]}`},
+			{sql: "SELECT name, COUNT(*) AS n FROM t GROUP BY name HAVING SUM(age) > 10 ORDER BY 2 DESC, name", data: `{"columns":["name","n"],"rows":[["a",2],["c",1]]}`},
+			{sql: "SELECT COUNT(*) FROM t WHERE id > 10", data: `{"columns":["COUNT(*)"],"rows":[[0]]}`},
+			{sql: "SELECT name, age FROM t GROUP BY name", err: "must appear in GROUP BY"},
+			{sql: "SELECT SUM(name) FROM t", err: "numeric"},
+		}},
+		{"join", []execStep{
+			{sql: "CREATE TABLE u (id int, name string)"},
+			{sql: "CREATE TABLE o (id int, uid int, total int)"},
+			{sql: "INSERT INTO u VALUES (1, 'a'), (2, 'b')"},
+			{sql: "INSERT INTO o VALUES (1, 1, 10), (2, 1, 5), (3, 9, 7)"},
+			{sql: "SELECT u.name, o.total FROM u JOIN o ON u.id = o.uid ORDER BY o.total", data: `{"columns":["name","total"],"rows":[["a",5],["a",10]]}`},
+			{sql: "SELECT x.name, SUM(y.total) AS s FROM u x LEFT JOIN o y ON x.id = y.uid GROUP BY x.name ORDER BY x.name",
+				data: `{"columns":["name","s"],"rows":[["a",15],["b",null]]}`},
+			{sql: "SELECT * FROM u JOIN o ON u.id = o.uid WHERE o.id = 2", data: `{"columns":["u.id","name","o.id","uid","total"],"rows":[[1,"a",2,1,5]]}`},
+			{sql: "SELECT o.* FROM u JOIN o ON u.id = o.uid WHERE total = 5", data: `{"columns":["o.id","uid","total"],"rows":[[2,1,5]]}`},
+			{sql: "SELECT id FROM u JOIN o ON u.id = o.uid", err: "ambiguous"},
+			{sql: "SELECT u.name FROM u JOIN o ON u.id = x.uid", err: "x"},
+		}},
+		{"update and delete", []execStep{
+			{sql: "CREATE TABLE t (id int, name string)"},
+			{sql: "INSERT INTO t VALUES (1, 'a'), (2, 'b')"},
+			{sql: "UPDATE t SET name = 'x y' WHERE id = 1"},
+			{sql: "UPDATE t SET name = 'z' WHERE id = 999", err: "no matching records"},
+			{sql: "DELETE FROM t WHERE id = 2", data: `"Deleted 1 records"`},
+			{sql: "SELECT * FROM t", data: `{"columns":["id","name"],"rows":[[1,"x y"]]}`},
+		}},
+		{"where operators", []execStep{
+			{sql: "CREATE TABLE t (id int, name string)"},
+			{sql: "INSERT INTO t VALUES (1, 'apple'), (2, 'banana'), (3, 'cherry')"},
+			{sql: "SELECT * FROM t WHERE id IN (1, 3) AND name LIKE '%e%'", data: `{"columns":["id","name"],"rows":[[1,"apple"],[3,"cherry"]]}`},
+			{sql: "SELECT * FROM t WHERE NOT (id BETWEEN 2 AND 3) OR name = 'banana'", data: `{"columns":["id","name"],"rows":[[1,"apple"],[2,"banana"]]}`},
+			{sql: "SELECT * FROM t WHERE name = 1", err: "cannot compare"},
+			{sql: "SELECT * FROM t WHERE missing = 1", err: "does not exist"},
+			{sql: "UPDATE t SET name = 'x' WHERE id", err: "boolean"},
+			{sql: "DELETE FROM t WHERE name NOT LIKE 'b%'", data: `"Deleted 2 records"`},
+			{sql: "SELECT * FROM t", data: `{"columns":["id","name"],"rows":[[2,"banana"]]}`},
+		}},
+		{"drop, rename and truncate", []execStep{
+			{sql: "CREATE TABLE t (id int)"},
+			{sql: "CREATE TABLE u (id int)"},
+			{sql: "INSERT INTO t VALUES (1), (2)"},
+			{sql: "ALTER TABLE t RENAME TO u", err: "already exists"},
+			{sql: "ALTER TABLE t RENAME TO v"},
+			{sql: "SELECT * FROM t", err: "does not exist"},
+			{sql: "TRUNCATE TABLE v", data: `"Deleted 2 records"`},
+			{sql: "SELECT * FROM v", data: `{"columns":["id"],"rows":[]}`},
+			{sql: "DROP TABLE v"},
+			{sql: "DROP TABLE v", err: "does not exist"},
+			{sql: "DROP TABLE IF EXISTS v"},
+			{sql: "CREATE TABLE v (name string)"},
+		}},
+		{"alter table", []execStep{
+			{sql: "CREATE TABLE t (id int, code string)"},
+			{sql: "INSERT INTO t VALUES (1, '10'), (2, '20')"},
+			{sql: "ALTER TABLE t ADD COLUMN note string"},
+			{sql: "ALTER TABLE t ADD COLUMN n int DEFAULT 5"},
+			{sql: "ALTER TABLE t ADD COLUMN m int DEFAULT 'x'", err: "invalid default"},
+			{sql: "SELECT * FROM t WHERE note IS NULL AND n = 5", data: `{"columns":["id","code","note","n"],"rows":[[1,"10",null,5],[2,"20",null,5]]}`},
+			{sql: "UPDATE t SET code = 'x' WHERE id = 2"},
+			{sql: "ALTER TABLE t MODIFY code int", err: "cannot convert"},
+			{sql: "UPDATE t SET code = '20' WHERE id = 2"},
+			{sql: "ALTER TABLE t MODIFY COLUMN code int"},
+			{sql: "SELECT SUM(code) FROM t", data: `{"columns":["SUM(code)"],"rows":[[30]]}`},
+			{sql: "ALTER TABLE t RENAME COLUMN code TO amount"},
+			{sql: "ALTER TABLE t DROP COLUMN note"},
+			{sql: "SELECT * FROM t WHERE id = 1", data: `{"columns":["id","amount","n"],"rows":[[1,10,5]]}`},
+			{sql: "ALTER TABLE t RENAME COLUMN id TO n", err: "already exists"},
+			{sql: "ALTER TABLE t DROP COLUMN missing", err: "does not exist"},
+		}},
+		{"null and default", []execStep{
+			{sql: "CREATE TABLE t (id int NOT NULL, name string DEFAULT 'anon', age int)"},
+			{sql: "INSERT INTO t (id) VALUES (1)"},
+			{sql: "INSERT INTO t VALUES (2, NULL, NULL)"},
+			{sql: "INSERT INTO t (name) VALUES ('x')", err: "cannot be null"},
+			{sql: "INSERT INTO t (id, missing) VALUES (3, 1)", err: "column missing does not exist"},
+			{sql: "UPDATE t SET id = NULL WHERE id = 1", err: "cannot be null"},
+			{sql: "SELECT * FROM t ORDER BY id", data: `{"columns":["id","name","age"],"rows":[[1,"anon",null],[2,null,null]]}`},
+			{sql: "ALTER TABLE t ADD COLUMN flag int NOT NULL", err: "needs a default value"},
+			{sql: "ALTER TABLE t ADD COLUMN flag int NOT NULL DEFAULT 0"},
+			{sql: "SELECT id, flag FROM t WHERE flag = 0", data: `{"columns":["id","flag"],"rows":[[1,0],[2,0]]}`},
+		}},
+		{"constraints", []execStep{
+			{sql: "CREATE TABLE t (id int PRIMARY KEY, email string UNIQUE, a int, b int, UNIQUE (a, b))"},
+			{sql: "INSERT INTO t VALUES (1, 'x', 1, 1), (2, NULL, 1, 2), (3, NULL, NULL, 1)"},
+			{sql: "INSERT INTO t VALUES (1, 'y', 5, 5)", err: "primary key (id)"},
+			{sql: "INSERT INTO t VALUES (4, 'x', 5, 5)", err: "unique key (email)"},
+			{sql: "INSERT INTO t VALUES (4, 'z', 1, 2)", err: "unique key (a, b)"},
+			{sql: "INSERT INTO t VALUES (4, 'z', NULL, 1)"},
+			{sql: "INSERT INTO t (email) VALUES ('w')", err: "cannot be null"},
+			{sql: "UPDATE t SET id = 2 WHERE id = 1", err: "primary key (id)"},
+			{sql: "UPDATE t SET email = 'v' WHERE id > 1", err: "unique key (email)"},
+			{sql: "UPDATE t SET email = 'x' WHERE id = 1"},
+			{sql: "UPDATE t SET id = 4 WHERE id = 4"},
+			{sql: "DELETE FROM t WHERE id = 1"},
+			{sql: "INSERT INTO t VALUES (1, 'x', 1, 1)"},
+			{sql: "ALTER TABLE t ADD COLUMN c int UNIQUE DEFAULT 7", err: "unique key (c)"},
+			{sql: "ALTER TABLE t RENAME COLUMN email TO mail"},
+			{sql: "INSERT INTO t (id, mail) VALUES (5, 'x')", err: "unique key (mail)"},
+			{sql: "ALTER TABLE t DROP COLUMN a", err: "used by unique key (a, b)"},
+			{sql: "ALTER TABLE t DROP COLUMN mail"},
+			{sql: "TRUNCATE t"},
+			{sql: "INSERT INTO t VALUES (1, 1, 1)"},
+		}},
+		{"auto increment and sequences", []execStep{
+			{sql: "CREATE TABLE t (id int AUTO_INCREMENT PRIMARY KEY, name string)"},
+			{sql: "INSERT INTO t (name) VALUES ('a'), ('b')", data: `{"inserted":2,"last_insert_id":2,"ids":[1,2]}`},
+			{sql: "INSERT INTO t VALUES (10, 'c')", data: `{"inserted":1,"last_insert_id":10,"ids":[10]}`},
+			{sql: "INSERT INTO t (name) VALUES ('d')", data: `{"inserted":1,"last_insert_id":11,"ids":[11]}`},
+			{sql: "UPDATE t SET id = 20 WHERE id = 11"},
+			{sql: "INSERT INTO t (name) VALUES ('e')", data: `{"inserted":1,"last_insert_id":21,"ids":[21]}`},
+			{sql: "TRUNCATE t"},
+			{sql: "INSERT INTO t (name) VALUES ('f')", data: `{"inserted":1,"last_insert_id":1,"ids":[1]}`},
+			{sql: "CREATE TABLE u (id int AUTO_INCREMENT, n int AUTO_INCREMENT)", err: "multiple AUTO_INCREMENT"},
+			{sql: "CREATE SEQUENCE s START WITH 100 INCREMENT BY 10"},
+			{sql: "CREATE TABLE u (id int, name string)"},
+			{sql: "INSERT INTO u VALUES (NEXTVAL('s'), 'a'), (NEXTVAL('s'), 'b')"},
+			{sql: "SELECT id FROM u", data: `{"columns":["id"],"rows":[[100],[110]]}`},
+			{sql: "INSERT INTO u VALUES (NEXTVAL('missing'), 'c')", err: "sequence missing does not exist"},
+			{sql: "DROP SEQUENCE s"},
+			{sql: "DROP SEQUENCE IF EXISTS s"},
+		}},
+		{"indexes", []execStep{
+			{sql: "CREATE TABLE t (id int, name string)"},
+			{sql: "INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'b')"},
+			{sql: "CREATE INDEX idx_name ON t (name)"},
+			{sql: "CREATE INDEX idx_name ON t (id)", err: "already exists"},
+			{sql: "CREATE UNIQUE INDEX idx_id ON t (id)"},
+			{sql: "CREATE UNIQUE INDEX idx_dup ON t (name)", err: "duplicate value"},
+			{sql: "SELECT id FROM t WHERE name = 'b' AND id > 2", data: `{"columns":["id"],"rows":[[3]]}`},
+			{sql: "INSERT INTO t VALUES (3, 'c')", err: "duplicate value"},
+			{sql: "UPDATE t SET name = 'c' WHERE name = 'b'"},
+			{sql: "SELECT id FROM t WHERE name = 'c'", data: `{"columns":["id"],"rows":[[2],[3]]}`},
+			{sql: "DELETE FROM t WHERE id = 1"},
+			{sql: "SELECT id FROM t WHERE id = 3", data: `{"columns":["id"],"rows":[[3]]}`},
+			{sql: "DROP INDEX idx_id ON t"},
+			{sql: "DROP INDEX idx_id ON t", err: "does not exist"},
+			{sql: "INSERT INTO t VALUES (3, 'd')"},
+		}},
+		{"ordered indexes", []execStep{
+			{sql: "CREATE TABLE t (id int, score int)"},
+			{sql: "INSERT INTO t VALUES (1, 30), (2, 10), (3, 20), (4, 10), (5, NULL)"},
+			{sql: "CREATE INDEX idx_score ON t (score) USING btree", err: "invalid index type"},
+			{sql: "CREATE INDEX idx_score ON t (score) USING ordered"},
+			{sql: "SELECT id FROM t WHERE score > 10 AND score <= 30", data: `{"columns":["id"],"rows":[[1],[3]]}`},
+			{sql: "SELECT id FROM t WHERE score BETWEEN 10 AND 20", data: `{"columns":["id"],"rows":[[2],[3],[4]]}`},
+			{sql: "SELECT id FROM t ORDER BY score LIMIT 3", data: `{"columns":["id"],"rows":[[5],[2],[4]]}`},
+			{sql: "SELECT id FROM t ORDER BY score DESC LIMIT 2", data: `{"columns":["id"],"rows":[[1],[3]]}`},
+			{sql: "UPDATE t SET score = 40 WHERE id = 2"},
+			{sql: "DELETE FROM t WHERE id = 1"},
+			{sql: "SELECT id FROM t WHERE score >= 20 ORDER BY score DESC LIMIT 5", data: `{"columns":["id"],"rows":[[2],[3]]}`},
+		}},
+		{"value comparison", []execStep{
+			{sql: "CREATE TABLE t (id int, name string)"},
+			{sql: "INSERT INTO t VALUES (9007199254740993, 'a'), (9007199254740992, 'b'), (1, 'c')"},
+			{sql: "SELECT name FROM t WHERE id = 9007199254740993", data: `{"columns":["name"],"rows":[["a"]]}`},
+			{sql: "SELECT name FROM t WHERE id > 1 ORDER BY id DESC", data: `{"columns":["name"],"rows":[["a"],["b"]]}`},
+			{sql: "SELECT SUM(id) FROM t WHERE id > 1", data: `{"columns":["SUM(id)"],"rows":[[18014398509481985]]}`},
+			{sql: "SELECT name FROM t WHERE name > 1", err: "cannot compare"},
+		}},
+		{"column types", []execStep{
+			{sql: "CREATE TABLE t (id int, f float, b bool, ts timestamp, data bytes, doc json)"},
+			{sql: `INSERT INTO t VALUES (1, 1.5, TRUE, '2024-01-02T03:04:05Z', 'AAH/', '"hello"'),
+				(2, 2, FALSE, TIMESTAMP '2024-01-03 00:00:00', NULL, '{"b": 2.0, "a": [1]}'),
+				(3, NULL, NULL, NULL, NULL, '2.50')`},
+			{sql: "SELECT id, doc FROM t ORDER BY id", data: `{"columns":["id","doc"],"rows":[[1,"hello"],[2,{"a":[1],"b":2}],[3,2.5]]}`},
+			{sql: "SELECT id FROM t WHERE f > 1.2 AND b = TRUE", data: `{"columns":["id"],"rows":[[1]]}`},
+			{sql: "SELECT id FROM t WHERE ts > '2024-01-02T12:00:00Z'", data: `{"columns":["id"],"rows":[[2]]}`},
+			{sql: "SELECT id, data FROM t WHERE data = 'AAH/'", data: `{"columns":["id","data"],"rows":[[1,"AAH/"]]}`},
+			{sql: "SELECT id FROM t WHERE doc = '{\"a\":[1],\"b\":2.0}'", data: `{"columns":["id"],"rows":[[2]]}`},
+			{sql: "SELECT SUM(f), AVG(f) FROM t", data: `{"columns":["SUM(f)","AVG(f)"],"rows":[[3.5,1.75]]}`},
+			{sql: "INSERT INTO t (id, doc) VALUES (4, '{bad')", err: "invalid json"},
+			{sql: "INSERT INTO t (id, ts) VALUES (4, 'yesterday')", err: "invalid timestamp"},
+			{sql: "INSERT INTO t (id, b) VALUES (4, 1)", err: "expected bool"},
+			{sql: "SELECT id FROM t WHERE b > 'x'", err: "cannot compare"},
+		}},
+		{"transactions", []execStep{
+			{sql: "CREATE TABLE t (id int PRIMARY KEY, name string)"},
+			{sql: "INSERT INTO t VALUES (1, 'a')"},
+			{sql: "BEGIN"},
+			{sql: "BEGIN", err: "already in progress"},
+			{sql: "INSERT INTO t VALUES (2, 'b')"},
+			{sql: "SAVEPOINT s1"},
+			{sql: "UPDATE t SET name = 'x'"},
+			{sql: "SELECT name FROM t ORDER BY id", data: `{"columns":["name"],"rows":[["x"],["x"]]}`},
+			{sql: "ROLLBACK TO SAVEPOINT s1"},
+			{sql: "SELECT name FROM t ORDER BY id", data: `{"columns":["name"],"rows":[["a"],["b"]]}`},
+			{sql: "RELEASE SAVEPOINT s1"},
+			{sql: "ROLLBACK TO s1", err: "s1"},
+			{sql: "DROP TABLE t", err: "not allowed in a transaction"},
+			{sql: "COMMIT"},
+			{sql: "SELECT COUNT(*) FROM t", data: `{"columns":["COUNT(*)"],"rows":[[2]]}`},
+			{sql: "START TRANSACTION"},
+			{sql: "DELETE FROM t"},
+			{sql: "ROLLBACK"},
+			{sql: "SELECT COUNT(*) FROM t", data: `{"columns":["COUNT(*)"],"rows":[[2]]}`},
+			{sql: "COMMIT", err: "no transaction in progress"},
+		}},
+		{"multi-row insert is atomic", []execStep{
+			{sql: "CREATE TABLE t (id int, name string)"},
+			{sql: "INSERT INTO t VALUES (1, 'a'), (2, 3)", err: "row 2"},
+			{sql: "SELECT * FROM t", data: `{"columns":["id","name"],"rows":[]}`},
+			{sql: "CREATE TABLE u (id int AUTO_INCREMENT PRIMARY KEY, name string NOT NULL)"},
+			{sql: "INSERT INTO u (name) VALUES ('a'), (NULL)", err: "row 2"},
+			{sql: "INSERT INTO u (id, name) VALUES (5, 'a'), (5, 'b')", err: "row 2: duplicate value"},
+			{sql: "SELECT COUNT(*) FROM u", data: `{"columns":["COUNT(*)"],"rows":[[0]]}`},
+			{sql: "INSERT INTO u (name) VALUES ('a'), ('b')", data: `{"inserted":2,"last_insert_id":2,"ids":[1,2]}`},
+		}},
+		{"autosave", []execStep{
+			{sql: "SHOW AUTOSAVE", data: `{"policy":"shutdown","unsaved":0}`},
+			{sql: "CREATE TABLE t (id int)"},
+			{sql: "INSERT INTO t VALUES (1)"},
+			{sql: "INSERT INTO t VALUES ('x')", err: "expected int"},
+			{sql: "SHOW AUTOSAVE", data: `{"policy":"shutdown","unsaved":2}`},
+			{sql: "SET AUTOSAVE = 'writes:0'", err: "invalid autosave write count"},
+			{sql: "SET AUTOSAVE TO 'writes:10'", data: `{"policy":"writes:10","unsaved":2}`},
+			{sql: "SET AUTOSAVE 'sync'", data: `{"policy":"sync","unsaved":2}`},
+			{sql: "INSERT INTO t VALUES (2)"},
+			{sql: "SHOW AUTOSAVE", data: `{"policy":"sync","unsaved":0}`},
+		}},
+		{"backup and restore", []execStep{
+			{sql: "CREATE TABLE t (id int PRIMARY KEY)"},
+			{sql: "INSERT INTO t VALUES (1)"},
+			{sql: "BACKUP TO 'daily/t.json'"},
+			{sql: "BACKUP TO 'daily/t.json'", err: "already exists"},
+			{sql: "BACKUP TO '../t.json'", err: "invalid backup file"},
+			{sql: "BACKUP TO '/tmp/t.json'", err: "invalid backup file"},
+			{sql: "RESTORE FROM 'daily/../../t.json'", err: "invalid backup file"},
+			{sql: "INSERT INTO t VALUES (2)"},
+			{sql: "RESTORE FROM 'daily/t.json' TABLES t"},
+			{sql: "SELECT id FROM t", data: `{"columns":["id"],"rows":[[1]]}`},
+			{sql: "BEGIN"},
+			{sql: "RESTORE FROM 'daily/t.json'", err: "not allowed in a transaction"},
+			{sql: "ROLLBACK"},
+		}},
+		{"script", []execStep{
+			{sql: "CREATE TABLE t (id int); INSERT INTO t VALUES (1); SELECT * FROM t", data: `{"columns":["id"],"rows":[[1]]}`},
+			{sql: "INSERT INTO t VALUES (2); INSERT INTO t VALUES ('x'); INSERT INTO t VALUES (3)", err: "expected int"},
+			{sql: "SELECT * FROM t", data: `{"columns":["id"],"rows":[[1],[2]]}`},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, newTestSession(t), tt.steps)
+		})
+	}
+}
+
+// 两个连接的事务修改同一行，后写入的一方失败；事务只读取开始时的快照
+func TestTransactionConflict(t *testing.T) {
+	a := newTestSession(t)
+	b := newSession(a.database)
+	runSteps(t, a, []execStep{
+		{sql: "CREATE TABLE t (id int PRIMARY KEY, n int)"},
+		{sql: "INSERT INTO t VALUES (1, 0)"},
+		{sql: "BEGIN"},
+		{sql: "UPDATE t SET n = 1"},
+	})
+	runSteps(t, b, []execStep{
+		{sql: "BEGIN"},
+		{sql: "SELECT n FROM t", data: `{"columns":["n"],"rows":[[0]]}`},
+		{sql: "UPDATE t SET n = 2", err: "write conflict"},
+	})
+	runSteps(t, a, []execStep{{sql: "COMMIT"}})
+	runSteps(t, b, []execStep{
+		{sql: "SELECT n FROM t", data: `{"columns":["n"],"rows":[[0]]}`},
+		{sql: "ROLLBACK"},
+		{sql: "SELECT n FROM t", data: `{"columns":["n"],"rows":[[1]]}`},
+	})
+
+	// 唯一约束在提交后的表上仍然有效
+	runSteps(t, b, []execStep{
+		{sql: "BEGIN"},
+		{sql: "INSERT INTO t VALUES (2, 0)"},
+		{sql: "COMMIT"},
+		{sql: "INSERT INTO t VALUES (2, 0)", err: "duplicate value"},
+	})
+}
+
+// 备份文件只能是备份目录中的相对路径
+func TestBackupPath(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"b.json", true},
+		{"sub/b.json", true},
+		{"b..json", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../b.json", false},
+		{"sub/../../b.json", false},
+		{"sub/../b.json", false},
+	}
+	for _, tt := range tests {
+		path, err := backupPath(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("backupPath(%q) = %q, %v; want ok=%v", tt.name, path, err, tt.ok)
+		}
+		if err == nil && !strings.HasPrefix(path, filepath.Clean(*backupDir)+string(filepath.Separator)) {
+			t.Errorf("backupPath(%q) = %q is outside %s", tt.name, path, *backupDir)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/liubaotong/mem-db/server/db"
+	"github.com/liubaotong/mem-db/server/sql"
+)
+
+// sourceTable 是 FROM 子句中的一张表，name 为查询中引用它的名字（别名或表名）
+type sourceTable struct {
+	name    string
+	table   *db.Table
+	columns []db.Column
+}
+
+// scope 是 SELECT 可见的全部表，按 FROM、JOIN 的顺序排列
+type scope struct {
+	tables []*sourceTable
+	counts map[string]int // 列名在各表中出现的次数，大于 1 时必须用表名限定
+}
+
+func newScope(database *db.Database, refs ...sql.TableRef) (*scope, error) {
+	sc := &scope{counts: make(map[string]int)}
+	for _, ref := range refs {
+		if sc.lookup(ref.RefName()) != nil {
+			return nil, fmt.Errorf("table name %s specified more than once", ref.RefName())
+		}
+		table, err := database.GetTable(ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		src := &sourceTable{name: ref.RefName(), table: table, columns: table.GetColumns()}
+		for _, col := range src.columns {
+			sc.counts[col.Name]++
+		}
+		sc.tables = append(sc.tables, src)
+	}
+	return sc, nil
+}
+
+func (sc *scope) lookup(name string) *sourceTable {
+	for _, src := range sc.tables {
+		if src.name == name {
+			return src
+		}
+	}
+	return nil
+}
+
+// columnTypes 返回前 n 张表的列类型，限定列以 "表.列" 为键，
+// 不会产生歧义的列同时以列名为键
+func (sc *scope) columnTypes(n int) map[string]string {
+	columnTypes := make(map[string]string)
+	for _, src := range sc.tables[:n] {
+		for _, col := range src.columns {
+			columnTypes[src.name+"."+col.Name] = col.Type.String()
+			if sc.counts[col.Name] == 1 {
+				columnTypes[col.Name] = col.Type.String()
+			}
+		}
+	}
+	return columnTypes
+}
+
+// checkAmbiguous 拒绝引用多张表中同名列却没有用表名限定的表达式
+func (sc *scope) checkAmbiguous(exprs ...sql.Expr) error {
+	var err error
+	for _, expr := range exprs {
+		sql.Walk(expr, func(e sql.Expr) bool {
+			if ref, ok := e.(*sql.ColumnRef); ok && ref.Table == "" && sc.counts[ref.Name] > 1 {
+				err = fmt.Errorf("column reference %s is ambiguous", ref.Name)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// join 依次执行各个连接，返回以 "表.列" 及无歧义列名为键的行。
+// ON 条件中含有左右两侧之间的等值比较时使用哈希连接，否则使用嵌套循环连接
+func (sc *scope) join(joins []sql.JoinClause) ([]map[string]interface{}, error) {
+	first := sc.tables[0]
+	rows := make([]map[string]interface{}, 0)
+	for _, row := range first.table.Select(nil) {
+		rows = append(rows, sc.merge(nil, first, row))
+	}
+
+	for i, join := range joins {
+		right := sc.tables[i+1]
+		rightRows := right.table.Select(nil)
+
+		var err error
+		if leftKey, rightKey := sc.equiJoinKeys(join.On, i+1); leftKey != nil {
+			rows, err = sc.hashJoin(rows, right, rightRows, join, leftKey, rightKey)
+		} else {
+			rows, err = sc.nestedLoopJoin(rows, right, rightRows, join)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+func (sc *scope) hashJoin(left []map[string]interface{}, right *sourceTable, rightRows []map[string]interface{},
+	join sql.JoinClause, leftKey, rightKey sql.Expr) ([]map[string]interface{}, error) {
+	buckets := make(map[string][]map[string]interface{})
+	for _, row := range rightRows {
+		key, ok, err := joinKey(rightKey, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			buckets[key] = append(buckets[key], row)
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(left))
+	for _, leftRow := range left {
+		key, ok, err := joinKey(leftKey, leftRow)
+		if err != nil {
+			return nil, err
+		}
+		matched := false
+		if ok {
+			// 其余的 ON 条件仍需在候选行上求值
+			for _, rightRow := range buckets[key] {
+				row := sc.merge(leftRow, right, rightRow)
+				if ok, err := sql.Match(join.On, row); err != nil {
+					return nil, err
+				} else if ok {
+					result = append(result, row)
+					matched = true
+				}
+			}
+		}
+		if !matched && join.Type == sql.LeftJoin {
+			result = append(result, sc.merge(leftRow, right, nil))
+		}
+	}
+	return result, nil
+}
+
+func (sc *scope) nestedLoopJoin(left []map[string]interface{}, right *sourceTable, rightRows []map[string]interface{},
+	join sql.JoinClause) ([]map[string]interface{}, error) {
+	result := make([]map[string]interface{}, 0, len(left))
+	for _, leftRow := range left {
+		matched := false
+		for _, rightRow := range rightRows {
+			row := sc.merge(leftRow, right, rightRow)
+			ok, err := sql.Match(join.On, row)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result = append(result, row)
+				matched = true
+			}
+		}
+		if !matched && join.Type == sql.LeftJoin {
+			result = append(result, sc.merge(leftRow, right, nil))
+		}
+	}
+	return result, nil
+}
+
+// merge 复制左侧的行并加入右表的列，右表行为 nil 时这些列都为 NULL
+func (sc *scope) merge(left map[string]interface{}, src *sourceTable, row map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(left)+2*len(src.columns))
+	for k, v := range left {
+		merged[k] = v
+	}
+	for _, col := range src.columns {
+		var value interface{}
+		if row != nil {
+			value = row[col.Name]
+		}
+		merged[src.name+"."+col.Name] = value
+		if sc.counts[col.Name] == 1 {
+			merged[col.Name] = value
+		}
+	}
+	return merged
+}
+
+// equiJoinKeys 在 ON 条件的 AND 分支中寻找 left = right 形式的等值比较，
+// 其中一侧只引用前 n 张表，另一侧只引用第 n 张表，返回左右两侧的表达式
+func (sc *scope) equiJoinKeys(on sql.Expr, n int) (sql.Expr, sql.Expr) {
+	for _, cond := range conjuncts(on) {
+		cmp, ok := cond.(*sql.BinaryExpr)
+		if !ok || cmp.Op != "=" {
+			continue
+		}
+		left, right := sc.tablesOf(cmp.Left), sc.tablesOf(cmp.Right)
+		switch {
+		case isLeftSide(left, n) && isRightSide(right, n):
+			return cmp.Left, cmp.Right
+		case isLeftSide(right, n) && isRightSide(left, n):
+			return cmp.Right, cmp.Left
+		}
+	}
+	return nil, nil
+}
+
+// tablesOf 返回表达式引用的表在 scope 中的下标
+func (sc *scope) tablesOf(expr sql.Expr) map[int]bool {
+	tables := make(map[int]bool)
+	sql.Walk(expr, func(e sql.Expr) bool {
+		ref, ok := e.(*sql.ColumnRef)
+		if !ok {
+			return true
+		}
+		for i, src := range sc.tables {
+			if ref.Table == src.name || (ref.Table == "" && src.hasColumn(ref.Name)) {
+				tables[i] = true
+			}
+		}
+		return true
+	})
+	return tables
+}
+
+func (src *sourceTable) hasColumn(name string) bool {
+	for _, col := range src.columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isLeftSide(tables map[int]bool, n int) bool {
+	for i := range tables {
+		if i >= n {
+			return false
+		}
+	}
+	return len(tables) > 0
+}
+
+func isRightSide(tables map[int]bool, n int) bool {
+	return len(tables) == 1 && tables[n]
+}
+
+// conjuncts 把 a AND b AND ... 拆成各个分支
+func conjuncts(expr sql.Expr) []sql.Expr {
+	if bin, ok := expr.(*sql.BinaryExpr); ok && bin.Op == "AND" {
+		return append(conjuncts(bin.Left), conjuncts(bin.Right)...)
+	}
+	return []sql.Expr{expr}
+}
+
+// joinKey 计算哈希连接的键，NULL 不与任何值相等，此时返回 false
+func joinKey(expr sql.Expr, row map[string]interface{}) (string, bool, error) {
+	value, err := sql.Eval(expr, row)
+	if err != nil || value == nil {
+		return "", false, err
+	}
+	key, err := json.Marshal(value)
+	if err != nil {
+		return "", false, err
+	}
+	return string(key), true, nil
+}
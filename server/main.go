@@ -2,33 +2,89 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 	"github.com/liubaotong/mem-db/server/db"
 	"github.com/liubaotong/mem-db/server/protocol"
 )
 
 const (
 	DEFAULT_DB_FILE = "database.json"
+	DEFAULT_WAL_DIR = "database.wal"
+)
+
+var (
+	walSync          = flag.String("wal-sync", "group", "when commits are flushed to the write-ahead log: always, group or interval")
+	walInterval      = flag.Duration("wal-interval", 100*time.Millisecond, "fsync interval for -wal-sync=interval")
+	walArchive       = flag.String("wal-archive", "", "directory that keeps log segments removed by checkpoints, for point-in-time recovery")
+	recoverTo        = flag.String("recover-to", "", "restore the database to lsn:N or a timestamp from the snapshots and the log, then save it; use only once")
+	backupDir        = flag.String("backup-dir", "backups", "directory for BACKUP TO and RESTORE FROM; file names are relative to it")
+	autoSavePolicy   = flag.String("autosave", "interval:5m", "when the database file is saved: sync, writes:N, interval:T or shutdown")
+	checkpointSize   = flag.Int64("checkpoint-size", 64<<20, "write-ahead log size in bytes that triggers a checkpoint, except with -autosave=shutdown")
+	snapshotFormat   = flag.String("snapshot-format", "json", "encoding of saved snapshots: json or binary")
+	snapshotCompress = flag.String("snapshot-compression", "none", "compression of saved snapshots: none or gzip")
 )
 
 func main() {
+	flag.Parse()
+	policy, err := db.ParseSyncPolicy(*walSync)
+	if err != nil {
+		log.Fatal(err)
+	}
+	format, err := db.ParseSnapshotFormat(*snapshotFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	compression, err := db.ParseCompression(*snapshotCompress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	savePolicy, err := parseSavePolicy(*autoSavePolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	database := db.NewDatabase()
+	// 加载时根据文件头识别格式，保存时使用配置的格式
+	database.SetSnapshotOptions(db.SnapshotOptions{Format: format, Compression: compression})
 	
-	// 设置优雅关闭
-	setupGracefulShutdown(database)
-	
-	// 尝试加载已存在的数据库文件
-	if _, err := os.Stat(DEFAULT_DB_FILE); err == nil {
-		log.Printf("Loading existing database from %s\n", DEFAULT_DB_FILE)
-		if err := database.LoadFromDisk(DEFAULT_DB_FILE); err != nil {
-			log.Printf("Error loading database: %v\n", err)
+	// 尝试加载已存在的数据库文件，数据文件损坏时加载上一个快照。
+	// 无法加载时不启动，避免之后的检查点覆盖数据文件。指定了 -recover-to 时改为恢复到指定的时间点
+	if *recoverTo != "" {
+		recoverDatabase(database, *recoverTo)
+	} else if err := database.LoadFromDisk(DEFAULT_DB_FILE); err == nil {
+		log.Printf("Loaded existing database from %s\n", DEFAULT_DB_FILE)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error loading database: %v", err)
+	}
+
+	// 重放快照之后的日志，之后的修改都先写入日志
+	logOptions := db.LogOptions{Sync: policy, Interval: *walInterval, Archive: *walArchive}
+	if err := database.OpenLog(DEFAULT_WAL_DIR, logOptions); err != nil {
+		log.Fatalf("Error recovering from write-ahead log: %v", err)
+	}
+	if *recoverTo != "" {
+		// 立即保存恢复的数据，之后的启动直接加载数据文件
+		if err := database.Checkpoint(DEFAULT_DB_FILE); err != nil {
+			log.Fatalf("Error saving recovered database: %v", err)
 		}
+		log.Printf("Recovered database saved to %s, restart without -recover-to", DEFAULT_DB_FILE)
 	}
+	saver = newAutoSaver(database, DEFAULT_DB_FILE, savePolicy)
+	go saver.run()
+
+	// 设置优雅关闭
+	setupGracefulShutdown(database)
 	
 	listener, err := net.Listen("tcp", ":8080")
 	if err != nil {
@@ -49,6 +105,45 @@ func main() {
 	}
 }
 
+// recoverDatabase 从数据文件、上一个快照和日志把数据库恢复到 target，失败时不启动
+func recoverDatabase(database *db.Database, target string) {
+	recoveryTarget, err := db.ParseRecoveryTarget(target)
+	if err != nil {
+		log.Fatal(err)
+	}
+	info, err := database.Recover(db.RecoveryOptions{
+		Target:    recoveryTarget,
+		Snapshots: []string{DEFAULT_DB_FILE},
+		LogDirs:   []string{DEFAULT_WAL_DIR, *walArchive},
+	})
+	if err != nil {
+		log.Fatalf("Error recovering to %s: %v", recoveryTarget, err)
+	}
+	base := info.Snapshot
+	if base == "" {
+		base = "an empty database"
+	}
+	log.Printf("Recovered to record %d from %s (lsn %d): replayed %d records, discarded %d later records",
+		info.LSN, base, info.SnapshotLSN, info.Replayed, info.Discarded)
+
+	// 原有的日志中有被放弃的记录，移到一边保留，之后的日志从新的目录开始，
+	// 再次恢复时不会把被放弃的记录当作恢复之后的修改重放
+	suffix := ".before-recovery-" + time.Now().UTC().Format("20060102T150405")
+	for _, dir := range []string{DEFAULT_WAL_DIR, *walArchive} {
+		if dir == "" {
+			continue
+		}
+		err := os.Rename(dir, dir+suffix)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Fatalf("Error moving %s aside: %v", dir, err)
+		}
+		log.Printf("Moved %s to %s", dir, dir+suffix)
+	}
+}
+
 func handleConnection(conn net.Conn, database *db.Database) {
 	defer conn.Close()
 	
@@ -57,6 +152,10 @@ func handleConnection(conn net.Conn, database *db.Database) {
 	
 	decoder := json.NewDecoder(conn)
 	encoder := json.NewEncoder(conn)
+
+	// 每个连接有自己的事务状态，断开时回滚未提交的事务
+	sess := newSession(database)
+	defer sess.close()
 	
 	for {
 		var cmd protocol.Command
@@ -67,7 +166,7 @@ func handleConnection(conn net.Conn, database *db.Database) {
 		
 		log.Printf("Received command type %d from %s", cmd.Type, remoteAddr)
 		
-		response := handleCommand(cmd, database)
+		response := handleCommand(cmd, sess)
 		
 		if err := encoder.Encode(response); err != nil {
 			log.Printf("Error sending response to %s: %v", remoteAddr, err)
@@ -76,7 +175,8 @@ func handleConnection(conn net.Conn, database *db.Database) {
 	}
 }
 
-func handleCommand(cmd protocol.Command, database *db.Database) protocol.Response {
+func handleCommand(cmd protocol.Command, sess *session) protocol.Response {
+	database := sess.current()
 	switch cmd.Type {
 	case protocol.CreateTable:
 		return handleCreateTable(cmd.Payload, database)
@@ -94,6 +194,44 @@ func handleCommand(cmd protocol.Command, database *db.Database) protocol.Respons
 		return handleLoadFromDisk(cmd.Payload, database)
 	case protocol.GetTableInfo:
 		return handleGetTableInfo(cmd.Payload, database)
+	case protocol.ExecSQL:
+		return handleExecSQL(cmd.Payload, sess)
+	case protocol.DropTable:
+		return handleDropTable(cmd.Payload, database)
+	case protocol.RenameTable:
+		return handleRenameTable(cmd.Payload, database)
+	case protocol.TruncateTable:
+		return handleTruncateTable(cmd.Payload, database)
+	case protocol.AlterTable:
+		return handleAlterTable(cmd.Payload, database)
+	case protocol.CreateSequence:
+		return handleCreateSequence(cmd.Payload, database)
+	case protocol.DropSequence:
+		return handleDropSequence(cmd.Payload, database)
+	case protocol.NextVal:
+		return handleNextVal(cmd.Payload, database)
+	case protocol.CreateIndex:
+		return handleCreateIndex(cmd.Payload, database)
+	case protocol.DropIndex:
+		return handleDropIndex(cmd.Payload, database)
+	case protocol.Begin:
+		return sess.begin()
+	case protocol.Commit:
+		return sess.commit()
+	case protocol.Rollback:
+		return sess.rollback()
+	case protocol.Savepoint:
+		return sess.savepoint(cmd.Payload)
+	case protocol.RollbackTo:
+		return sess.rollbackTo(cmd.Payload)
+	case protocol.ReleaseSavepoint:
+		return sess.releaseSavepoint(cmd.Payload)
+	case protocol.AutoSave:
+		return handleAutoSave(cmd.Payload)
+	case protocol.Backup:
+		return handleBackup(cmd.Payload, database)
+	case protocol.Restore:
+		return handleRestore(cmd.Payload, database)
 	default:
 		return protocol.Response{
 			Success: false,
@@ -110,26 +248,246 @@ func handleCreateTable(payload interface{}, database *db.Database) protocol.Resp
 
 	columns := make([]db.Column, len(createPayload.Columns))
 	for i, col := range createPayload.Columns {
-		var colType db.ColumnType
-		switch col.Type {
-		case "int":
-			colType = db.TypeInt
-		case "string":
-			colType = db.TypeString
-		default:
-			return protocol.Response{
-				Success: false, 
-				Error: "invalid column type: " + col.Type,
-			}
+		column, err := toColumn(col)
+		if err != nil {
+			return protocol.Response{Success: false, Error: err.Error()}
+		}
+		columns[i] = column
+	}
+
+	constraints := make([]db.Constraint, len(createPayload.Constraints))
+	for i, c := range createPayload.Constraints {
+		constraints[i] = db.Constraint{Primary: c.Primary, Columns: c.Columns}
+	}
+
+	err := database.CreateTable(createPayload.TableName, columns, constraints...)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+// toColumn 把协议中的列定义转换为 db.Column
+func toColumn(col protocol.ColumnData) (db.Column, error) {
+	colType, err := db.ParseColumnType(string(col.Type))
+	if err != nil {
+		return db.Column{}, err
+	}
+	return db.Column{
+		Name:          col.Name,
+		Type:          colType,
+		Nullable:      col.Nullable,
+		Default:       col.Default,
+		PrimaryKey:    col.PrimaryKey,
+		Unique:        col.Unique,
+		AutoIncrement: col.AutoIncrement,
+	}, nil
+}
+
+// errorResponse 构造失败的响应，可识别的错误带上对应的错误码
+func errorResponse(err error) protocol.Response {
+	response := protocol.Response{Success: false, Error: err.Error()}
+	var constraintErr *db.ConstraintError
+	if errors.As(err, &constraintErr) {
+		response.Code = protocol.ErrDuplicateKey
+	}
+	return response
+}
+
+func handleDropTable(payload interface{}, database *db.Database) protocol.Response {
+	dropPayload, ok := payload.(protocol.DropTablePayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	if err := database.DropTable(dropPayload.TableName, dropPayload.IfExists); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+func handleRenameTable(payload interface{}, database *db.Database) protocol.Response {
+	renamePayload, ok := payload.(protocol.RenameTablePayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	if err := database.RenameTable(renamePayload.TableName, renamePayload.NewName); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+func handleTruncateTable(payload interface{}, database *db.Database) protocol.Response {
+	truncatePayload, ok := payload.(protocol.TruncateTablePayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	table, err := database.GetTable(truncatePayload.TableName)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	count, err := table.Truncate()
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{
+		Success: true,
+		Data:    fmt.Sprintf("Deleted %d records", count),
+	}
+}
+
+func handleAlterTable(payload interface{}, database *db.Database) protocol.Response {
+	alterPayload, ok := payload.(protocol.AlterTablePayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	table, err := database.GetTable(alterPayload.TableName)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	colData := protocol.ColumnData{
+		Name:          alterPayload.Column,
+		Type:          protocol.ColumnType(alterPayload.Type),
+		Nullable:      alterPayload.Nullable,
+		Default:       alterPayload.Default,
+		PrimaryKey:    alterPayload.PrimaryKey,
+		Unique:        alterPayload.Unique,
+		AutoIncrement: alterPayload.AutoIncrement,
+	}
+	switch alterPayload.Action {
+	case protocol.AddColumn:
+		var col db.Column
+		if col, err = toColumn(colData); err == nil {
+			err = table.AddColumn(col)
+		}
+	case protocol.DropColumn:
+		err = table.DropColumn(alterPayload.Column)
+	case protocol.RenameColumn:
+		err = table.RenameColumn(alterPayload.Column, alterPayload.NewName)
+	case protocol.ModifyColumn:
+		var col db.Column
+		if col, err = toColumn(colData); err == nil {
+			err = table.ModifyColumn(col)
 		}
-		columns[i] = db.Column{Name: col.Name, Type: colType}
+	default:
+		err = fmt.Errorf("unknown alter action: %s", alterPayload.Action)
+	}
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+func handleCreateSequence(payload interface{}, database *db.Database) protocol.Response {
+	createPayload, ok := payload.(protocol.CreateSequencePayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	start, increment := 1, createPayload.Increment
+	if createPayload.Start != nil {
+		start = *createPayload.Start
+	}
+	if increment == 0 {
+		increment = 1
+	}
+	if err := database.CreateSequence(createPayload.Name, start, increment); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+func handleDropSequence(payload interface{}, database *db.Database) protocol.Response {
+	dropPayload, ok := payload.(protocol.DropSequencePayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	if err := database.DropSequence(dropPayload.Name, dropPayload.IfExists); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
 	}
 
-	err := database.CreateTable(createPayload.TableName, columns)
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+func handleNextVal(payload interface{}, database *db.Database) protocol.Response {
+	nextValPayload, ok := payload.(protocol.NextValPayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	value, err := database.NextVal(nextValPayload.Name)
 	if err != nil {
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
 
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true, Data: value}
+}
+
+func handleCreateIndex(payload interface{}, database *db.Database) protocol.Response {
+	createPayload, ok := payload.(protocol.CreateIndexPayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	indexType, err := db.ParseIndexType(createPayload.Type)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	table, err := database.GetTable(createPayload.TableName)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	if err := table.CreateIndex(createPayload.Name, createPayload.Columns, createPayload.Unique, indexType); err != nil {
+		return errorResponse(err)
+	}
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true}
+}
+
+func handleDropIndex(payload interface{}, database *db.Database) protocol.Response {
+	dropPayload, ok := payload.(protocol.DropIndexPayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	table, err := database.GetTable(dropPayload.TableName)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	if err := table.DropIndex(dropPayload.Name); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+
 	// 自动保存
 	autoSave(database)
 	return protocol.Response{Success: true}
@@ -154,6 +512,10 @@ func handleLoadFromDisk(payload interface{}, database *db.Database) protocol.Res
 		}
 	}
 
+	// 加载的数据不在日志中，立即执行检查点
+	if err := database.Checkpoint(DEFAULT_DB_FILE); err != nil {
+		log.Printf("Warning: checkpoint after load failed: %v", err)
+	}
 	return protocol.Response{Success: true}
 }
 
@@ -174,31 +536,70 @@ func handleGetTableInfo(payload interface{}, database *db.Database) protocol.Res
 	}
 }
 
-func handleSaveToDisk(database *db.Database) protocol.Response {
-	backupFile := DEFAULT_DB_FILE + ".bak"
-	
-	// 如果存在旧的数据库文件，先创建备份
-	if _, err := os.Stat(DEFAULT_DB_FILE); err == nil {
-		if err := os.Rename(DEFAULT_DB_FILE, backupFile); err != nil {
-			log.Printf("Warning: failed to create backup: %v", err)
-		}
+// handleBackup 把已提交的数据备份到指定的文件，备份期间照常处理其他连接的读写
+func handleBackup(payload interface{}, database *db.Database) protocol.Response {
+	backupPayload, ok := payload.(protocol.BackupPayload)
+	if !ok || backupPayload.File == "" {
+		return protocol.Response{Success: false, Error: "invalid payload"}
 	}
 
-	if err := database.SaveToDisk(DEFAULT_DB_FILE); err != nil {
-		// 如果保存失败，尝试恢复备份
-		if _, err := os.Stat(backupFile); err == nil {
-			if err := os.Rename(backupFile, DEFAULT_DB_FILE); err != nil {
-				log.Printf("Critical: failed to restore backup: %v", err)
-			}
-		}
+	filename, err := backupPath(backupPayload.File)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return protocol.Response{Success: false, Error: fmt.Sprintf("failed to back up database: %v", err)}
+	}
+	info, err := database.Backup(filename)
+	if err != nil {
+		return protocol.Response{Success: false, Error: fmt.Sprintf("failed to back up database: %v", err)}
+	}
+	log.Printf("Backed up %d tables to %s", len(info.Tables), info.File)
+	return protocol.Response{Success: true, Data: info}
+}
+
+// handleRestore 从备份恢复表，恢复写入日志后按自动保存的策略保存
+func handleRestore(payload interface{}, database *db.Database) protocol.Response {
+	restorePayload, ok := payload.(protocol.RestorePayload)
+	if !ok || restorePayload.File == "" {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+
+	filename, err := backupPath(restorePayload.File)
+	if err != nil {
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
+	info, err := database.Restore(filename, restorePayload.Tables)
+	if err != nil {
+		return protocol.Response{Success: false, Error: fmt.Sprintf("failed to restore database: %v", err)}
+	}
+	log.Printf("Restored %d tables from %s", len(info.Tables), info.File)
+
+	// 自动保存
+	autoSave(database)
+	return protocol.Response{Success: true, Data: info}
+}
 
-	// 保存成功后删除备份
-	if err := os.Remove(backupFile); err != nil {
-		log.Printf("Warning: failed to remove backup file: %v", err)
+// backupPath 把客户端给出的备份文件名解析为 -backup-dir 中的路径。
+// 文件名只能是备份目录中的相对路径，不能是绝对路径或含有 ..，客户端无法读写目录之外的文件
+func backupPath(name string) (string, error) {
+	invalid := fmt.Errorf("invalid backup file %q: expected a relative path inside the backup directory", name)
+	if !filepath.IsLocal(name) {
+		return "", invalid
+	}
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if part == ".." {
+			return "", invalid
+		}
 	}
+	return filepath.Join(*backupDir, name), nil
+}
 
+// handleSaveToDisk 执行检查点，快照先写入临时文件再替换数据文件，保存失败时原有的文件不受影响
+func handleSaveToDisk(database *db.Database) protocol.Response {
+	if err := database.Checkpoint(DEFAULT_DB_FILE); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
 	return protocol.Response{Success: true}
 }
 
@@ -213,16 +614,13 @@ func handleDelete(payload interface{}, database *db.Database) protocol.Response
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
 
-	condition := func(row map[string]interface{}) bool {
-		for k, v := range deletePayload.Conditions {
-			if row[k] != v {
-				return false
-			}
-		}
-		return true
+	conditions, err := db.NormalizeRow(deletePayload.Conditions)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
 	}
+	condition := matchConditions(conditions)
 
-	count, err := table.Delete(condition)
+	count, err := table.Delete(infallible(condition), conditionLookups(conditions)...)
 	if err != nil {
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
@@ -235,10 +633,17 @@ func handleDelete(payload interface{}, database *db.Database) protocol.Response
 	}
 }
 
+// autoSave 按日志的同步策略等待修改写入磁盘，再按自动保存的策略保存数据文件，见 autosave.go。
+// 事务中的修改在提交时才写入日志
 func autoSave(database *db.Database) {
-	if err := database.SaveToDisk(DEFAULT_DB_FILE); err != nil {
+	if database.InTransaction() {
+		return
+	}
+	if err := database.SyncLog(); err != nil {
 		log.Printf("Warning: auto-save failed: %v", err)
+		return
 	}
+	saver.afterWrite()
 }
 
 func handleInsert(payload interface{}, database *db.Database) protocol.Response {
@@ -252,14 +657,21 @@ func handleInsert(payload interface{}, database *db.Database) protocol.Response
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
 
-	err = table.Insert(insertPayload.Values)
+	values, err := db.NormalizeRow(insertPayload.Values)
 	if err != nil {
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
+	id, err := table.Insert(values)
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	// 自动保存
 	autoSave(database)
-	return protocol.Response{Success: true}
+	return protocol.Response{
+		Success: true,
+		Data:    protocol.InsertResult{Inserted: 1, LastInsertID: id},
+	}
 }
 
 func handleUpdate(payload interface{}, database *db.Database) protocol.Response {
@@ -273,19 +685,20 @@ func handleUpdate(payload interface{}, database *db.Database) protocol.Response
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
 
-	condition := func(row map[string]interface{}) bool {
-		for k, v := range updatePayload.Conditions {
-			if row[k] != v {
-				return false
-			}
-		}
-		return true
+	conditions, err := db.NormalizeRow(updatePayload.Conditions)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
 	}
+	condition := matchConditions(conditions)
 
-	err = table.Update(condition, updatePayload.Values)
+	values, err := db.NormalizeRow(updatePayload.Values)
 	if err != nil {
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
+	err = table.Update(infallible(condition), values, conditionLookups(conditions)...)
+	if err != nil {
+		return errorResponse(err)
+	}
 
 	// 自动保存
 	autoSave(database)
@@ -303,20 +716,47 @@ func handleSelect(payload interface{}, database *db.Database) protocol.Response
 		return protocol.Response{Success: false, Error: err.Error()}
 	}
 
-	condition := func(row map[string]interface{}) bool {
-		for k, v := range selectPayload.Conditions {
-			if row[k] != v {
+	conditions, err := db.NormalizeRow(selectPayload.Conditions)
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	condition := matchConditions(conditions)
+
+	result := table.Select(condition, conditionLookups(conditions)...)
+	return protocol.Response{
+		Success: true,
+		Data:    result,
+	}
+}
+
+// matchConditions 返回按列等值匹配的条件函数，conditions 中的值需要已经规范化。
+// 条件为 NULL 时匹配该列为 NULL 的行
+func matchConditions(conditions map[string]interface{}) func(map[string]interface{}) bool {
+	return func(row map[string]interface{}) bool {
+		for k, v := range conditions {
+			if db.Compare(row[k], v) != 0 {
 				return false
 			}
 		}
 		return true
 	}
+}
 
-	result := table.Select(condition)
-	return protocol.Response{
-		Success: true,
-		Data:    result,
+// infallible 把不会出错的条件函数转换为 Update、Delete 使用的形式
+func infallible(condition func(map[string]interface{}) bool) func(map[string]interface{}) (bool, error) {
+	return func(row map[string]interface{}) (bool, error) { return condition(row), nil }
+}
+
+// conditionLookups 把等值条件交给表，用于选择索引。
+// 索引中的等值查找不匹配 NULL，因此 NULL 条件只由条件函数检查
+func conditionLookups(conditions map[string]interface{}) []db.Lookup {
+	lookups := make([]db.Lookup, 0, len(conditions))
+	for k, v := range conditions {
+		if v != nil {
+			lookups = append(lookups, db.Lookup{Column: k, Op: "=", Value: v})
+		}
 	}
+	return lookups
 }
 
 func setupGracefulShutdown(database *db.Database) {
@@ -325,9 +765,12 @@ func setupGracefulShutdown(database *db.Database) {
 	go func() {
 		<-c
 		log.Println("Shutting down server...")
-		if err := database.SaveToDisk(DEFAULT_DB_FILE); err != nil {
+		if err := saver.save(); err != nil {
 			log.Printf("Error saving database: %v", err)
 		}
+		if err := database.CloseLog(); err != nil {
+			log.Printf("Error closing write-ahead log: %v", err)
+		}
 		os.Exit(0)
 	}()
 }
\ No newline at end of file
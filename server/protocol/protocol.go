@@ -16,6 +16,25 @@ const (
 	SaveToDisk
 	LoadFromDisk
 	GetTableInfo
+	ExecSQL
+	DropTable
+	RenameTable
+	TruncateTable
+	AlterTable
+	CreateSequence
+	DropSequence
+	NextVal
+	CreateIndex
+	DropIndex
+	Begin            // 开始事务，之后该连接上的修改在 Commit 前对其他连接不可见
+	Commit           // 提交事务
+	Rollback         // 回滚事务
+	Savepoint        // 建立保存点
+	RollbackTo       // 回滚到保存点
+	ReleaseSavepoint // 删除保存点
+	AutoSave         // 查看或修改自动保存的策略
+	Backup           // 在线备份到文件
+	Restore          // 从备份恢复表
 )
 
 // String 方法用于将命令类型转换为字符串
@@ -37,6 +56,44 @@ func (ct CommandType) String() string {
 		return "LOAD"
 	case GetTableInfo:
 		return "GET_TABLE_INFO"
+	case ExecSQL:
+		return "EXEC_SQL"
+	case DropTable:
+		return "DROP_TABLE"
+	case RenameTable:
+		return "RENAME_TABLE"
+	case TruncateTable:
+		return "TRUNCATE_TABLE"
+	case AlterTable:
+		return "ALTER_TABLE"
+	case CreateSequence:
+		return "CREATE_SEQUENCE"
+	case DropSequence:
+		return "DROP_SEQUENCE"
+	case NextVal:
+		return "NEXTVAL"
+	case CreateIndex:
+		return "CREATE_INDEX"
+	case DropIndex:
+		return "DROP_INDEX"
+	case Begin:
+		return "BEGIN"
+	case Commit:
+		return "COMMIT"
+	case Rollback:
+		return "ROLLBACK"
+	case Savepoint:
+		return "SAVEPOINT"
+	case RollbackTo:
+		return "ROLLBACK_TO"
+	case ReleaseSavepoint:
+		return "RELEASE_SAVEPOINT"
+	case AutoSave:
+		return "AUTOSAVE"
+	case Backup:
+		return "BACKUP"
+	case Restore:
+		return "RESTORE"
 	default:
 		return "UNKNOWN"
 	}
@@ -95,16 +152,106 @@ func (c *Command) UnmarshalJSON(data []byte) error {
 			return fmt.Errorf("invalid get table info payload: %v", err)
 		}
 		c.Payload = payload
+	case ExecSQL:
+		var payload ExecSQLPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid exec sql payload: %v", err)
+		}
+		c.Payload = payload
+	case DropTable:
+		var payload DropTablePayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid drop table payload: %v", err)
+		}
+		c.Payload = payload
+	case RenameTable:
+		var payload RenameTablePayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid rename table payload: %v", err)
+		}
+		c.Payload = payload
+	case TruncateTable:
+		var payload TruncateTablePayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid truncate table payload: %v", err)
+		}
+		c.Payload = payload
+	case AlterTable:
+		var payload AlterTablePayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid alter table payload: %v", err)
+		}
+		c.Payload = payload
+	case CreateSequence:
+		var payload CreateSequencePayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid create sequence payload: %v", err)
+		}
+		c.Payload = payload
+	case DropSequence:
+		var payload DropSequencePayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid drop sequence payload: %v", err)
+		}
+		c.Payload = payload
+	case NextVal:
+		var payload NextValPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid nextval payload: %v", err)
+		}
+		c.Payload = payload
+	case CreateIndex:
+		var payload CreateIndexPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid create index payload: %v", err)
+		}
+		c.Payload = payload
+	case DropIndex:
+		var payload DropIndexPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid drop index payload: %v", err)
+		}
+		c.Payload = payload
+	case Savepoint, RollbackTo, ReleaseSavepoint:
+		var payload SavepointPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid savepoint payload: %v", err)
+		}
+		c.Payload = payload
+	case AutoSave:
+		var payload AutoSavePayload
+		if len(raw.Payload) > 0 && string(raw.Payload) != "null" {
+			if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+				return fmt.Errorf("invalid autosave payload: %v", err)
+			}
+		}
+		c.Payload = payload
+	case Backup:
+		var payload BackupPayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid backup payload: %v", err)
+		}
+		c.Payload = payload
+	case Restore:
+		var payload RestorePayload
+		if err := json.Unmarshal(raw.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid restore payload: %v", err)
+		}
+		c.Payload = payload
 	}
 	return nil
 }
 
 type CreateTablePayload struct {
-	TableName string `json:"table_name"`
-	Columns   []struct {
-		Name string `json:"name"`
-		Type string `json:"type"` // "int" or "string"
-	} `json:"columns"`
+	TableName   string           `json:"table_name"`
+	Columns     []ColumnData     `json:"columns"`
+	Constraints []ConstraintData `json:"constraints,omitempty"`
+}
+
+// ConstraintData 是表级的唯一约束，Primary 为 true 时为主键
+type ConstraintData struct {
+	Primary bool     `json:"primary,omitempty"`
+	Columns []string `json:"columns"`
 }
 
 type InsertPayload struct {
@@ -112,6 +259,14 @@ type InsertPayload struct {
 	Values    map[string]interface{} `json:"values"`
 }
 
+// InsertResult 是 INSERT 的结果，LastInsertID 为最后一行自增列的值，
+// IDs 为每一行自增列的值，表没有自增列时都为空
+type InsertResult struct {
+	Inserted     int   `json:"inserted"`
+	LastInsertID int   `json:"last_insert_id,omitempty"`
+	IDs          []int `json:"ids,omitempty"`
+}
+
 type SelectPayload struct {
 	TableName  string                 `json:"table_name"`
 	Conditions map[string]interface{} `json:"conditions,omitempty"`
@@ -132,10 +287,123 @@ type GetTableInfoPayload struct {
 	TableName string `json:"table_name"`
 }
 
+// ExecSQLPayload 携带原始 SQL 文本，由服务器负责解析和执行
+type ExecSQLPayload struct {
+	SQL string `json:"sql"`
+}
+
+// DropTablePayload 对应 DROP TABLE，IfExists 为 true 时表不存在不报错
+type DropTablePayload struct {
+	TableName string `json:"table_name"`
+	IfExists  bool   `json:"if_exists,omitempty"`
+}
+
+type RenameTablePayload struct {
+	TableName string `json:"table_name"`
+	NewName   string `json:"new_name"`
+}
+
+type TruncateTablePayload struct {
+	TableName string `json:"table_name"`
+}
+
+// AlterAction 是 ALTER TABLE 对列的操作
+type AlterAction string
+
+const (
+	AddColumn    AlterAction = "add_column"
+	DropColumn   AlterAction = "drop_column"
+	RenameColumn AlterAction = "rename_column"
+	ModifyColumn AlterAction = "modify_column"
+)
+
+// AlterTablePayload 对应 ALTER TABLE 的列操作，
+// Type、Nullable、Default 及约束用于 ADD 和 MODIFY，NewName 用于 RENAME
+type AlterTablePayload struct {
+	TableName     string      `json:"table_name"`
+	Action        AlterAction `json:"action"`
+	Column        string      `json:"column"`
+	Type          string      `json:"type,omitempty"`
+	Nullable      bool        `json:"nullable,omitempty"`
+	Default       interface{} `json:"default,omitempty"`
+	PrimaryKey    bool        `json:"primary_key,omitempty"`
+	Unique        bool        `json:"unique,omitempty"`
+	AutoIncrement bool        `json:"auto_increment,omitempty"`
+	NewName       string      `json:"new_name,omitempty"`
+}
+
+// CreateSequencePayload 对应 CREATE SEQUENCE，省略 Start 时从 1 开始，
+// Increment 为 0 时按 1 处理
+type CreateSequencePayload struct {
+	Name      string `json:"name"`
+	Start     *int   `json:"start,omitempty"`
+	Increment int    `json:"increment,omitempty"`
+}
+
+type DropSequencePayload struct {
+	Name     string `json:"name"`
+	IfExists bool   `json:"if_exists,omitempty"`
+}
+
+// NextValPayload 推进序列，Response.Data 为新的值
+type NextValPayload struct {
+	Name string `json:"name"`
+}
+
+// CreateIndexPayload 对应 CREATE [UNIQUE] INDEX name ON table (columns) [USING type]，
+// Type 为 hash（默认）或 ordered
+type CreateIndexPayload struct {
+	TableName string   `json:"table_name"`
+	Name      string   `json:"name"`
+	Columns   []string `json:"columns"`
+	Unique    bool     `json:"unique,omitempty"`
+	Type      string   `json:"type,omitempty"`
+}
+
+type DropIndexPayload struct {
+	TableName string `json:"table_name"`
+	Name      string `json:"name"`
+}
+
+// SavepointPayload 是 Savepoint、RollbackTo 和 ReleaseSavepoint 的保存点名，
+// Begin、Commit、Rollback 没有参数
+type SavepointPayload struct {
+	Name string `json:"name"`
+}
+
+// AutoSavePayload 是新的自动保存策略：sync、writes:N、interval:T 或 shutdown，为空时不修改
+type AutoSavePayload struct {
+	Policy string `json:"policy,omitempty"`
+}
+
+// BackupPayload 是备份文件在服务器备份目录中的相对路径，文件不能已经存在
+type BackupPayload struct {
+	File string `json:"file"`
+}
+
+// RestorePayload 是备份文件在服务器备份目录中的相对路径和要恢复的表，Tables 为空时恢复所有的表和序列
+type RestorePayload struct {
+	File   string   `json:"file"`
+	Tables []string `json:"tables,omitempty"`
+}
+
+// AutoSaveStatus 是 AutoSave 的结果，Unsaved 为上次保存之后的修改次数
+type AutoSaveStatus struct {
+	Policy  string `json:"policy"`
+	Unsaved uint64 `json:"unsaved"`
+}
+
+// ResultSet 是 SQL 查询的结果，Rows 中每一行的值与 Columns 一一对应
+type ResultSet struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
 type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    ErrorCode   `json:"code,omitempty"` // 失败时的错误码，未分类的错误为 ErrNone
 }
 
 // 用于序列化和反序列化的数据库结构
@@ -154,19 +422,28 @@ type TableData struct {
 	Updated string                   `json:"updated"`  // 添加更新时间
 }
 
-// ColumnType 定义列的数据类型
+// ColumnType 定义列的数据类型。timestamp 的值为 RFC 3339 格式的字符串，
+// bytes 的值为 base64 编码的字符串，json 的值为任意 JSON 值（字符串按 JSON 文本解析）
 type ColumnType string
 
 const (
-	IntType    ColumnType = "int"
-	StringType ColumnType = "string"
+	IntType       ColumnType = "int"
+	StringType    ColumnType = "string"
+	FloatType     ColumnType = "float"
+	BoolType      ColumnType = "bool"
+	TimestampType ColumnType = "timestamp"
+	BytesType     ColumnType = "bytes"
+	JSONType      ColumnType = "json"
 )
 
 type ColumnData struct {
-	Name     string     `json:"name"`
-	Type     ColumnType `json:"type"`
-	Nullable bool       `json:"nullable,omitempty"`  // 添加可空标志
-	Default  interface{} `json:"default,omitempty"`  // 添加默认值
+	Name          string      `json:"name"`
+	Type          ColumnType  `json:"type"`
+	Nullable      bool        `json:"nullable,omitempty"` // 添加可空标志
+	Default       interface{} `json:"default,omitempty"`  // 添加默认值
+	PrimaryKey    bool        `json:"primary_key,omitempty"`
+	Unique        bool        `json:"unique,omitempty"`
+	AutoIncrement bool        `json:"auto_increment,omitempty"`
 }
 
 // 添加错误类型
@@ -181,6 +458,7 @@ const (
 	ErrDuplicateTable
 	ErrDuplicateColumn
 	ErrIOError
+	ErrDuplicateKey // 违反主键或唯一约束
 )
 
 // Error 结构体用于标准化错误响应
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/liubaotong/mem-db/server/protocol"
+	"github.com/liubaotong/mem-db/server/sql"
+)
+
+// selectPlan 描述 SELECT 在过滤之后的处理：分组聚合、排序、分页和投影
+type selectPlan struct {
+	columns    []string
+	exprs      []sql.Expr
+	grouped    bool
+	groupBy    []sql.Expr
+	having     sql.Expr
+	aggregates []*sql.FuncCall
+	orderBy    []sql.OrderItem
+	limit      *int
+	offset     *int
+}
+
+// newSelectPlan 展开 *，按 FROM 中各表的结构校验投影、分组和排序表达式
+func newSelectPlan(stmt *sql.SelectStmt, sc *scope) (*selectPlan, error) {
+	columnTypes := sc.columnTypes(len(sc.tables))
+
+	plan := &selectPlan{limit: stmt.Limit, offset: stmt.Offset}
+	aliases := make(map[string]sql.Expr)
+	for _, item := range stmt.Items {
+		if item.Star {
+			if err := plan.expandStar(item, sc); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := sql.TypeOf(item.Expr, columnTypes); err != nil {
+			return nil, err
+		}
+		plan.columns = append(plan.columns, item.Name())
+		plan.exprs = append(plan.exprs, item.Expr)
+		if item.Alias != "" {
+			aliases[item.Alias] = item.Expr
+		}
+	}
+
+	// ORDER BY 中可以使用 SELECT 列表里的别名，整数常量表示 SELECT 列表中的位置（从 1 开始）
+	for _, item := range stmt.OrderBy {
+		switch e := item.Expr.(type) {
+		case *sql.ColumnRef:
+			if expr, ok := aliases[e.Name]; ok && e.Table == "" {
+				item.Expr = expr
+			}
+		case *sql.Literal:
+			n, ok := e.Value.(int64)
+			if !ok {
+				return nil, fmt.Errorf("ORDER BY constant %s is not a select list position", e)
+			}
+			if n < 1 || n > int64(len(plan.exprs)) {
+				return nil, fmt.Errorf("ORDER BY position %d is not in select list", n)
+			}
+			item.Expr = plan.exprs[n-1]
+		}
+		if _, err := sql.TypeOf(item.Expr, columnTypes); err != nil {
+			return nil, err
+		}
+		plan.orderBy = append(plan.orderBy, item)
+	}
+
+	if err := plan.planGrouping(stmt, columnTypes); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// expandStar 把 * 展开为所有表的列，把 table.* 展开为该表的列，
+// 同名列以 "表.列" 作为结果中的列名
+func (plan *selectPlan) expandStar(item sql.SelectItem, sc *scope) error {
+	tables := sc.tables
+	if item.Table != "" {
+		src := sc.lookup(item.Table)
+		if src == nil {
+			return fmt.Errorf("table %s does not exist in FROM clause", item.Table)
+		}
+		tables = []*sourceTable{src}
+	}
+	for _, src := range tables {
+		for _, col := range src.columns {
+			name := col.Name
+			if sc.counts[col.Name] > 1 {
+				name = src.name + "." + col.Name
+			}
+			plan.columns = append(plan.columns, name)
+			plan.exprs = append(plan.exprs, &sql.ColumnRef{Table: src.name, Name: col.Name})
+		}
+	}
+	return nil
+}
+
+// planGrouping 校验 GROUP BY 和 HAVING，并收集需要计算的聚合函数。
+// 含有聚合函数、GROUP BY 或 HAVING 的查询按分组输出，
+// 此时其它表达式只能引用分组表达式
+func (plan *selectPlan) planGrouping(stmt *sql.SelectStmt, columnTypes map[string]string) error {
+	for _, expr := range stmt.GroupBy {
+		if sql.ContainsAggregate(expr) {
+			return fmt.Errorf("aggregate functions are not allowed in GROUP BY")
+		}
+		if _, err := sql.TypeOf(expr, columnTypes); err != nil {
+			return err
+		}
+	}
+	if err := sql.CheckHaving(stmt.Having, columnTypes); err != nil {
+		return err
+	}
+
+	outputs := append([]sql.Expr{}, plan.exprs...)
+	outputs = append(outputs, stmt.Having)
+	for _, item := range plan.orderBy {
+		outputs = append(outputs, item.Expr)
+	}
+
+	plan.groupBy = stmt.GroupBy
+	plan.having = stmt.Having
+	plan.aggregates = sql.Aggregates(outputs...)
+	plan.grouped = len(plan.groupBy) > 0 || plan.having != nil || len(plan.aggregates) > 0
+	if !plan.grouped {
+		return nil
+	}
+
+	groupKeys := make(map[string]bool)
+	for _, expr := range plan.groupBy {
+		groupKeys[expr.String()] = true
+	}
+	for _, expr := range outputs {
+		var err error
+		sql.Walk(expr, func(e sql.Expr) bool {
+			if err != nil || groupKeys[e.String()] {
+				return false
+			}
+			if call, ok := e.(*sql.FuncCall); ok && sql.IsAggregate(call) {
+				return false
+			}
+			if ref, ok := e.(*sql.ColumnRef); ok {
+				err = fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate function", ref.Name)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (plan *selectPlan) execute(rows []map[string]interface{}) (*protocol.ResultSet, error) {
+	if plan.grouped {
+		var err error
+		if rows, err = plan.group(rows); err != nil {
+			return nil, err
+		}
+	}
+	if len(plan.orderBy) > 0 {
+		if err := plan.sort(rows); err != nil {
+			return nil, err
+		}
+	}
+	rows = plan.page(rows)
+
+	result := &protocol.ResultSet{
+		Columns: plan.columns,
+		Rows:    make([][]interface{}, 0, len(rows)),
+	}
+	for _, row := range rows {
+		values := make([]interface{}, len(plan.exprs))
+		for i, expr := range plan.exprs {
+			value, err := sql.Eval(expr, row)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, nil
+}
+
+// group 把行按 GROUP BY 的值分组，每组输出一行，
+// 其中包含该组第一行的列值以及以表达式文本为键的聚合结果，最后按 HAVING 过滤。
+// 没有 GROUP BY 时所有行（包括零行）属于同一组
+func (plan *selectPlan) group(rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	type group struct {
+		first       map[string]interface{}
+		aggregators []*sql.Aggregator
+	}
+	newGroup := func(first map[string]interface{}) *group {
+		g := &group{first: first}
+		for _, call := range plan.aggregates {
+			g.aggregators = append(g.aggregators, sql.NewAggregator(call))
+		}
+		return g
+	}
+
+	groups := make([]*group, 0)
+	index := make(map[string]*group)
+	if len(plan.groupBy) == 0 {
+		groups = append(groups, newGroup(map[string]interface{}{}))
+	}
+	for _, row := range rows {
+		var g *group
+		if len(plan.groupBy) == 0 {
+			g = groups[0]
+		} else {
+			key, err := plan.groupKey(row)
+			if err != nil {
+				return nil, err
+			}
+			if g = index[key]; g == nil {
+				g = newGroup(row)
+				index[key] = g
+				groups = append(groups, g)
+			}
+		}
+		for _, agg := range g.aggregators {
+			if err := agg.Add(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(groups))
+	for _, g := range groups {
+		row := make(map[string]interface{}, len(g.first)+len(plan.aggregates))
+		for k, v := range g.first {
+			row[k] = v
+		}
+		for i, call := range plan.aggregates {
+			row[call.String()] = g.aggregators[i].Result()
+		}
+		ok, err := sql.Match(plan.having, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+// groupKey 计算行的分组键。行中的值都是 Normalize 之后的规范形式，相等的值编码为相同的键
+func (plan *selectPlan) groupKey(row map[string]interface{}) (string, error) {
+	values := make([]interface{}, len(plan.groupBy))
+	for i, expr := range plan.groupBy {
+		value, err := sql.Eval(expr, row)
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	key, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// sort 先计算每行的排序键再做稳定排序，相同键的行保持插入顺序
+func (plan *selectPlan) sort(rows []map[string]interface{}) error {
+	type keyedRow struct {
+		keys []interface{}
+		row  map[string]interface{}
+	}
+	keyed := make([]keyedRow, len(rows))
+	for i, row := range rows {
+		keys := make([]interface{}, len(plan.orderBy))
+		for j, item := range plan.orderBy {
+			key, err := sql.Eval(item.Expr, row)
+			if err != nil {
+				return err
+			}
+			keys[j] = key
+		}
+		keyed[i] = keyedRow{keys: keys, row: row}
+	}
+
+	sort.SliceStable(keyed, func(a, b int) bool {
+		for j, item := range plan.orderBy {
+			cmp := sql.Compare(keyed[a].keys[j], keyed[b].keys[j])
+			if cmp == 0 {
+				continue
+			}
+			if item.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	for i := range keyed {
+		rows[i] = keyed[i].row
+	}
+	return nil
+}
+
+// page 按 OFFSET 和 LIMIT 截取结果
+func (plan *selectPlan) page(rows []map[string]interface{}) []map[string]interface{} {
+	if plan.offset != nil {
+		if *plan.offset >= len(rows) {
+			return rows[:0]
+		}
+		rows = rows[*plan.offset:]
+	}
+	if plan.limit != nil && *plan.limit < len(rows) {
+		rows = rows[:*plan.limit]
+	}
+	return rows
+}
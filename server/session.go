@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/liubaotong/mem-db/server/db"
+	"github.com/liubaotong/mem-db/server/protocol"
+)
+
+// session 是一个连接的状态。tx 不为 nil 时连接处于事务中，命令都在事务视图上执行，
+// 修改在 COMMIT 时一起写入数据库，ROLLBACK 或连接断开时丢弃
+type session struct {
+	database *db.Database
+	tx       *db.Database
+}
+
+func newSession(database *db.Database) *session {
+	return &session{database: database}
+}
+
+// current 返回执行命令使用的数据库，事务中为事务视图
+func (s *session) current() *db.Database {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.database
+}
+
+func (s *session) begin() protocol.Response {
+	if s.tx != nil {
+		return protocol.Response{Success: false, Error: "transaction already in progress"}
+	}
+	tx, err := s.database.Begin()
+	if err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	s.tx = tx
+	return protocol.Response{Success: true, Data: "Transaction started"}
+}
+
+// commit 提交事务，提交失败时事务同样结束
+func (s *session) commit() protocol.Response {
+	if s.tx == nil {
+		return protocol.Response{Success: false, Error: "no transaction in progress"}
+	}
+	tx := s.tx
+	s.tx = nil
+	if err := tx.Commit(); err != nil {
+		return protocol.Response{Success: false, Error: fmt.Sprintf("transaction rolled back: %v", err)}
+	}
+
+	// 自动保存
+	autoSave(s.database)
+	return protocol.Response{Success: true, Data: "Transaction committed"}
+}
+
+func (s *session) rollback() protocol.Response {
+	if s.tx == nil {
+		return protocol.Response{Success: false, Error: "no transaction in progress"}
+	}
+	tx := s.tx
+	s.tx = nil
+	if err := tx.Rollback(); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	return protocol.Response{Success: true, Data: "Transaction rolled back"}
+}
+
+func (s *session) savepoint(payload interface{}) protocol.Response {
+	savepointPayload, ok := payload.(protocol.SavepointPayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+	if err := s.current().Savepoint(savepointPayload.Name); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	return protocol.Response{Success: true, Data: fmt.Sprintf("Savepoint %s created", savepointPayload.Name)}
+}
+
+func (s *session) rollbackTo(payload interface{}) protocol.Response {
+	savepointPayload, ok := payload.(protocol.SavepointPayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+	if err := s.current().RollbackTo(savepointPayload.Name); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	return protocol.Response{Success: true, Data: fmt.Sprintf("Rolled back to savepoint %s", savepointPayload.Name)}
+}
+
+func (s *session) releaseSavepoint(payload interface{}) protocol.Response {
+	savepointPayload, ok := payload.(protocol.SavepointPayload)
+	if !ok {
+		return protocol.Response{Success: false, Error: "invalid payload"}
+	}
+	if err := s.current().ReleaseSavepoint(savepointPayload.Name); err != nil {
+		return protocol.Response{Success: false, Error: err.Error()}
+	}
+	return protocol.Response{Success: true, Data: fmt.Sprintf("Savepoint %s released", savepointPayload.Name)}
+}
+
+// close 在连接断开时回滚未提交的事务
+func (s *session) close() {
+	if s.tx != nil {
+		s.tx.Rollback()
+		s.tx = nil
+	}
+}
@@ -0,0 +1,130 @@
+package sql
+
+import "fmt"
+
+// 支持的聚合函数
+var aggregateFuncs = map[string]bool{
+	"COUNT": true,
+	"SUM":   true,
+	"AVG":   true,
+	"MIN":   true,
+	"MAX":   true,
+}
+
+// IsAggregate 判断函数调用是否为聚合函数
+func IsAggregate(call *FuncCall) bool {
+	return aggregateFuncs[call.Name]
+}
+
+// ContainsAggregate 判断表达式中是否含有聚合函数
+func ContainsAggregate(expr Expr) bool {
+	return findAggregate(expr) != nil
+}
+
+// Aggregates 按出现顺序收集表达式中的聚合函数调用，文本相同的调用只保留一个
+func Aggregates(exprs ...Expr) []*FuncCall {
+	seen := make(map[string]bool)
+	calls := make([]*FuncCall, 0)
+	for _, expr := range exprs {
+		Walk(expr, func(e Expr) bool {
+			call, ok := e.(*FuncCall)
+			if !ok || !IsAggregate(call) {
+				return true
+			}
+			if key := call.String(); !seen[key] {
+				seen[key] = true
+				calls = append(calls, call)
+			}
+			return false
+		})
+	}
+	return calls
+}
+
+// Aggregator 在一组行上累积计算一个聚合函数。SUM、AVG 的输入都是整数时在 isum 中精确累加，
+// 出现浮点数后改用 sum，sum 始终按浮点数累加所有的输入
+type Aggregator struct {
+	call  *FuncCall
+	count int
+	sum   float64
+	isum  int64
+	best  interface{} // MIN / MAX 的当前值
+	exact bool        // SUM、AVG 的所有输入都是整数，且 isum 没有溢出
+}
+
+func NewAggregator(call *FuncCall) *Aggregator {
+	return &Aggregator{call: call, exact: true}
+}
+
+// Add 把一行数据计入聚合，NULL 值被忽略（COUNT(*) 除外）
+func (a *Aggregator) Add(row map[string]interface{}) error {
+	if a.call.Star {
+		a.count++
+		return nil
+	}
+	value, err := Eval(a.call.Args[0], row)
+	if err != nil || value == nil {
+		return err
+	}
+	a.count++
+
+	switch a.call.Name {
+	case "SUM", "AVG":
+		n, ok := toNumber(value)
+		if !ok {
+			return fmt.Errorf("%s requires a numeric argument, got %v", a.call.Name, value)
+		}
+		a.sum += n
+		if !a.exact {
+			return nil
+		}
+		i, ok := value.(int64)
+		if !ok {
+			a.exact = false
+			return nil
+		}
+		total := a.isum + i
+		if (i > 0 && total < a.isum) || (i < 0 && total > a.isum) {
+			// 整数的 SUM 溢出时报错，AVG 改用浮点数
+			if a.call.Name == "SUM" {
+				return fmt.Errorf("SUM: integer overflow")
+			}
+			a.exact = false
+			return nil
+		}
+		a.isum = total
+	case "MIN":
+		if a.best == nil || Compare(value, a.best) < 0 {
+			a.best = value
+		}
+	case "MAX":
+		if a.best == nil || Compare(value, a.best) > 0 {
+			a.best = value
+		}
+	}
+	return nil
+}
+
+// Result 返回聚合结果，除 COUNT 外没有非 NULL 输入时结果为 NULL
+func (a *Aggregator) Result() interface{} {
+	if a.call.Name == "COUNT" {
+		return int64(a.count)
+	}
+	if a.count == 0 {
+		return nil
+	}
+	switch a.call.Name {
+	case "SUM":
+		if a.exact {
+			return a.isum
+		}
+		return a.sum
+	case "AVG":
+		if a.exact {
+			return float64(a.isum) / float64(a.count)
+		}
+		return a.sum / float64(a.count)
+	default:
+		return a.best
+	}
+}
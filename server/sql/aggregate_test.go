@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// aggregate 在 values 组成的 x 列上计算 expr 表示的聚合函数
+func aggregate(t *testing.T, expr string, values ...interface{}) (interface{}, error) {
+	t.Helper()
+	stmt, err := Parse("SELECT " + expr + " FROM t")
+	if err != nil {
+		t.Fatalf("parse %q: %v", expr, err)
+	}
+	agg := NewAggregator(stmt.(*SelectStmt).Items[0].Expr.(*FuncCall))
+	for _, v := range values {
+		if err := agg.Add(map[string]interface{}{"x": v}); err != nil {
+			return nil, err
+		}
+	}
+	return agg.Result(), nil
+}
+
+func TestAggregator(t *testing.T) {
+	big := int64(1) << 53
+	tests := []struct {
+		expr   string
+		values []interface{}
+		want   interface{}
+	}{
+		{"COUNT(*)", []interface{}{int64(1), nil}, int64(2)},
+		{"COUNT(x)", []interface{}{int64(1), nil}, int64(1)},
+		{"SUM(x)", []interface{}{int64(1), int64(2), nil}, int64(3)},
+		// 超过 2^53 的整数按 float64 累加会丢失精度
+		{"SUM(x)", []interface{}{big, int64(1), int64(1)}, big + 2},
+		{"SUM(x)", []interface{}{int64(math.MaxInt64), int64(-1)}, int64(math.MaxInt64 - 1)},
+		{"SUM(x)", []interface{}{int64(1), 0.5}, 1.5},
+		{"SUM(x)", []interface{}{nil}, nil},
+		{"AVG(x)", []interface{}{int64(1), int64(2)}, 1.5},
+		{"AVG(x)", []interface{}{int64(math.MaxInt64), int64(math.MaxInt64)}, float64(math.MaxInt64)},
+		{"AVG(x)", []interface{}{1.0, int64(2), nil}, 1.5},
+		{"MIN(x)", []interface{}{int64(3), nil, 1.5}, 1.5},
+		{"MAX(x)", []interface{}{"a", "c", "b"}, "c"},
+		{"MAX(x)", nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := aggregate(t, tt.expr, tt.values...)
+		if err != nil {
+			t.Errorf("%s over %v: %v", tt.expr, tt.values, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s over %v = %#v, want %#v", tt.expr, tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestAggregatorErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		values []interface{}
+		want   string
+	}{
+		{"SUM(x)", []interface{}{int64(math.MaxInt64), int64(1)}, "integer overflow"},
+		{"SUM(x)", []interface{}{int64(math.MinInt64), int64(-1)}, "integer overflow"},
+		{"SUM(x)", []interface{}{"a"}, "numeric"},
+		{"AVG(x)", []interface{}{true}, "numeric"},
+	}
+	for _, tt := range tests {
+		_, err := aggregate(t, tt.expr, tt.values...)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s over %v error = %v, want %q", tt.expr, tt.values, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/liubaotong/mem-db/server/db"
+)
+
+// Statement 是所有 SQL 语句节点的公共接口
+type Statement interface {
+	statementNode()
+}
+
+// Expr 是所有表达式节点的公共接口，String 返回等价的 SQL 文本
+type Expr interface {
+	exprNode()
+	String() string
+}
+
+// CreateTableStmt 对应 CREATE TABLE name (coldef | constraint, ...)
+type CreateTableStmt struct {
+	Table       string
+	Columns     []ColumnDef
+	Constraints []TableConstraint
+}
+
+// TableConstraint 是表级约束 PRIMARY KEY (cols) 或 UNIQUE (cols)
+type TableConstraint struct {
+	PrimaryKey bool
+	Columns    []string
+}
+
+// ColumnDef 是 CREATE TABLE 或 ALTER TABLE 中的一个列定义
+type ColumnDef struct {
+	Name          string
+	Type          string // 小写的类型名，由服务器负责校验
+	NotNull       bool
+	Default       Expr // 没有 DEFAULT 时为 nil
+	PrimaryKey    bool
+	Unique        bool
+	AutoIncrement bool
+}
+
+// InsertStmt 对应 INSERT INTO name [(cols)] VALUES (...), (...)
+type InsertStmt struct {
+	Table   string
+	Columns []string // 为空表示按表定义的列顺序
+	Rows    [][]Expr
+}
+
+// SelectStmt 对应
+// SELECT items FROM table [JOIN ...] [WHERE expr] [GROUP BY ...] [HAVING expr]
+// [ORDER BY ...] [LIMIT n] [OFFSET m]
+type SelectStmt struct {
+	Items   []SelectItem
+	From    TableRef
+	Joins   []JoinClause
+	Where   Expr
+	GroupBy []Expr
+	Having  Expr
+	OrderBy []OrderItem
+	Limit   *int
+	Offset  *int
+}
+
+// SelectItem 是 SELECT 列表中的一项，Star 为 true 时表示 * 或 table.*
+type SelectItem struct {
+	Star  bool
+	Table string // table.* 中的表名或别名
+	Expr  Expr
+	Alias string
+}
+
+// Name 返回该项在结果集中的列名
+func (item SelectItem) Name() string {
+	if item.Alias != "" {
+		return item.Alias
+	}
+	if ref, ok := item.Expr.(*ColumnRef); ok {
+		return ref.Name
+	}
+	return item.Expr.String()
+}
+
+// TableRef 是 FROM 或 JOIN 中引用的表
+type TableRef struct {
+	Name  string
+	Alias string
+}
+
+// RefName 返回在查询中引用该表时使用的名字，有别名时为别名
+func (ref TableRef) RefName() string {
+	if ref.Alias != "" {
+		return ref.Alias
+	}
+	return ref.Name
+}
+
+// JoinType 是连接的类型
+type JoinType int
+
+const (
+	InnerJoin JoinType = iota
+	LeftJoin
+)
+
+// JoinClause 对应 [INNER] JOIN table ON expr 或 LEFT [OUTER] JOIN table ON expr
+type JoinClause struct {
+	Type  JoinType
+	Table TableRef
+	On    Expr
+}
+
+// OrderItem 是 ORDER BY 中的一项
+type OrderItem struct {
+	Expr Expr
+	Desc bool
+}
+
+// UpdateStmt 对应 UPDATE name SET col = expr, ... [WHERE expr]
+type UpdateStmt struct {
+	Table string
+	Set   []Assignment
+	Where Expr
+}
+
+// Assignment 是 UPDATE 中的一个赋值
+type Assignment struct {
+	Column string
+	Value  Expr
+}
+
+// DeleteStmt 对应 DELETE FROM name [WHERE expr]
+type DeleteStmt struct {
+	Table string
+	Where Expr
+}
+
+// DropTableStmt 对应 DROP TABLE [IF EXISTS] name
+type DropTableStmt struct {
+	Table    string
+	IfExists bool
+}
+
+// RenameTableStmt 对应 ALTER TABLE name RENAME TO new_name
+type RenameTableStmt struct {
+	Table   string
+	NewName string
+}
+
+// AlterAction 是 ALTER TABLE 对列的操作
+type AlterAction int
+
+const (
+	AddColumn AlterAction = iota
+	DropColumn
+	RenameColumn
+	ModifyColumn
+)
+
+// AlterTableStmt 对应 ALTER TABLE name 后跟
+// ADD [COLUMN] coldef、DROP [COLUMN] col、
+// RENAME COLUMN col TO new_col 或 MODIFY [COLUMN] coldef
+type AlterTableStmt struct {
+	Table   string
+	Action  AlterAction
+	Column  ColumnDef // DROP、RENAME 时只使用 Name
+	NewName string
+}
+
+// TruncateStmt 对应 TRUNCATE [TABLE] name
+type TruncateStmt struct {
+	Table string
+}
+
+// CreateSequenceStmt 对应 CREATE SEQUENCE name [START [WITH] n] [INCREMENT [BY] m]
+type CreateSequenceStmt struct {
+	Name      string
+	Start     int
+	Increment int
+}
+
+// DropSequenceStmt 对应 DROP SEQUENCE [IF EXISTS] name
+type DropSequenceStmt struct {
+	Name     string
+	IfExists bool
+}
+
+// CreateIndexStmt 对应 CREATE [UNIQUE] INDEX name ON table (cols) [USING type]
+type CreateIndexStmt struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+	Using   string // 小写的索引类型名，由服务器负责校验，省略时为空
+}
+
+// DropIndexStmt 对应 DROP INDEX name ON table
+type DropIndexStmt struct {
+	Name  string
+	Table string
+}
+
+func (*CreateTableStmt) statementNode() {}
+func (*InsertStmt) statementNode()      {}
+func (*SelectStmt) statementNode()      {}
+func (*UpdateStmt) statementNode()      {}
+func (*DeleteStmt) statementNode()      {}
+func (*DropTableStmt) statementNode()   {}
+func (*RenameTableStmt) statementNode() {}
+func (*AlterTableStmt) statementNode()  {}
+func (*TruncateStmt) statementNode()    {}
+
+// BeginStmt 对应 BEGIN [TRANSACTION] 和 START TRANSACTION
+type BeginStmt struct{}
+
+// CommitStmt 对应 COMMIT [TRANSACTION]
+type CommitStmt struct{}
+
+// RollbackStmt 对应 ROLLBACK [TRANSACTION]，带有 TO [SAVEPOINT] name 时只回滚到保存点
+type RollbackStmt struct {
+	Savepoint string
+}
+
+// SavepointStmt 对应 SAVEPOINT name
+type SavepointStmt struct {
+	Name string
+}
+
+// ReleaseSavepointStmt 对应 RELEASE [SAVEPOINT] name
+type ReleaseSavepointStmt struct {
+	Name string
+}
+
+func (*CreateSequenceStmt) statementNode()   {}
+func (*DropSequenceStmt) statementNode()     {}
+func (*CreateIndexStmt) statementNode()      {}
+func (*DropIndexStmt) statementNode()        {}
+func (*BeginStmt) statementNode()            {}
+func (*CommitStmt) statementNode()           {}
+func (*RollbackStmt) statementNode()         {}
+func (*SavepointStmt) statementNode()        {}
+func (*ReleaseSavepointStmt) statementNode() {}
+
+// SetAutoSaveStmt 对应 SET AUTOSAVE [= | TO] 'policy'
+type SetAutoSaveStmt struct {
+	Policy string
+}
+
+// ShowAutoSaveStmt 对应 SHOW AUTOSAVE
+type ShowAutoSaveStmt struct{}
+
+// BackupStmt 对应 BACKUP TO 'file'
+type BackupStmt struct {
+	File string
+}
+
+// RestoreStmt 对应 RESTORE FROM 'file' [TABLES name, ...]，没有 TABLES 时恢复所有的表和序列
+type RestoreStmt struct {
+	File   string
+	Tables []string
+}
+
+func (*SetAutoSaveStmt) statementNode()  {}
+func (*ShowAutoSaveStmt) statementNode() {}
+func (*BackupStmt) statementNode()       {}
+func (*RestoreStmt) statementNode()      {}
+
+// Literal 是常量值：int64、float64、string、bool、time.Time 或 nil（NULL）
+type Literal struct {
+	Value interface{}
+}
+
+// ColumnRef 是对列的引用，Table 为限定的表名或别名，可以为空
+type ColumnRef struct {
+	Table string
+	Name  string
+}
+
+// BinaryExpr 是二元运算，Op 为比较运算符（"=", "!=", "<", "<=", ">", ">="）
+// 或逻辑运算符（"AND", "OR"）
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// NotExpr 是逻辑取反 NOT expr
+type NotExpr struct {
+	Expr Expr
+}
+
+// InExpr 对应 expr [NOT] IN (v1, v2, ...)
+type InExpr struct {
+	Expr Expr
+	List []Expr
+	Not  bool
+}
+
+// BetweenExpr 对应 expr [NOT] BETWEEN low AND high，两端均包含
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// LikeExpr 对应 expr [NOT] LIKE pattern，% 匹配任意串，_ 匹配单个字符
+type LikeExpr struct {
+	Expr    Expr
+	Pattern Expr
+	Not     bool
+}
+
+// IsNullExpr 对应 expr IS [NOT] NULL
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+// FuncCall 是函数调用，Name 统一为大写，Star 为 true 时表示 COUNT(*)
+type FuncCall struct {
+	Name string
+	Args []Expr
+	Star bool
+}
+
+func (*Literal) exprNode()     {}
+func (*ColumnRef) exprNode()   {}
+func (*BinaryExpr) exprNode()  {}
+func (*NotExpr) exprNode()     {}
+func (*InExpr) exprNode()      {}
+func (*BetweenExpr) exprNode() {}
+func (*LikeExpr) exprNode()    {}
+func (*IsNullExpr) exprNode()  {}
+func (*FuncCall) exprNode()    {}
+
+// Walk 先序遍历表达式树，fn 返回 false 时不再进入当前节点的子节点
+func Walk(expr Expr, fn func(Expr) bool) {
+	if expr == nil || !fn(expr) {
+		return
+	}
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		Walk(e.Left, fn)
+		Walk(e.Right, fn)
+	case *NotExpr:
+		Walk(e.Expr, fn)
+	case *InExpr:
+		Walk(e.Expr, fn)
+		for _, item := range e.List {
+			Walk(item, fn)
+		}
+	case *BetweenExpr:
+		Walk(e.Expr, fn)
+		Walk(e.Low, fn)
+		Walk(e.High, fn)
+	case *LikeExpr:
+		Walk(e.Expr, fn)
+		Walk(e.Pattern, fn)
+	case *IsNullExpr:
+		Walk(e.Expr, fn)
+	case *FuncCall:
+		for _, arg := range e.Args {
+			Walk(arg, fn)
+		}
+	}
+}
+
+func (e *Literal) String() string {
+	switch v := e.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		return strings.ToUpper(db.FormatValue(v))
+	case time.Time:
+		return "TIMESTAMP '" + db.FormatValue(v) + "'"
+	default:
+		return db.FormatValue(v)
+	}
+}
+
+func (e *ColumnRef) String() string {
+	if e.Table != "" {
+		return e.Table + "." + e.Name
+	}
+	return e.Name
+}
+
+func (e *BinaryExpr) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.Left, e.Op, e.Right)
+}
+
+func (e *NotExpr) String() string {
+	return fmt.Sprintf("(NOT %s)", e.Expr)
+}
+
+func (e *InExpr) String() string {
+	items := make([]string, len(e.List))
+	for i, item := range e.List {
+		items[i] = item.String()
+	}
+	return fmt.Sprintf("(%s %sIN (%s))", e.Expr, notPrefix(e.Not), strings.Join(items, ", "))
+}
+
+func (e *BetweenExpr) String() string {
+	return fmt.Sprintf("(%s %sBETWEEN %s AND %s)", e.Expr, notPrefix(e.Not), e.Low, e.High)
+}
+
+func (e *LikeExpr) String() string {
+	return fmt.Sprintf("(%s %sLIKE %s)", e.Expr, notPrefix(e.Not), e.Pattern)
+}
+
+func (e *IsNullExpr) String() string {
+	return fmt.Sprintf("(%s IS %sNULL)", e.Expr, notPrefix(e.Not))
+}
+
+func (e *FuncCall) String() string {
+	if e.Star {
+		return e.Name + "(*)"
+	}
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(args, ", "))
+}
+
+func notPrefix(not bool) string {
+	if not {
+		return "NOT "
+	}
+	return ""
+}
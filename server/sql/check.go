@@ -0,0 +1,248 @@
+package sql
+
+import (
+	"fmt"
+	"time"
+)
+
+// 表达式的静态类型，与列类型的类型名一致
+const (
+	kindNull      = "null"
+	kindBool      = "bool"
+	kindInt       = "int"
+	kindFloat     = "float"
+	kindString    = "string"
+	kindTimestamp = "timestamp"
+	kindBytes     = "bytes"
+	kindJSON      = "json"
+)
+
+// Check 在执行前校验条件表达式：引用的列必须存在，比较两侧的类型必须兼容，
+// 且整个表达式必须是布尔条件。columnTypes 为列名到类型名（"int"、"string" 等）的映射，
+// 限定列以 "表.列" 为键。
+func Check(expr Expr, columnTypes map[string]string) error {
+	if call := findAggregate(expr); call != nil {
+		return fmt.Errorf("aggregate function %s is not allowed here", call.Name)
+	}
+	return checkCondition(expr, columnTypes)
+}
+
+// CheckHaving 校验 HAVING 条件，与 Check 不同的是允许使用聚合函数
+func CheckHaving(expr Expr, columnTypes map[string]string) error {
+	return checkCondition(expr, columnTypes)
+}
+
+func checkCondition(expr Expr, columnTypes map[string]string) error {
+	if expr == nil {
+		return nil
+	}
+	kind, err := inferKind(expr, columnTypes)
+	if err != nil {
+		return err
+	}
+	if kind != kindBool && kind != kindNull {
+		return fmt.Errorf("condition must be a boolean expression")
+	}
+	return nil
+}
+
+// TypeOf 返回表达式结果的类型名（"null"、"bool"、"int"、"float"、"string" 或其他列类型名），
+// 同时校验其中引用的列和比较运算
+func TypeOf(expr Expr, columnTypes map[string]string) (string, error) {
+	return inferKind(expr, columnTypes)
+}
+
+func inferKind(expr Expr, columnTypes map[string]string) (string, error) {
+	switch e := expr.(type) {
+	case *Literal:
+		return literalKind(e.Value), nil
+
+	case *ColumnRef:
+		kind, ok := columnTypes[e.String()]
+		if !ok {
+			return "", fmt.Errorf("column %s does not exist", e)
+		}
+		return kind, nil
+
+	case *BinaryExpr:
+		left, err := inferKind(e.Left, columnTypes)
+		if err != nil {
+			return "", err
+		}
+		right, err := inferKind(e.Right, columnTypes)
+		if err != nil {
+			return "", err
+		}
+		if e.Op == "AND" || e.Op == "OR" {
+			if !isBoolKind(left) || !isBoolKind(right) {
+				return "", fmt.Errorf("%s requires boolean operands", e.Op)
+			}
+			return kindBool, nil
+		}
+		if err := checkComparable(left, right); err != nil {
+			return "", err
+		}
+		return kindBool, nil
+
+	case *NotExpr:
+		kind, err := inferKind(e.Expr, columnTypes)
+		if err != nil {
+			return "", err
+		}
+		if !isBoolKind(kind) {
+			return "", fmt.Errorf("NOT requires a boolean operand")
+		}
+		return kindBool, nil
+
+	case *InExpr:
+		kind, err := inferKind(e.Expr, columnTypes)
+		if err != nil {
+			return "", err
+		}
+		for _, item := range e.List {
+			itemKind, err := inferKind(item, columnTypes)
+			if err != nil {
+				return "", err
+			}
+			if err := checkComparable(kind, itemKind); err != nil {
+				return "", err
+			}
+		}
+		return kindBool, nil
+
+	case *BetweenExpr:
+		kind, err := inferKind(e.Expr, columnTypes)
+		if err != nil {
+			return "", err
+		}
+		for _, bound := range []Expr{e.Low, e.High} {
+			boundKind, err := inferKind(bound, columnTypes)
+			if err != nil {
+				return "", err
+			}
+			if err := checkComparable(kind, boundKind); err != nil {
+				return "", err
+			}
+		}
+		return kindBool, nil
+
+	case *LikeExpr:
+		for _, operand := range []Expr{e.Expr, e.Pattern} {
+			kind, err := inferKind(operand, columnTypes)
+			if err != nil {
+				return "", err
+			}
+			if kind != kindString && kind != kindNull {
+				return "", fmt.Errorf("LIKE requires string operands")
+			}
+		}
+		return kindBool, nil
+
+	case *IsNullExpr:
+		if _, err := inferKind(e.Expr, columnTypes); err != nil {
+			return "", err
+		}
+		return kindBool, nil
+
+	case *FuncCall:
+		return inferCallKind(e, columnTypes)
+
+	default:
+		return "", fmt.Errorf("unsupported expression %T", expr)
+	}
+}
+
+func inferCallKind(call *FuncCall, columnTypes map[string]string) (string, error) {
+	if !IsAggregate(call) {
+		return "", fmt.Errorf("unknown function %s", call.Name)
+	}
+	if call.Star {
+		if call.Name != "COUNT" {
+			return "", fmt.Errorf("%s(*) is not supported", call.Name)
+		}
+		return kindInt, nil
+	}
+	if len(call.Args) != 1 {
+		return "", fmt.Errorf("%s expects exactly one argument", call.Name)
+	}
+	if inner := findAggregate(call.Args[0]); inner != nil {
+		return "", fmt.Errorf("aggregate function calls cannot be nested")
+	}
+	kind, err := inferKind(call.Args[0], columnTypes)
+	if err != nil {
+		return "", err
+	}
+
+	switch call.Name {
+	case "COUNT":
+		return kindInt, nil
+	case "SUM":
+		if !isNumericKind(kind) && kind != kindNull {
+			return "", fmt.Errorf("SUM requires a numeric argument")
+		}
+		return kind, nil
+	case "AVG":
+		if !isNumericKind(kind) && kind != kindNull {
+			return "", fmt.Errorf("AVG requires a numeric argument")
+		}
+		return kindFloat, nil
+	default: // MIN、MAX
+		return kind, nil
+	}
+}
+
+// findAggregate 返回表达式中的第一个聚合函数调用，没有时返回 nil
+func findAggregate(expr Expr) *FuncCall {
+	var found *FuncCall
+	Walk(expr, func(e Expr) bool {
+		if call, ok := e.(*FuncCall); ok && IsAggregate(call) && found == nil {
+			found = call
+		}
+		return found == nil
+	})
+	return found
+}
+
+func literalKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return kindNull
+	case bool:
+		return kindBool
+	case string:
+		return kindString
+	case float64:
+		return kindFloat
+	case time.Time:
+		return kindTimestamp
+	default:
+		return kindInt
+	}
+}
+
+func isBoolKind(kind string) bool {
+	return kind == kindBool || kind == kindNull
+}
+
+func isNumericKind(kind string) bool {
+	return kind == kindInt || kind == kindFloat
+}
+
+func checkComparable(a, b string) error {
+	if a == kindNull || b == kindNull || a == b {
+		return nil
+	}
+	if isNumericKind(a) && isNumericKind(b) {
+		return nil
+	}
+	// 字符串在比较时按对方的类型解析，如 ts > '2024-01-01'
+	if (a == kindString && isTextualKind(b)) || (b == kindString && isTextualKind(a)) {
+		return nil
+	}
+	return fmt.Errorf("cannot compare %s with %s", a, b)
+}
+
+// isTextualKind 判断类型的值是否可以用字符串表示：时间、base64 编码的二进制数据和 JSON 文本
+func isTextualKind(kind string) bool {
+	return kind == kindTimestamp || kind == kindBytes || kind == kindJSON
+}
@@ -0,0 +1,271 @@
+package sql
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/liubaotong/mem-db/server/db"
+)
+
+// Eval 在一行数据上计算表达式的值。
+// 比较和逻辑运算返回 bool，结果未知（涉及 NULL）时返回 nil，即 SQL 的三值逻辑。
+func Eval(expr Expr, row map[string]interface{}) (interface{}, error) {
+	switch e := expr.(type) {
+	case *Literal:
+		return e.Value, nil
+
+	case *ColumnRef:
+		// 连接产生的行以 "表.列" 为键，单表的行只有列名
+		if e.Table != "" {
+			if value, ok := row[e.String()]; ok {
+				return value, nil
+			}
+		}
+		value, ok := row[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("column %s does not exist", e.Name)
+		}
+		return value, nil
+
+	case *BinaryExpr:
+		if e.Op == "AND" || e.Op == "OR" {
+			return evalLogical(e, row)
+		}
+		left, err := Eval(e.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		right, err := Eval(e.Right, row)
+		if err != nil {
+			return nil, err
+		}
+		if left == nil || right == nil {
+			return nil, nil
+		}
+		cmp, err := compareValues(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return applyComparison(e.Op, cmp)
+
+	case *NotExpr:
+		value, err := evalBool(e.Expr, row)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return !*value, nil
+
+	case *InExpr:
+		value, err := Eval(e.Expr, row)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		// 与列表中的 NULL 比较结果未知，只有找不到匹配项时才会影响结果
+		sawNull := false
+		for _, item := range e.List {
+			candidate, err := Eval(item, row)
+			if err != nil {
+				return nil, err
+			}
+			if candidate == nil {
+				sawNull = true
+				continue
+			}
+			cmp, err := compareValues(value, candidate)
+			if err != nil {
+				return nil, err
+			}
+			if cmp == 0 {
+				return !e.Not, nil
+			}
+		}
+		if sawNull {
+			return nil, nil
+		}
+		return e.Not, nil
+
+	case *BetweenExpr:
+		value, err := Eval(e.Expr, row)
+		if err != nil {
+			return nil, err
+		}
+		low, err := Eval(e.Low, row)
+		if err != nil {
+			return nil, err
+		}
+		high, err := Eval(e.High, row)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil || low == nil || high == nil {
+			return nil, nil
+		}
+		lowCmp, err := compareValues(value, low)
+		if err != nil {
+			return nil, err
+		}
+		highCmp, err := compareValues(value, high)
+		if err != nil {
+			return nil, err
+		}
+		return (lowCmp >= 0 && highCmp <= 0) != e.Not, nil
+
+	case *LikeExpr:
+		value, err := Eval(e.Expr, row)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := Eval(e.Pattern, row)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil || pattern == nil {
+			return nil, nil
+		}
+		s, ok1 := value.(string)
+		p, ok2 := pattern.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("LIKE requires string operands")
+		}
+		return likeMatch(s, p) != e.Not, nil
+
+	case *IsNullExpr:
+		value, err := Eval(e.Expr, row)
+		if err != nil {
+			return nil, err
+		}
+		return (value == nil) != e.Not, nil
+
+	case *FuncCall:
+		// 聚合函数的结果由分组阶段以表达式文本为键写入分组行
+		value, ok := row[e.String()]
+		if !ok {
+			return nil, fmt.Errorf("function %s is not allowed here", e)
+		}
+		return value, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported expression %T", expr)
+	}
+}
+
+// Match 判断一行数据是否满足条件，只有结果为 true 时才算匹配，nil 条件匹配所有行
+func Match(expr Expr, row map[string]interface{}) (bool, error) {
+	if expr == nil {
+		return true, nil
+	}
+	value, err := evalBool(expr, row)
+	if err != nil {
+		return false, err
+	}
+	return value != nil && *value, nil
+}
+
+// evalLogical 按三值逻辑计算 AND / OR
+func evalLogical(e *BinaryExpr, row map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(e.Left, row)
+	if err != nil {
+		return nil, err
+	}
+	// 短路求值
+	if left != nil && *left == (e.Op == "OR") {
+		return *left, nil
+	}
+	right, err := evalBool(e.Right, row)
+	if err != nil {
+		return nil, err
+	}
+	if right != nil && *right == (e.Op == "OR") {
+		return *right, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	return e.Op == "AND", nil
+}
+
+func evalBool(expr Expr, row map[string]interface{}) (*bool, error) {
+	value, err := Eval(expr, row)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return nil, fmt.Errorf("expected boolean condition, got %v", value)
+	}
+	return &b, nil
+}
+
+func applyComparison(op string, cmp int) (bool, error) {
+	switch op {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	default:
+		return false, fmt.Errorf("unsupported operator %s", op)
+	}
+}
+
+// Compare 按排序语义比较两个值，NULL 小于任何非 NULL 值，
+// 无法比较的值按类型名排序，以保证排序结果稳定
+func Compare(a, b interface{}) int {
+	return db.Compare(a, b)
+}
+
+// compareValues 比较两个非 NULL 值，规则见 db.CompareValues，无法比较时返回错误
+func compareValues(a, b interface{}) (int, error) {
+	cmp, ok := db.CompareValues(a, b)
+	if !ok {
+		return 0, fmt.Errorf("cannot compare %v with %v", a, b)
+	}
+	return cmp, nil
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, !math.IsNaN(n)
+	default:
+		return 0, false
+	}
+}
+
+// likeMatch 实现 LIKE 模式匹配，% 匹配任意长度字符串，_ 匹配单个字符
+func likeMatch(s, pattern string) bool {
+	str, pat := []rune(s), []rune(pattern)
+	si, pi := 0, 0
+	// 记录最近一个 % 的位置，用于回溯
+	starPi, starSi := -1, 0
+
+	for si < len(str) {
+		switch {
+		case pi < len(pat) && pat[pi] == '%':
+			starPi, starSi = pi, si
+			pi++
+		case pi < len(pat) && (pat[pi] == '_' || pat[pi] == str[si]):
+			si++
+			pi++
+		case starPi >= 0:
+			starSi++
+			si = starSi
+			pi = starPi + 1
+		default:
+			return false
+		}
+	}
+	for pi < len(pat) && pat[pi] == '%' {
+		pi++
+	}
+	return pi == len(pat)
+}
@@ -0,0 +1,83 @@
+package sql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	row := map[string]interface{}{
+		"id":    int64(5),
+		"price": 2.5,
+		"name":  "apple",
+		"note":  nil,
+		"t.id":  int64(7),
+	}
+	tests := []struct {
+		where string
+		want  bool
+	}{
+		{"id = 5", true},
+		{"id <> 5", false},
+		{"price > 2 AND price < 3", true},
+		{"id BETWEEN 1 AND 5", true},
+		{"id NOT BETWEEN 1 AND 5", false},
+		{"id IN (1, 5)", true},
+		{"id NOT IN (1, 2)", true},
+		{"name LIKE 'a%e'", true},
+		{"name LIKE 'a_p%'", true},
+		{"name NOT LIKE '%x%'", true},
+		{"(id = 1 OR id = 5) AND name = 'apple'", true},
+		{"t.id = 7", true},
+		// 单表的行只有列名，限定的列引用按列名查找
+		{"u.id = 5", true},
+		// 与 NULL 比较的结果未知，不匹配；OR 的另一侧为真时仍然匹配
+		{"note = 1", false},
+		{"NOT note = 1", false},
+		{"note = 1 OR id = 5", true},
+		{"note = 1 AND id = 5", false},
+		{"id IN (1, NULL)", false},
+		{"id NOT IN (1, NULL)", false},
+		{"note IS NULL", true},
+		{"name IS NOT NULL", true},
+	}
+	for _, tt := range tests {
+		stmt, err := Parse("SELECT * FROM t WHERE " + tt.where)
+		if err != nil {
+			t.Errorf("parse %q: %v", tt.where, err)
+			continue
+		}
+		got, err := Match(stmt.(*SelectStmt).Where, row)
+		if err != nil {
+			t.Errorf("Match(%s): %v", tt.where, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Match(%s) = %v, want %v", tt.where, got, tt.want)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	row := map[string]interface{}{"id": int64(5), "name": "apple"}
+	tests := []struct {
+		where string
+		want  string
+	}{
+		{"missing = 1", "does not exist"},
+		{"id = 'abc'", "cannot compare"},
+		{"id LIKE 'a%'", "LIKE"},
+		// AND 左侧为真时右侧的错误会返回
+		{"id = 5 AND name > 1", "cannot compare"},
+	}
+	for _, tt := range tests {
+		stmt, err := Parse("SELECT * FROM t WHERE " + tt.where)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.where, err)
+		}
+		_, err = Match(stmt.(*SelectStmt).Where, row)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Match(%s) error = %v, want %q", tt.where, err, tt.want)
+		}
+	}
+}
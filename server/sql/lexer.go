@@ -0,0 +1,335 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TokenType 表示词法单元的类型
+type TokenType int
+
+const (
+	TokenEOF TokenType = iota
+	TokenIdent
+	TokenKeyword
+	TokenInt
+	TokenFloat
+	TokenString
+	TokenSymbol
+)
+
+// String 方法用于将词法单元类型转换为字符串
+func (tt TokenType) String() string {
+	switch tt {
+	case TokenEOF:
+		return "EOF"
+	case TokenIdent:
+		return "IDENT"
+	case TokenKeyword:
+		return "KEYWORD"
+	case TokenInt:
+		return "INT"
+	case TokenFloat:
+		return "FLOAT"
+	case TokenString:
+		return "STRING"
+	case TokenSymbol:
+		return "SYMBOL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Token 是词法分析器输出的一个词法单元
+type Token struct {
+	Type  TokenType
+	Value string // 关键字统一为大写，字符串为去掉引号和转义后的内容
+	Pos   int    // 在输入中的起始位置（按字符计）
+}
+
+func (t Token) String() string {
+	switch t.Type {
+	case TokenEOF:
+		return "end of input"
+	case TokenString:
+		return fmt.Sprintf("'%s'", t.Value)
+	default:
+		return t.Value
+	}
+}
+
+// 保留关键字，匹配时不区分大小写
+var keywords = map[string]bool{
+	"SELECT":  true,
+	"FROM":    true,
+	"WHERE":   true,
+	"INSERT":  true,
+	"INTO":    true,
+	"VALUES":  true,
+	"UPDATE":  true,
+	"SET":     true,
+	"DELETE":  true,
+	"CREATE":  true,
+	"TABLE":   true,
+	"AND":     true,
+	"OR":      true,
+	"NOT":     true,
+	"IN":      true,
+	"BETWEEN": true,
+	"LIKE":    true,
+	"IS":      true,
+	"NULL":    true,
+	"AS":      true,
+	"ORDER":   true,
+	"BY":      true,
+	"ASC":     true,
+	"DESC":    true,
+	"LIMIT":   true,
+	"OFFSET":  true,
+	"GROUP":   true,
+	"HAVING":  true,
+	"JOIN":    true,
+	"INNER":   true,
+	"LEFT":    true,
+	"OUTER":   true,
+	"ON":      true,
+
+	// 表结构管理
+	"DROP":     true,
+	"IF":       true,
+	"EXISTS":   true,
+	"ALTER":    true,
+	"RENAME":   true,
+	"TO":       true,
+	"TRUNCATE": true,
+	"ADD":      true,
+	"COLUMN":   true,
+	"MODIFY":   true,
+	"DEFAULT":  true,
+	"PRIMARY":  true,
+	"KEY":      true,
+	"UNIQUE":   true,
+
+	// 自增列和序列
+	"AUTO_INCREMENT": true,
+	"SEQUENCE":       true,
+	"START":          true,
+	"WITH":           true,
+	"INCREMENT":      true,
+
+	// 索引
+	"INDEX": true,
+	"USING": true,
+
+	// 布尔常量
+	"TRUE":  true,
+	"FALSE": true,
+
+	// 事务
+	"BEGIN":       true,
+	"TRANSACTION": true,
+	"COMMIT":      true,
+	"ROLLBACK":    true,
+	"SAVEPOINT":   true,
+	"RELEASE":     true,
+
+	// 持久化
+	"SHOW":     true,
+	"AUTOSAVE": true,
+	"BACKUP":   true,
+	"RESTORE":  true,
+	"TABLES":   true,
+}
+
+// 多字符运算符，需要优先于单字符匹配
+var multiCharSymbols = []string{"<=", ">=", "!=", "<>"}
+
+const singleCharSymbols = "(),;*.=<>+-/"
+
+// Lexer 将 SQL 文本切分为词法单元
+type Lexer struct {
+	input []rune
+	pos   int
+}
+
+func NewLexer(input string) *Lexer {
+	return &Lexer{input: []rune(input)}
+}
+
+// Tokenize 一次性切分全部输入，结果以 TokenEOF 结尾
+func Tokenize(input string) ([]Token, error) {
+	lexer := NewLexer(input)
+	tokens := make([]Token, 0)
+	for {
+		tok, err := lexer.Next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Type == TokenEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// Next 返回下一个词法单元
+func (l *Lexer) Next() (Token, error) {
+	l.skipWhitespaceAndComments()
+	if l.pos >= len(l.input) {
+		return Token{Type: TokenEOF, Pos: l.pos}, nil
+	}
+
+	start := l.pos
+	ch := l.input[l.pos]
+
+	switch {
+	case ch == '\'' || ch == '"':
+		return l.readString(ch)
+	case ch == '`':
+		return l.readQuotedIdent()
+	case isDigit(ch):
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+		}
+		tokenType := TokenInt
+		// 小数：数字之后是小数点和至少一位数字
+		if l.pos+1 < len(l.input) && l.input[l.pos] == '.' && isDigit(l.input[l.pos+1]) {
+			l.pos++
+			for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+				l.pos++
+			}
+			tokenType = TokenFloat
+		}
+		if l.pos < len(l.input) && isIdentStart(l.input[l.pos]) {
+			return Token{}, fmt.Errorf("invalid number at position %d", start)
+		}
+		return Token{Type: tokenType, Value: string(l.input[start:l.pos]), Pos: start}, nil
+	case isIdentStart(ch):
+		for l.pos < len(l.input) && isIdentPart(l.input[l.pos]) {
+			l.pos++
+		}
+		word := string(l.input[start:l.pos])
+		if upper := strings.ToUpper(word); keywords[upper] {
+			return Token{Type: TokenKeyword, Value: upper, Pos: start}, nil
+		}
+		return Token{Type: TokenIdent, Value: word, Pos: start}, nil
+	}
+
+	for _, sym := range multiCharSymbols {
+		if l.hasPrefix(sym) {
+			l.pos += len(sym)
+			return Token{Type: TokenSymbol, Value: sym, Pos: start}, nil
+		}
+	}
+	if strings.ContainsRune(singleCharSymbols, ch) {
+		l.pos++
+		return Token{Type: TokenSymbol, Value: string(ch), Pos: start}, nil
+	}
+
+	return Token{}, fmt.Errorf("unexpected character %q at position %d", ch, start)
+}
+
+// readString 读取单引号或双引号字符串，支持反斜杠转义和重复引号转义
+func (l *Lexer) readString(quote rune) (Token, error) {
+	start := l.pos
+	l.pos++ // 跳过起始引号
+
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		ch := l.input[l.pos]
+		switch {
+		case ch == quote:
+			// 两个连续的引号表示引号本身
+			if l.pos+1 < len(l.input) && l.input[l.pos+1] == quote {
+				sb.WriteRune(quote)
+				l.pos += 2
+				continue
+			}
+			l.pos++
+			return Token{Type: TokenString, Value: sb.String(), Pos: start}, nil
+		case ch == '\\' && l.pos+1 < len(l.input):
+			sb.WriteRune(unescape(l.input[l.pos+1]))
+			l.pos += 2
+		default:
+			sb.WriteRune(ch)
+			l.pos++
+		}
+	}
+	return Token{}, fmt.Errorf("unterminated string starting at position %d", start)
+}
+
+// readQuotedIdent 读取反引号包围的标识符
+func (l *Lexer) readQuotedIdent() (Token, error) {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.input) {
+		if l.input[l.pos] == '`' {
+			name := string(l.input[start+1 : l.pos])
+			l.pos++
+			if name == "" {
+				return Token{}, fmt.Errorf("empty identifier at position %d", start)
+			}
+			return Token{Type: TokenIdent, Value: name, Pos: start}, nil
+		}
+		l.pos++
+	}
+	return Token{}, fmt.Errorf("unterminated identifier starting at position %d", start)
+}
+
+// skipWhitespaceAndComments 跳过空白以及 "--" 开头的行注释
+func (l *Lexer) skipWhitespaceAndComments() {
+	for l.pos < len(l.input) {
+		if unicode.IsSpace(l.input[l.pos]) {
+			l.pos++
+			continue
+		}
+		if l.hasPrefix("--") {
+			for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *Lexer) hasPrefix(s string) bool {
+	rs := []rune(s)
+	if l.pos+len(rs) > len(l.input) {
+		return false
+	}
+	for i, r := range rs {
+		if l.input[l.pos+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func unescape(ch rune) rune {
+	switch ch {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	default:
+		return ch
+	}
+}
+
+func isDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentStart(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
+}
+
+func isIdentPart(ch rune) bool {
+	return isIdentStart(ch) || unicode.IsDigit(ch)
+}
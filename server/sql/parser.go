@@ -0,0 +1,1184 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/liubaotong/mem-db/server/db"
+)
+
+// Parser 是一个递归下降的 SQL 语法分析器
+type Parser struct {
+	tokens []Token
+	pos    int
+}
+
+// Parse 解析单条 SQL 语句，末尾的分号可选
+func Parse(input string) (Statement, error) {
+	stmts, err := ParseScript(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(stmts) != 1 {
+		return nil, fmt.Errorf("expected exactly one statement, got %d", len(stmts))
+	}
+	return stmts[0], nil
+}
+
+// ParseScript 解析以分号分隔的多条 SQL 语句
+func ParseScript(input string) ([]Statement, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Parser{tokens: tokens}
+	stmts := make([]Statement, 0)
+	for {
+		// 跳过空语句
+		for p.acceptSymbol(";") {
+		}
+		if p.peek().Type == TokenEOF {
+			break
+		}
+
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+
+		if p.peek().Type != TokenEOF {
+			if err := p.expectSymbol(";"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("empty statement")
+	}
+	return stmts, nil
+}
+
+func (p *Parser) parseStatement() (Statement, error) {
+	tok := p.peek()
+	if tok.Type != TokenKeyword {
+		return nil, p.errorf("expected statement, got %s", tok)
+	}
+
+	switch tok.Value {
+	case "CREATE":
+		switch next := p.peekAt(1); {
+		case next.Type == TokenKeyword && next.Value == "SEQUENCE":
+			return p.parseCreateSequence()
+		case next.Type == TokenKeyword && (next.Value == "INDEX" || next.Value == "UNIQUE"):
+			return p.parseCreateIndex()
+		}
+		return p.parseCreateTable()
+	case "INSERT":
+		return p.parseInsert()
+	case "SELECT":
+		return p.parseSelect()
+	case "UPDATE":
+		return p.parseUpdate()
+	case "DELETE":
+		return p.parseDelete()
+	case "DROP":
+		switch next := p.peekAt(1); {
+		case next.Type == TokenKeyword && next.Value == "SEQUENCE":
+			return p.parseDropSequence()
+		case next.Type == TokenKeyword && next.Value == "INDEX":
+			return p.parseDropIndex()
+		}
+		return p.parseDropTable()
+	case "ALTER":
+		return p.parseAlterTable()
+	case "TRUNCATE":
+		return p.parseTruncate()
+	case "BEGIN", "START":
+		return p.parseBegin()
+	case "COMMIT":
+		p.next()
+		p.acceptKeyword("TRANSACTION")
+		return &CommitStmt{}, nil
+	case "ROLLBACK":
+		return p.parseRollback()
+	case "SAVEPOINT":
+		p.next()
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &SavepointStmt{Name: name}, nil
+	case "RELEASE":
+		p.next()
+		p.acceptKeyword("SAVEPOINT")
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &ReleaseSavepointStmt{Name: name}, nil
+	case "SET":
+		return p.parseSetAutoSave()
+	case "SHOW":
+		if err := p.expectKeywords("SHOW", "AUTOSAVE"); err != nil {
+			return nil, err
+		}
+		return &ShowAutoSaveStmt{}, nil
+	case "BACKUP":
+		if err := p.expectKeywords("BACKUP", "TO"); err != nil {
+			return nil, err
+		}
+		file, err := p.expectString("backup file")
+		if err != nil {
+			return nil, err
+		}
+		return &BackupStmt{File: file}, nil
+	case "RESTORE":
+		return p.parseRestore()
+	default:
+		return nil, p.errorf("unsupported statement %s", tok.Value)
+	}
+}
+
+// CREATE TABLE name (coldef, ...)
+func (p *Parser) parseCreateTable() (Statement, error) {
+	if err := p.expectKeywords("CREATE", "TABLE"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+
+	stmt := &CreateTableStmt{Table: name}
+	for {
+		switch tok := p.peek(); {
+		case tok.Type == TokenKeyword && (tok.Value == "PRIMARY" || tok.Value == "UNIQUE"):
+			constraint, err := p.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Constraints = append(stmt.Constraints, constraint)
+		default:
+			col, err := p.parseColumnDef()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Columns = append(stmt.Columns, col)
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseTableConstraint 解析 PRIMARY KEY (col, ...) 或 UNIQUE (col, ...)
+func (p *Parser) parseTableConstraint() (TableConstraint, error) {
+	var constraint TableConstraint
+	if p.acceptKeyword("PRIMARY") {
+		if err := p.expectKeywords("KEY"); err != nil {
+			return TableConstraint{}, err
+		}
+		constraint.PrimaryKey = true
+	} else if err := p.expectKeywords("UNIQUE"); err != nil {
+		return TableConstraint{}, err
+	}
+
+	if err := p.expectSymbol("("); err != nil {
+		return TableConstraint{}, err
+	}
+	columns, err := p.parseIdentList()
+	if err != nil {
+		return TableConstraint{}, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return TableConstraint{}, err
+	}
+	constraint.Columns = columns
+	return constraint, nil
+}
+
+// parseColumnDef 解析列定义
+// name type { NOT NULL | NULL | DEFAULT value | PRIMARY KEY | UNIQUE | AUTO_INCREMENT }
+func (p *Parser) parseColumnDef() (ColumnDef, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return ColumnDef{}, err
+	}
+	colType, err := p.expectIdent()
+	if err != nil {
+		return ColumnDef{}, err
+	}
+
+	col := ColumnDef{Name: name, Type: strings.ToLower(colType)}
+	for {
+		switch {
+		case p.acceptKeyword("NOT"):
+			if err := p.expectKeywords("NULL"); err != nil {
+				return ColumnDef{}, err
+			}
+			col.NotNull = true
+		case p.acceptKeyword("NULL"):
+			col.NotNull = false
+		case p.acceptKeyword("DEFAULT"):
+			if col.Default, err = p.parseLiteral(); err != nil {
+				return ColumnDef{}, err
+			}
+		case p.acceptKeyword("PRIMARY"):
+			if err := p.expectKeywords("KEY"); err != nil {
+				return ColumnDef{}, err
+			}
+			col.PrimaryKey = true
+		case p.acceptKeyword("UNIQUE"):
+			col.Unique = true
+		case p.acceptKeyword("AUTO_INCREMENT"):
+			col.AutoIncrement = true
+		default:
+			return col, nil
+		}
+	}
+}
+
+// INSERT INTO name [(col, ...)] VALUES (value, ...), ...
+func (p *Parser) parseInsert() (Statement, error) {
+	if err := p.expectKeywords("INSERT", "INTO"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &InsertStmt{Table: name}
+	if p.acceptSymbol("(") {
+		stmt.Columns, err = p.parseIdentList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectKeywords("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		row := make([]Expr, 0)
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		if len(stmt.Columns) > 0 && len(row) != len(stmt.Columns) {
+			return nil, p.errorf("expected %d values, got %d", len(stmt.Columns), len(row))
+		}
+		stmt.Rows = append(stmt.Rows, row)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return stmt, nil
+}
+
+// SELECT item, ... FROM table [join ...] [WHERE expr]
+// [GROUP BY expr, ...] [HAVING expr]
+// [ORDER BY expr [ASC|DESC], ...] [LIMIT n] [OFFSET m]
+func (p *Parser) parseSelect() (Statement, error) {
+	if err := p.expectKeywords("SELECT"); err != nil {
+		return nil, err
+	}
+
+	stmt := &SelectStmt{}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Items = append(stmt.Items, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if err := p.expectKeywords("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	if stmt.From, err = p.parseTableRef(); err != nil {
+		return nil, err
+	}
+	for {
+		join, ok, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		stmt.Joins = append(stmt.Joins, join)
+	}
+
+	if stmt.Where, err = p.parseOptionalWhere(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeywords("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, expr)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		if stmt.Having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeywords("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			item := OrderItem{Expr: expr}
+			if p.acceptKeyword("DESC") {
+				item.Desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Limit, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if stmt.Offset, err = p.parseCount(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseSelectItem 解析 *、table.* 或 expr [[AS] alias]
+func (p *Parser) parseSelectItem() (SelectItem, error) {
+	if p.acceptSymbol("*") {
+		return SelectItem{Star: true}, nil
+	}
+	if p.peek().Type == TokenIdent && p.peekAt(1).Value == "." && p.peekAt(2).Value == "*" {
+		table := p.next().Value
+		p.pos += 2
+		return SelectItem{Star: true, Table: table}, nil
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+	item := SelectItem{Expr: expr}
+	if p.acceptKeyword("AS") {
+		if item.Alias, err = p.expectIdent(); err != nil {
+			return SelectItem{}, err
+		}
+	} else if p.peek().Type == TokenIdent {
+		item.Alias = p.next().Value
+	}
+	return item, nil
+}
+
+// parseTableRef 解析 name [[AS] alias]
+func (p *Parser) parseTableRef() (TableRef, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return TableRef{}, err
+	}
+	ref := TableRef{Name: name}
+	if p.acceptKeyword("AS") {
+		if ref.Alias, err = p.expectIdent(); err != nil {
+			return TableRef{}, err
+		}
+	} else if p.peek().Type == TokenIdent {
+		ref.Alias = p.next().Value
+	}
+	return ref, nil
+}
+
+// parseJoin 解析 [INNER] JOIN table ON expr 或 LEFT [OUTER] JOIN table ON expr，
+// 后面没有连接时返回 false
+func (p *Parser) parseJoin() (JoinClause, bool, error) {
+	join := JoinClause{Type: InnerJoin}
+	switch {
+	case p.acceptKeyword("LEFT"):
+		join.Type = LeftJoin
+		p.acceptKeyword("OUTER")
+		if err := p.expectKeywords("JOIN"); err != nil {
+			return JoinClause{}, false, err
+		}
+	case p.acceptKeyword("INNER"):
+		if err := p.expectKeywords("JOIN"); err != nil {
+			return JoinClause{}, false, err
+		}
+	case !p.acceptKeyword("JOIN"):
+		return JoinClause{}, false, nil
+	}
+
+	var err error
+	if join.Table, err = p.parseTableRef(); err != nil {
+		return JoinClause{}, false, err
+	}
+	if err := p.expectKeywords("ON"); err != nil {
+		return JoinClause{}, false, err
+	}
+	if join.On, err = p.parseExpr(); err != nil {
+		return JoinClause{}, false, err
+	}
+	return join, true, nil
+}
+
+// parseCount 解析 LIMIT / OFFSET 后的非负整数
+func (p *Parser) parseCount() (*int, error) {
+	tok := p.peek()
+	if tok.Type != TokenInt {
+		return nil, p.errorf("expected non-negative integer, got %s", tok)
+	}
+	p.next()
+	n, err := strconv.Atoi(tok.Value)
+	if err != nil {
+		return nil, p.errorf("invalid integer %s", tok.Value)
+	}
+	return &n, nil
+}
+
+// UPDATE name SET col = value, ... [WHERE expr]
+func (p *Parser) parseUpdate() (Statement, error) {
+	if err := p.expectKeywords("UPDATE"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeywords("SET"); err != nil {
+		return nil, err
+	}
+
+	stmt := &UpdateStmt{Table: name}
+	for {
+		col, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Set = append(stmt.Set, Assignment{Column: col, Value: value})
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if stmt.Where, err = p.parseOptionalWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// DELETE FROM name [WHERE expr]
+func (p *Parser) parseDelete() (Statement, error) {
+	if err := p.expectKeywords("DELETE", "FROM"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &DeleteStmt{Table: name}
+	if stmt.Where, err = p.parseOptionalWhere(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// DROP TABLE [IF EXISTS] name
+func (p *Parser) parseDropTable() (Statement, error) {
+	if err := p.expectKeywords("DROP", "TABLE"); err != nil {
+		return nil, err
+	}
+	stmt := &DropTableStmt{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeywords("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfExists = true
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = name
+	return stmt, nil
+}
+
+// CREATE SEQUENCE name [START [WITH] n] [INCREMENT [BY] m]
+func (p *Parser) parseCreateSequence() (Statement, error) {
+	if err := p.expectKeywords("CREATE", "SEQUENCE"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &CreateSequenceStmt{Name: name, Start: 1, Increment: 1}
+	for {
+		switch {
+		case p.acceptKeyword("START"):
+			p.acceptKeyword("WITH")
+			if stmt.Start, err = p.parseInt(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("INCREMENT"):
+			p.acceptKeyword("BY")
+			if stmt.Increment, err = p.parseInt(); err != nil {
+				return nil, err
+			}
+		default:
+			return stmt, nil
+		}
+	}
+}
+
+// DROP SEQUENCE [IF EXISTS] name
+func (p *Parser) parseDropSequence() (Statement, error) {
+	if err := p.expectKeywords("DROP", "SEQUENCE"); err != nil {
+		return nil, err
+	}
+	stmt := &DropSequenceStmt{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeywords("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfExists = true
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = name
+	return stmt, nil
+}
+
+// CREATE [UNIQUE] INDEX name ON table (col, ...) [USING type]
+func (p *Parser) parseCreateIndex() (Statement, error) {
+	if err := p.expectKeywords("CREATE"); err != nil {
+		return nil, err
+	}
+	stmt := &CreateIndexStmt{Unique: p.acceptKeyword("UNIQUE")}
+	if err := p.expectKeywords("INDEX"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeywords("ON"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	columns, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("USING") {
+		using, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Using = strings.ToLower(using)
+	}
+	stmt.Name, stmt.Table, stmt.Columns = name, table, columns
+	return stmt, nil
+}
+
+// DROP INDEX name ON table
+func (p *Parser) parseDropIndex() (Statement, error) {
+	if err := p.expectKeywords("DROP", "INDEX"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeywords("ON"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &DropIndexStmt{Name: name, Table: table}, nil
+}
+
+// ALTER TABLE name RENAME TO new_name
+// ALTER TABLE name ADD [COLUMN] coldef
+// ALTER TABLE name DROP [COLUMN] col
+// ALTER TABLE name RENAME COLUMN col TO new_col
+// ALTER TABLE name MODIFY [COLUMN] coldef
+func (p *Parser) parseAlterTable() (Statement, error) {
+	if err := p.expectKeywords("ALTER", "TABLE"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &AlterTableStmt{Table: name}
+	switch {
+	case p.acceptKeyword("ADD"):
+		p.acceptKeyword("COLUMN")
+		stmt.Action = AddColumn
+		if stmt.Column, err = p.parseColumnDef(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("DROP"):
+		p.acceptKeyword("COLUMN")
+		stmt.Action = DropColumn
+		if stmt.Column.Name, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("MODIFY"):
+		p.acceptKeyword("COLUMN")
+		stmt.Action = ModifyColumn
+		if stmt.Column, err = p.parseColumnDef(); err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("RENAME"):
+		if p.acceptKeyword("TO") {
+			newName, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &RenameTableStmt{Table: name, NewName: newName}, nil
+		}
+		if err := p.expectKeywords("COLUMN"); err != nil {
+			return nil, err
+		}
+		stmt.Action = RenameColumn
+		if stmt.Column.Name, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeywords("TO"); err != nil {
+			return nil, err
+		}
+		if stmt.NewName, err = p.expectIdent(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf("expected ADD, DROP, RENAME or MODIFY, got %s", p.peek())
+	}
+	return stmt, nil
+}
+
+// TRUNCATE [TABLE] name
+func (p *Parser) parseTruncate() (Statement, error) {
+	if err := p.expectKeywords("TRUNCATE"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("TABLE")
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &TruncateStmt{Table: name}, nil
+}
+
+// BEGIN [TRANSACTION] 或 START TRANSACTION
+func (p *Parser) parseBegin() (Statement, error) {
+	if p.acceptKeyword("START") {
+		if err := p.expectKeywords("TRANSACTION"); err != nil {
+			return nil, err
+		}
+		return &BeginStmt{}, nil
+	}
+	if err := p.expectKeywords("BEGIN"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("TRANSACTION")
+	return &BeginStmt{}, nil
+}
+
+// ROLLBACK [TRANSACTION] [TO [SAVEPOINT] name]
+func (p *Parser) parseRollback() (Statement, error) {
+	if err := p.expectKeywords("ROLLBACK"); err != nil {
+		return nil, err
+	}
+	p.acceptKeyword("TRANSACTION")
+	if !p.acceptKeyword("TO") {
+		return &RollbackStmt{}, nil
+	}
+	p.acceptKeyword("SAVEPOINT")
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	return &RollbackStmt{Savepoint: name}, nil
+}
+
+// SET AUTOSAVE [= | TO] 'policy'
+func (p *Parser) parseSetAutoSave() (Statement, error) {
+	if err := p.expectKeywords("SET", "AUTOSAVE"); err != nil {
+		return nil, err
+	}
+	if !p.acceptSymbol("=") {
+		p.acceptKeyword("TO")
+	}
+	policy, err := p.expectString("autosave policy")
+	if err != nil {
+		return nil, err
+	}
+	return &SetAutoSaveStmt{Policy: policy}, nil
+}
+
+// RESTORE FROM 'file' [TABLES name, ...]
+func (p *Parser) parseRestore() (Statement, error) {
+	if err := p.expectKeywords("RESTORE", "FROM"); err != nil {
+		return nil, err
+	}
+	file, err := p.expectString("backup file")
+	if err != nil {
+		return nil, err
+	}
+	stmt := &RestoreStmt{File: file}
+	if p.acceptKeyword("TABLES") {
+		if stmt.Tables, err = p.parseIdentList(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseOptionalWhere() (Expr, error) {
+	if !p.acceptKeyword("WHERE") {
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+// parseExpr 解析条件表达式，优先级从低到高为 OR、AND、NOT、谓词
+//
+//	expr      := andExpr { OR andExpr }
+//	andExpr   := notExpr { AND notExpr }
+//	notExpr   := NOT notExpr | predicate
+//	predicate := operand [ compOp operand
+//	                     | [NOT] IN "(" value { "," value } ")"
+//	                     | [NOT] BETWEEN operand AND operand
+//	                     | [NOT] LIKE operand
+//	                     | IS [NOT] NULL ]
+//	operand   := [table "."] column | func "(" [ "*" | expr { "," expr } ] ")" | value | "(" expr ")"
+func (p *Parser) parseExpr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *Parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	}
+	return p.parsePredicate()
+}
+
+// 比较运算符，"<>" 统一为 "!="
+var comparisonOps = map[string]string{
+	"=":  "=",
+	"!=": "!=",
+	"<>": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+func (p *Parser) parsePredicate() (Expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.Type == TokenSymbol {
+		if op, ok := comparisonOps[tok.Value]; ok {
+			p.next()
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return &BinaryExpr{Op: op, Left: left, Right: right}, nil
+		}
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err := p.expectKeywords("NULL"); err != nil {
+			return nil, err
+		}
+		return &IsNullExpr{Expr: left, Not: not}, nil
+	}
+
+	// NOT 之后必须跟 IN、BETWEEN 或 LIKE
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		in := &InExpr{Expr: left, Not: not}
+		for {
+			value, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, value)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeywords("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Expr: left, Low: low, High: high, Not: not}, nil
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &LikeExpr{Expr: left, Pattern: pattern, Not: not}, nil
+	case not:
+		return nil, p.errorf("expected IN, BETWEEN or LIKE after NOT, got %s", p.peek())
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseOperand() (Expr, error) {
+	if p.acceptSymbol("(") {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	if p.peek().Type == TokenIdent && !p.atTimestampLiteral() {
+		name := p.next().Value
+		if p.acceptSymbol("(") {
+			return p.parseFuncCall(name)
+		}
+		if p.acceptSymbol(".") {
+			col, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &ColumnRef{Table: name, Name: col}, nil
+		}
+		return &ColumnRef{Name: name}, nil
+	}
+	return p.parseLiteral()
+}
+
+// atTimestampLiteral 判断接下来是否为 TIMESTAMP 'text' 形式的时间常量。
+// TIMESTAMP 同时是类型名，因此不作为关键字
+func (p *Parser) atTimestampLiteral() bool {
+	tok := p.peek()
+	return tok.Type == TokenIdent && strings.EqualFold(tok.Value, "TIMESTAMP") && p.peekAt(1).Type == TokenString
+}
+
+// parseFuncCall 解析函数名和左括号之后的参数列表
+func (p *Parser) parseFuncCall(name string) (Expr, error) {
+	call := &FuncCall{Name: strings.ToUpper(name)}
+	switch tok := p.peek(); {
+	case p.acceptSymbol("*"):
+		call.Star = true
+	case tok.Type == TokenSymbol && tok.Value == ")":
+		// 无参数
+	default:
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// parseValue 解析 INSERT、UPDATE 中的值：常量或函数调用（如 NEXTVAL('seq')）
+func (p *Parser) parseValue() (Expr, error) {
+	if p.peek().Type == TokenIdent && p.peekAt(1).Type == TokenSymbol && p.peekAt(1).Value == "(" {
+		name := p.next().Value
+		p.next()
+		return p.parseFuncCall(name)
+	}
+	return p.parseLiteral()
+}
+
+// parseInt 解析整数常量，可带负号
+func (p *Parser) parseInt() (int, error) {
+	lit, err := p.parseLiteral()
+	if err != nil {
+		return 0, err
+	}
+	n, ok := lit.(*Literal).Value.(int64)
+	if !ok {
+		return 0, p.errorf("expected integer, got %s", lit)
+	}
+	return int(n), nil
+}
+
+// parseLiteral 解析常量：数值（可带负号）、字符串、TRUE、FALSE、TIMESTAMP 'text' 或 NULL
+func (p *Parser) parseLiteral() (Expr, error) {
+	negative := p.acceptSymbol("-")
+	tok := p.peek()
+
+	switch {
+	case tok.Type == TokenFloat:
+		p.next()
+		f, err := strconv.ParseFloat(tok.Value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", tok.Value)
+		}
+		if negative {
+			f = -f
+		}
+		return &Literal{Value: f}, nil
+	case tok.Type == TokenInt:
+		p.next()
+		text := tok.Value
+		if negative {
+			text = "-" + text
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %s", text)
+		}
+		return &Literal{Value: n}, nil
+	case negative:
+		return nil, p.errorf("expected number after '-', got %s", tok)
+	case tok.Type == TokenString:
+		p.next()
+		return &Literal{Value: tok.Value}, nil
+	case tok.Type == TokenKeyword && tok.Value == "NULL":
+		p.next()
+		return &Literal{Value: nil}, nil
+	case tok.Type == TokenKeyword && (tok.Value == "TRUE" || tok.Value == "FALSE"):
+		p.next()
+		return &Literal{Value: tok.Value == "TRUE"}, nil
+	case p.atTimestampLiteral():
+		p.next()
+		t, err := db.ParseTimestamp(p.next().Value)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		return &Literal{Value: t}, nil
+	default:
+		return nil, p.errorf("expected value, got %s", tok)
+	}
+}
+
+func (p *Parser) parseIdentList() ([]string, error) {
+	names := make([]string, 0)
+	for {
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptSymbol(",") {
+			return names, nil
+		}
+	}
+}
+
+// 以下为词法单元的读取辅助函数
+
+func (p *Parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+// peekAt 向后查看第 n 个词法单元，越界时返回 EOF
+func (p *Parser) peekAt(n int) Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+func (p *Parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Type != TokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *Parser) acceptSymbol(sym string) bool {
+	tok := p.peek()
+	if tok.Type == TokenSymbol && tok.Value == sym {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) acceptKeyword(kw string) bool {
+	tok := p.peek()
+	if tok.Type == TokenKeyword && tok.Value == kw {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *Parser) expectSymbol(sym string) error {
+	if !p.acceptSymbol(sym) {
+		return p.errorf("expected '%s', got %s", sym, p.peek())
+	}
+	return nil
+}
+
+func (p *Parser) expectKeywords(kws ...string) error {
+	for _, kw := range kws {
+		if !p.acceptKeyword(kw) {
+			return p.errorf("expected %s, got %s", kw, p.peek())
+		}
+	}
+	return nil
+}
+
+func (p *Parser) expectIdent() (string, error) {
+	tok := p.peek()
+	if tok.Type != TokenIdent {
+		return "", p.errorf("expected identifier, got %s", tok)
+	}
+	p.next()
+	return tok.Value, nil
+}
+
+// expectString 读取字符串常量，what 为错误信息中的名称
+func (p *Parser) expectString(what string) (string, error) {
+	tok := p.peek()
+	if tok.Type != TokenString {
+		return "", p.errorf("expected %s string, got %s", what, tok)
+	}
+	p.next()
+	return tok.Value, nil
+}
+
+func (p *Parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at position %d: %s", p.peek().Pos, fmt.Sprintf(format, args...))
+}
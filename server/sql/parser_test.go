@@ -0,0 +1,260 @@
+package sql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatements(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want Statement
+	}{
+		{
+			"CREATE TABLE users (id int, name string)",
+			&CreateTableStmt{Table: "users", Columns: []ColumnDef{{Name: "id", Type: "int"}, {Name: "name", Type: "string"}}},
+		},
+		{
+			"CREATE TABLE t (id int NOT NULL, name string NULL DEFAULT 'x', n int DEFAULT NULL)",
+			&CreateTableStmt{Table: "t", Columns: []ColumnDef{
+				{Name: "id", Type: "int", NotNull: true},
+				{Name: "name", Type: "string", Default: &Literal{Value: "x"}},
+				{Name: "n", Type: "int", Default: &Literal{Value: nil}},
+			}},
+		},
+		{
+			"CREATE TABLE t (id int PRIMARY KEY AUTO_INCREMENT, email string UNIQUE NOT NULL, a int, b int, UNIQUE (a, b))",
+			&CreateTableStmt{
+				Table: "t",
+				Columns: []ColumnDef{
+					{Name: "id", Type: "int", PrimaryKey: true, AutoIncrement: true},
+					{Name: "email", Type: "string", Unique: true, NotNull: true},
+					{Name: "a", Type: "int"},
+					{Name: "b", Type: "int"},
+				},
+				Constraints: []TableConstraint{{Columns: []string{"a", "b"}}},
+			},
+		},
+		{
+			"INSERT INTO users (name, id) VALUES ('a', 1), ('b''c', -2);",
+			&InsertStmt{
+				Table:   "users",
+				Columns: []string{"name", "id"},
+				Rows: [][]Expr{
+					{&Literal{Value: "a"}, &Literal{Value: int64(1)}},
+					{&Literal{Value: "b'c"}, &Literal{Value: int64(-2)}},
+				},
+			},
+		},
+		{"INSERT INTO users VALUES (NULL)", &InsertStmt{Table: "users", Rows: [][]Expr{{&Literal{Value: nil}}}}},
+		{
+			"INSERT INTO t VALUES (-1.5, TRUE, false, TIMESTAMP '2024-01-02 03:04:05')",
+			&InsertStmt{Table: "t", Rows: [][]Expr{{
+				&Literal{Value: -1.5},
+				&Literal{Value: true},
+				&Literal{Value: false},
+				&Literal{Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			}}},
+		},
+		{
+			"select * from users where id = 1 and name = \"x y\"",
+			&SelectStmt{
+				Items: []SelectItem{{Star: true}},
+				From:  TableRef{Name: "users"},
+				Where: &BinaryExpr{
+					Op:    "AND",
+					Left:  &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "id"}, Right: &Literal{Value: int64(1)}},
+					Right: &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "name"}, Right: &Literal{Value: "x y"}},
+				},
+			},
+		},
+		{
+			"UPDATE users SET age = 2, name = 'x' WHERE id = 1",
+			&UpdateStmt{
+				Table: "users",
+				Set: []Assignment{
+					{Column: "age", Value: &Literal{Value: int64(2)}},
+					{Column: "name", Value: &Literal{Value: "x"}},
+				},
+				Where: &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "id"}, Right: &Literal{Value: int64(1)}},
+			},
+		},
+		{"DELETE FROM users", &DeleteStmt{Table: "users"}},
+		{"DROP TABLE IF EXISTS users", &DropTableStmt{Table: "users", IfExists: true}},
+		{"ALTER TABLE users RENAME TO people", &RenameTableStmt{Table: "users", NewName: "people"}},
+		{"TRUNCATE users", &TruncateStmt{Table: "users"}},
+		{"TRUNCATE TABLE users", &TruncateStmt{Table: "users"}},
+		{"CREATE SEQUENCE s START WITH 10 INCREMENT BY -2", &CreateSequenceStmt{Name: "s", Start: 10, Increment: -2}},
+		{"CREATE SEQUENCE s", &CreateSequenceStmt{Name: "s", Start: 1, Increment: 1}},
+		{"DROP SEQUENCE IF EXISTS s", &DropSequenceStmt{Name: "s", IfExists: true}},
+		{"CREATE INDEX idx ON t (a, b)", &CreateIndexStmt{Name: "idx", Table: "t", Columns: []string{"a", "b"}}},
+		{"CREATE UNIQUE INDEX idx ON t (a)", &CreateIndexStmt{Name: "idx", Table: "t", Columns: []string{"a"}, Unique: true}},
+		{"CREATE INDEX idx ON t (a) USING Ordered", &CreateIndexStmt{Name: "idx", Table: "t", Columns: []string{"a"}, Using: "ordered"}},
+		{"DROP INDEX idx ON t", &DropIndexStmt{Name: "idx", Table: "t"}},
+		{"BEGIN", &BeginStmt{}},
+		{"START TRANSACTION", &BeginStmt{}},
+		{"COMMIT", &CommitStmt{}},
+		{"ROLLBACK", &RollbackStmt{}},
+		{"ROLLBACK TO SAVEPOINT s1", &RollbackStmt{Savepoint: "s1"}},
+		{"SAVEPOINT s1", &SavepointStmt{Name: "s1"}},
+		{"RELEASE SAVEPOINT s1", &ReleaseSavepointStmt{Name: "s1"}},
+		{"SET AUTOSAVE = 'writes:100'", &SetAutoSaveStmt{Policy: "writes:100"}},
+		{"SET AUTOSAVE TO 'sync'", &SetAutoSaveStmt{Policy: "sync"}},
+		{"SET AUTOSAVE 'shutdown'", &SetAutoSaveStmt{Policy: "shutdown"}},
+		{"SHOW AUTOSAVE", &ShowAutoSaveStmt{}},
+		{"BACKUP TO 'daily/b.json'", &BackupStmt{File: "daily/b.json"}},
+		{"RESTORE FROM 'b.json'", &RestoreStmt{File: "b.json"}},
+		{"RESTORE FROM 'b.json' TABLES users, orders", &RestoreStmt{File: "b.json", Tables: []string{"users", "orders"}}},
+		{
+			"INSERT INTO t (id) VALUES (NEXTVAL('s'))",
+			&InsertStmt{Table: "t", Columns: []string{"id"}, Rows: [][]Expr{{&FuncCall{Name: "NEXTVAL", Args: []Expr{&Literal{Value: "s"}}}}}},
+		},
+		{
+			"ALTER TABLE users ADD COLUMN age int DEFAULT 0",
+			&AlterTableStmt{Table: "users", Action: AddColumn, Column: ColumnDef{Name: "age", Type: "int", Default: &Literal{Value: int64(0)}}},
+		},
+		{"ALTER TABLE users DROP age", &AlterTableStmt{Table: "users", Action: DropColumn, Column: ColumnDef{Name: "age"}}},
+		{"ALTER TABLE users MODIFY COLUMN age string", &AlterTableStmt{Table: "users", Action: ModifyColumn, Column: ColumnDef{Name: "age", Type: "string"}}},
+		{"ALTER TABLE users RENAME COLUMN age TO years", &AlterTableStmt{Table: "users", Action: RenameColumn, Column: ColumnDef{Name: "age"}, NewName: "years"}},
+		{
+			"SELECT u.name, o.* FROM users u JOIN orders AS o ON u.id = o.uid LEFT OUTER JOIN items ON items.oid = o.id",
+			&SelectStmt{
+				Items: []SelectItem{
+					{Expr: &ColumnRef{Table: "u", Name: "name"}},
+					{Star: true, Table: "o"},
+				},
+				From: TableRef{Name: "users", Alias: "u"},
+				Joins: []JoinClause{
+					{
+						Type:  InnerJoin,
+						Table: TableRef{Name: "orders", Alias: "o"},
+						On:    &BinaryExpr{Op: "=", Left: &ColumnRef{Table: "u", Name: "id"}, Right: &ColumnRef{Table: "o", Name: "uid"}},
+					},
+					{
+						Type:  LeftJoin,
+						Table: TableRef{Name: "items"},
+						On:    &BinaryExpr{Op: "=", Left: &ColumnRef{Table: "items", Name: "oid"}, Right: &ColumnRef{Table: "o", Name: "id"}},
+					},
+				},
+			},
+		},
+		{
+			"SELECT name, count(*) FROM t GROUP BY name HAVING SUM(age) > 10",
+			&SelectStmt{
+				Items: []SelectItem{
+					{Expr: &ColumnRef{Name: "name"}},
+					{Expr: &FuncCall{Name: "COUNT", Star: true}},
+				},
+				From:    TableRef{Name: "t"},
+				GroupBy: []Expr{&ColumnRef{Name: "name"}},
+				Having: &BinaryExpr{
+					Op:    ">",
+					Left:  &FuncCall{Name: "SUM", Args: []Expr{&ColumnRef{Name: "age"}}},
+					Right: &Literal{Value: int64(10)},
+				},
+			},
+		},
+		{
+			"SELECT id, name AS n, age a FROM t ORDER BY n DESC, 1 LIMIT 10 OFFSET 5",
+			&SelectStmt{
+				Items: []SelectItem{
+					{Expr: &ColumnRef{Name: "id"}},
+					{Expr: &ColumnRef{Name: "name"}, Alias: "n"},
+					{Expr: &ColumnRef{Name: "age"}, Alias: "a"},
+				},
+				From:    TableRef{Name: "t"},
+				OrderBy: []OrderItem{{Expr: &ColumnRef{Name: "n"}, Desc: true}, {Expr: &Literal{Value: int64(1)}}},
+				Limit:   intPtr(10),
+				Offset:  intPtr(5),
+			},
+		},
+		{
+			"DELETE FROM t WHERE NOT (a = 1 OR b IS NOT NULL) AND c NOT IN (1, 2)",
+			&DeleteStmt{
+				Table: "t",
+				Where: &BinaryExpr{
+					Op: "AND",
+					Left: &NotExpr{Expr: &BinaryExpr{
+						Op:    "OR",
+						Left:  &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "a"}, Right: &Literal{Value: int64(1)}},
+						Right: &IsNullExpr{Expr: &ColumnRef{Name: "b"}, Not: true},
+					}},
+					Right: &InExpr{Expr: &ColumnRef{Name: "c"}, List: []Expr{&Literal{Value: int64(1)}, &Literal{Value: int64(2)}}, Not: true},
+				},
+			},
+		},
+		{
+			"SELECT * FROM t WHERE a BETWEEN 1 AND 3 OR b NOT LIKE 'x%'",
+			&SelectStmt{
+				Items: []SelectItem{{Star: true}},
+				From:  TableRef{Name: "t"},
+				Where: &BinaryExpr{
+					Op:    "OR",
+					Left:  &BetweenExpr{Expr: &ColumnRef{Name: "a"}, Low: &Literal{Value: int64(1)}, High: &Literal{Value: int64(3)}},
+					Right: &LikeExpr{Expr: &ColumnRef{Name: "b"}, Pattern: &Literal{Value: "x%"}, Not: true},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.sql)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	stmts, err := ParseScript("INSERT INTO t VALUES (1);; DELETE FROM t; -- comment\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 2 {
+		t.Fatalf("got %d statements, want 2", len(stmts))
+	}
+	if _, err := Parse("DELETE FROM t; DELETE FROM t"); err == nil {
+		t.Error("Parse accepted two statements")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string // 错误信息中应包含的文本
+	}{
+		{"", "empty statement"},
+		{"SELEC * FROM t", "expected statement"},
+		{"SELECT * FROM", "position"},
+		{"INSERT INTO t VALUES (1", "position"},
+		{"SELECT * FROM t WHERE a = 'unterminated", "unterminated"},
+		{"DELETE FROM t WHERE a = -'x'", "expected number"},
+		{"SELECT * FROM t WHERE a NOT = 1", "expected IN, BETWEEN or LIKE"},
+		{"SELECT * FROM t LIMIT -1", "non-negative integer"},
+		{"ALTER TABLE t CHANGE a b", "expected ADD, DROP, RENAME or MODIFY"},
+		{"SELECT FROM t", "position"},
+		{"SET AUTOSAVE = sync", "expected autosave policy string"},
+		{"SHOW TABLES", "AUTOSAVE"},
+		{"BACKUP TO b.json", "expected backup file string"},
+		{"RESTORE FROM 'b.json' TABLES", "position"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.sql)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", tt.sql)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error %q does not mention %q", tt.sql, err, tt.want)
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}